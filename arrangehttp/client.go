@@ -22,30 +22,60 @@ func (rtf RoundTripperFunc) RoundTrip(request *http.Request) (*http.Response, er
 	return rtf(request)
 }
 
+// fromClientOptions converts legacy ClientOption values with FromClientOption.
+func fromClientOptions(cos []ClientOption) []Option[http.Client] {
+	opts := make([]Option[http.Client], 0, len(cos))
+	for _, co := range cos {
+		opts = append(opts, FromClientOption(co))
+	}
+
+	return opts
+}
+
 // ApplyClientOptions executes options against a client.  The original client is returned, along
 // with any error(s) that occurred.  All options are executed, so the returned error may be an
 // aggregate error which can be inspected via go.uber.org/multierr.
 //
 // This function can be used as an fx decorator for a client within the enclosing application.
+// ClientOption is deprecated, so new code should use ApplyClientOptionsWith instead.
 func ApplyClientOptions(client *http.Client, opts ...ClientOption) (*http.Client, error) {
-	err := ClientOptions(opts).ApplyToClient(client)
+	return ApplyClientOptionsWith(client, fromClientOptions(opts)...)
+}
+
+// ApplyClientOptionsWith is like ApplyClientOptions, but it executes Option[http.Client] values.
+func ApplyClientOptionsWith(client *http.Client, opts ...Option[http.Client]) (*http.Client, error) {
+	err := Options[http.Client](opts).Apply(client)
 	return client, err
 }
 
 // NewClient is the primary client constructor for arrange.  Use this when you are creating a client
 // from a (possibly unmarshaled) ClientConfig.  The options can be annotated to come from a value group,
 // which is useful when there are multiple clients in a single fx.App.
+//
+// ClientOption is deprecated, so new code should use NewClientWith instead.
 func NewClient(cc ClientConfig, opts ...ClientOption) (*http.Client, error) {
-	return NewClientCustom(cc, opts...)
+	return NewClientCustomWith(cc, fromClientOptions(opts)...)
+}
+
+// NewClientWith is like NewClient, but it applies Option[http.Client] values.
+func NewClientWith(cc ClientConfig, opts ...Option[http.Client]) (*http.Client, error) {
+	return NewClientCustomWith(cc, opts...)
 }
 
 // NewClientCustom is an *http.Client constructor that allows customization of the concrete
 // ClientFactory used to create the *http.Client.  This function is useful when you have a
 // custom (possibly unmarshaled) configuration struct that implements ClientFactory.
-func NewClientCustom[F ClientFactory](cf F, opts ...ClientOption) (c *http.Client, err error) {
+//
+// ClientOption is deprecated, so new code should use NewClientCustomWith instead.
+func NewClientCustom[F ClientFactory](cf F, opts ...ClientOption) (*http.Client, error) {
+	return NewClientCustomWith(cf, fromClientOptions(opts)...)
+}
+
+// NewClientCustomWith is like NewClientCustom, but it applies Option[http.Client] values.
+func NewClientCustomWith[F ClientFactory](cf F, opts ...Option[http.Client]) (c *http.Client, err error) {
 	c, err = cf.NewClient()
 	if err == nil {
-		c, err = ApplyClientOptions(c, opts...)
+		c, err = ApplyClientOptionsWith(c, opts...)
 	}
 
 	return
@@ -57,30 +87,95 @@ func NewClientCustom[F ClientFactory](cf F, opts ...ClientOption) (c *http.Clien
 //
 //   - NewClient is used to create the client as a component named clientName
 //   - ClientConfig is an optional dependency with the name clientName+".config"
-//   - []ClientOption is an value group dependency with the name clientName+".options"
+//   - []Option[http.Client] is an optional value group dependency with the name clientName+".options"
+//   - []ClientOption is an optional, deprecated value group dependency with the name clientName+".options"
+//
+// Any deprecated ClientOption values are converted with FromClientOption and applied before
+// the Option[http.Client] values from the same group.
 //
 // The external set of options, if supplied, is applied to the client after any injected options.
 // This allows for options that come from outside the enclosing fx.App, as might be the case
 // for options driven by the command line.
+//
+// If the ClientFactory also implements ClientLifecycleFactory, as ClientConfig does, the client
+// is created with NewClientLifecycle, so that resources such as certificate watchers are bound
+// to the application's lifecycle.
+//
+// The client is bound to the enclosing application's lifecycle, so that idle connections are
+// closed when the application stops.  If the ClientFactory also implements ClientHealthCheckFactory,
+// as ClientConfig does, its health check is run when the application starts.
+//
+// ClientOption is deprecated, so new code that supplies external options should use
+// ProvideClientWith instead.
 func ProvideClient(clientName string, external ...ClientOption) fx.Option {
-	return ProvideClientCustom[ClientConfig](clientName, external...)
+	return ProvideClientCustomWith[ClientConfig](clientName, fromClientOptions(external)...)
+}
+
+// ProvideClientWith is like ProvideClient, but its external options are Option[http.Client] values.
+func ProvideClientWith(clientName string, external ...Option[http.Client]) fx.Option {
+	return ProvideClientCustomWith[ClientConfig](clientName, external...)
 }
 
 // ProvideClientCustom is like ProvideClient, but it allows customization of the concrete
 // ClientFactory dependency.
+//
+// ClientOption is deprecated, so new code that supplies external options should use
+// ProvideClientCustomWith instead.
 func ProvideClientCustom[F ClientFactory](clientName string, external ...ClientOption) fx.Option {
+	return ProvideClientCustomWith[F](clientName, fromClientOptions(external)...)
+}
+
+// ProvideClientCustomWith is like ProvideClientCustom, but its external options are
+// Option[http.Client] values.
+func ProvideClientCustomWith[F ClientFactory](clientName string, external ...Option[http.Client]) fx.Option {
 	if len(clientName) == 0 {
 		return fx.Error(ErrClientNameRequired)
 	}
 
-	return fx.Provide(
-		fx.Annotate(
-			NewClientCustom[F],
-			arrange.Tags().
-				OptionalName(clientName+".config").
-				Group(clientName+".options").
-				ParamTags(),
-			arrange.Tags().Name(clientName).ResultTags(),
+	ctor := func(cf F, legacy []ClientOption, lifecycle fx.Lifecycle, injected ...Option[http.Client]) (c *http.Client, err error) {
+		opts := fromClientOptions(legacy)
+		opts = append(opts, injected...)
+		if clf, ok := any(cf).(ClientLifecycleFactory); ok {
+			c, err = clf.NewClientLifecycle(lifecycle)
+		} else {
+			c, err = cf.NewClient()
+		}
+
+		if err == nil {
+			c, err = ApplyClientOptionsWith(c, append(opts, external...)...)
+		}
+
+		return
+	}
+
+	return fx.Options(
+		fx.Provide(
+			fx.Annotate(
+				ctor,
+				arrange.Tags().
+					OptionalName(clientName+".config").
+					Group(clientName+".options").
+					Skip().
+					Group(clientName+".options").
+					ParamTags(),
+				arrange.Tags().Name(clientName).ResultTags(),
+			),
+		),
+		fx.Invoke(
+			fx.Annotate(
+				func(cf F, client *http.Client, lifecycle fx.Lifecycle) {
+					var check ClientHealthCheck
+					if chf, ok := any(cf).(ClientHealthCheckFactory); ok {
+						check = chf.NewClientHealthCheck()
+					}
+
+					BindClientHealthCheck(client, check, lifecycle)
+				},
+				arrange.Tags().
+					OptionalName(clientName+".config").
+					Name(clientName).
+					ParamTags(),
+			),
 		),
 	)
 }
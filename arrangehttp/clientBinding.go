@@ -0,0 +1,54 @@
+package arrangehttp
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/fx"
+)
+
+// clientBinding holds the components used to bind an *http.Client to the
+// lifecycle of an enclosing fx.App.
+type clientBinding struct {
+	client *http.Client
+
+	// check is the optional health check run when the application starts.
+	check ClientHealthCheck
+}
+
+// bind appends this binding's hook to the given lifecycle.
+func (cb clientBinding) bind(lifecycle fx.Lifecycle) {
+	lifecycle.Append(fx.Hook{
+		OnStart: cb.onStart,
+		OnStop:  cb.onStop,
+	})
+}
+
+// onStart runs the health check, if one is configured.
+func (cb clientBinding) onStart(ctx context.Context) error {
+	return cb.check.Check(ctx, cb.client)
+}
+
+// onStop closes any idle connections held by the client's transport.
+func (cb clientBinding) onStop(context.Context) error {
+	cb.client.CloseIdleConnections()
+	return nil
+}
+
+// BindClient binds a client to the enclosing application's lifecycle.  When the
+// application stops, http.Client.CloseIdleConnections is invoked so that idle
+// keep-alive connections do not outlive the application.
+func BindClient(client *http.Client, lifecycle fx.Lifecycle) {
+	clientBinding{
+		client: client,
+	}.bind(lifecycle)
+}
+
+// BindClientHealthCheck is like BindClient, but also runs the given health check when
+// the application starts.  If the check fails, application startup fails.
+func BindClientHealthCheck(client *http.Client, check ClientHealthCheck, lifecycle fx.Lifecycle) {
+	clientBinding{
+		client: client,
+		check:  check,
+	}.bind(lifecycle)
+}
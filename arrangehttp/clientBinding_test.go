@@ -0,0 +1,160 @@
+package arrangehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange"
+	"github.com/xmidt-org/httpaux/roundtrip"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type mockCloseIdlerTransport struct {
+	mock.Mock
+}
+
+func (m *mockCloseIdlerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	args := m.Called(request)
+	response, _ := args.Get(0).(*http.Response)
+	return response, args.Error(1)
+}
+
+func (m *mockCloseIdlerTransport) CloseIdleConnections() {
+	m.Called()
+}
+
+type ClientBindingSuite struct {
+	suite.Suite
+}
+
+func (suite *ClientBindingSuite) TestBindClient() {
+	var (
+		transport = new(mockCloseIdlerTransport)
+		lifecycle = fxtest.NewLifecycle(suite.T())
+	)
+
+	transport.On("CloseIdleConnections").Once()
+	BindClient(&http.Client{Transport: transport}, lifecycle)
+
+	lifecycle.RequireStart()
+	lifecycle.RequireStop()
+	transport.AssertExpectations(suite.T())
+}
+
+func (suite *ClientBindingSuite) TestBindClientHealthCheckFailure() {
+	var (
+		expectedErr = errors.New("expected")
+		transport   = new(mockCloseIdlerTransport)
+		lifecycle   = fxtest.NewLifecycle(suite.T())
+	)
+
+	transport.On("RoundTrip", mock.Anything).Return(nil, expectedErr).Once()
+	BindClientHealthCheck(
+		&http.Client{Transport: transport},
+		ClientHealthCheck{URL: "http://localhost/health"},
+		lifecycle,
+	)
+
+	suite.ErrorIs(lifecycle.Start(context.Background()), expectedErr)
+	transport.AssertExpectations(suite.T())
+}
+
+func (suite *ClientBindingSuite) TestProvideClientCloseIdleConnections() {
+	var (
+		transport = new(mockCloseIdlerTransport)
+		client    *http.Client
+	)
+
+	transport.On("CloseIdleConnections").Once()
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			fx.Annotate(
+				AsOption[http.Client](func(c *http.Client) {
+					c.Transport = transport
+				}),
+				arrange.Tags().Group("main.options").ResultTags(),
+				fx.As(new(Option[http.Client])),
+			),
+		),
+		ProvideClient("main"),
+		fx.Populate(
+			fx.Annotate(
+				&client,
+				arrange.Tags().Name("main").ParamTags(),
+			),
+		),
+	)
+
+	app.RequireStart()
+	suite.Same(transport, client.Transport)
+	app.RequireStop()
+	transport.AssertExpectations(suite.T())
+}
+
+func (suite *ClientBindingSuite) TestProvideClientHealthCheck() {
+	var (
+		status = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			suite.Equal(http.MethodHead, request.Method)
+			response.WriteHeader(status)
+		}))
+	)
+
+	defer server.Close()
+	newApp := func() *fx.App {
+		return fx.New(
+			fx.NopLogger,
+			fx.Supply(
+				fx.Annotate(
+					ClientConfig{
+						HealthCheck: ClientHealthCheck{
+							URL:    server.URL,
+							Method: http.MethodHead,
+						},
+					},
+					arrange.Tags().Name("main.config").ResultTags(),
+				),
+			),
+			ProvideClient("main"),
+		)
+	}
+
+	suite.Run("Success", func() {
+		app := newApp()
+		suite.Require().NoError(app.Start(context.Background()))
+		suite.NoError(app.Stop(context.Background()))
+	})
+
+	suite.Run("Failure", func() {
+		status = http.StatusServiceUnavailable
+		app := newApp()
+		err := app.Start(context.Background())
+		suite.Require().Error(err)
+
+		var chce *ClientHealthCheckError
+		suite.Require().ErrorAs(err, &chce)
+		suite.Equal(server.URL, chce.URL)
+		suite.Equal(http.StatusServiceUnavailable, chce.StatusCode)
+	})
+}
+
+func (suite *ClientBindingSuite) TestNewClientPreservesCloseIdler() {
+	client, err := NewClient(ClientConfig{
+		Header: http.Header{"X-Test": {"true"}},
+	})
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(client)
+	suite.Implements((*roundtrip.CloseIdler)(nil), client.Transport)
+}
+
+func TestClientBinding(t *testing.T) {
+	suite.Run(t, new(ClientBindingSuite))
+}
@@ -1,12 +1,19 @@
 package arrangehttp
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/xmidt-org/arrange/arrangetls"
 	"github.com/xmidt-org/httpaux"
 	"github.com/xmidt-org/httpaux/roundtrip"
+	"go.uber.org/fx"
 )
 
 // ClientFactory is the interface implemented by unmarshaled configuration objects
@@ -15,27 +22,118 @@ type ClientFactory interface {
 	NewClient() (*http.Client, error)
 }
 
+// ClientLifecycleFactory is an optional interface that a ClientFactory may implement when
+// the clients it creates hold resources, such as certificate watchers, that must be bound to
+// the enclosing application's lifecycle.  ProvideClientCustom uses NewClientLifecycle rather
+// than NewClient when it is available.
+//
+// ClientConfig implements this interface so that its TLS certificates are reloaded while the
+// application runs when TLS.Reload is set.
+type ClientLifecycleFactory interface {
+	// NewClientLifecycle is like ClientFactory.NewClient, but binds any resources the client
+	// uses to the given lifecycle.
+	NewClientLifecycle(fx.Lifecycle) (*http.Client, error)
+}
+
 // TransportConfig holds the unmarshalable configuration options for building an http.Transport
 type TransportConfig struct {
-	TLSHandshakeTimeout    time.Duration
-	DisableKeepAlives      bool
-	DisableCompression     bool
-	MaxIdleConns           int
-	MaxIdleConnsPerHost    int
-	MaxConnsPerHost        int
-	IdleConnTimeout        time.Duration
-	ResponseHeaderTimeout  time.Duration
-	ExpectContinueTimeout  time.Duration
-	ProxyConnectHeader     http.Header
-	MaxResponseHeaderBytes int64
-	WriteBufferSize        int
-	ReadBufferSize         int
-	ForceAttemptHTTP2      bool
+	// TLSHandshakeTimeout corresponds to http.Transport.TLSHandshakeTimeout
+	TLSHandshakeTimeout time.Duration `json:"tlsHandshakeTimeout" yaml:"tlsHandshakeTimeout"`
+
+	// DisableKeepAlives corresponds to http.Transport.DisableKeepAlives
+	DisableKeepAlives bool `json:"disableKeepAlives" yaml:"disableKeepAlives"`
+
+	// DisableCompression corresponds to http.Transport.DisableCompression
+	DisableCompression bool `json:"disableCompression" yaml:"disableCompression"`
+
+	// MaxIdleConns corresponds to http.Transport.MaxIdleConns
+	MaxIdleConns int `json:"maxIdleConns" yaml:"maxIdleConns"`
+
+	// MaxIdleConnsPerHost corresponds to http.Transport.MaxIdleConnsPerHost
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost" yaml:"maxIdleConnsPerHost"`
+
+	// MaxConnsPerHost corresponds to http.Transport.MaxConnsPerHost
+	MaxConnsPerHost int `json:"maxConnsPerHost" yaml:"maxConnsPerHost"`
+
+	// IdleConnTimeout corresponds to http.Transport.IdleConnTimeout
+	IdleConnTimeout time.Duration `json:"idleConnTimeout" yaml:"idleConnTimeout"`
+
+	// ResponseHeaderTimeout corresponds to http.Transport.ResponseHeaderTimeout
+	ResponseHeaderTimeout time.Duration `json:"responseHeaderTimeout" yaml:"responseHeaderTimeout"`
+
+	// ExpectContinueTimeout corresponds to http.Transport.ExpectContinueTimeout
+	ExpectContinueTimeout time.Duration `json:"expectContinueTimeout" yaml:"expectContinueTimeout"`
+
+	// ProxyConnectHeader corresponds to http.Transport.ProxyConnectHeader
+	ProxyConnectHeader http.Header `json:"proxyConnectHeader" yaml:"proxyConnectHeader"`
+
+	// MaxResponseHeaderBytes corresponds to http.Transport.MaxResponseHeaderBytes
+	MaxResponseHeaderBytes int64 `json:"maxResponseHeaderBytes" yaml:"maxResponseHeaderBytes"`
+
+	// WriteBufferSize corresponds to http.Transport.WriteBufferSize
+	WriteBufferSize int `json:"writeBufferSize" yaml:"writeBufferSize"`
+
+	// ReadBufferSize corresponds to http.Transport.ReadBufferSize
+	ReadBufferSize int `json:"readBufferSize" yaml:"readBufferSize"`
+
+	// ForceAttemptHTTP2 corresponds to http.Transport.ForceAttemptHTTP2.  This field
+	// is ignored if DisableHTTP2 is set.
+	ForceAttemptHTTP2 bool `json:"forceAttemptHTTP2" yaml:"forceAttemptHTTP2"`
+
+	// DisableHTTP2 prevents the transport from negotiating HTTP/2, even over TLS.
+	DisableHTTP2 bool `json:"disableHTTP2" yaml:"disableHTTP2"`
+
+	// DialTimeout corresponds to net.Dialer.Timeout.  If neither this field nor
+	// DialKeepAlive is set, the default dialer is used.
+	DialTimeout time.Duration `json:"dialTimeout" yaml:"dialTimeout"`
+
+	// DialKeepAlive corresponds to net.Dialer.KeepAlive.  If neither this field nor
+	// DialTimeout is set, the default dialer is used.
+	DialKeepAlive time.Duration `json:"dialKeepAlive" yaml:"dialKeepAlive"`
+
+	// ProxyURL is the optional URL of the proxy used for all requests.  If unset,
+	// no proxy is used.
+	ProxyURL string `json:"proxyURL" yaml:"proxyURL"`
+
+	// NoProxy lists the hosts that bypass ProxyURL.  Each entry may be a host name, which
+	// also matches any subdomains, an IP address, a CIDR block, or "*" to match all hosts.
+	// A leading "." is permitted on host names.  Port numbers are ignored when matching.
+	// This field has no effect unless ProxyURL is set.
+	NoProxy []string `json:"noProxy" yaml:"noProxy"`
+}
+
+// newProxy creates the http.Transport.Proxy closure for this configuration.  If ProxyURL
+// is unset, this method returns nil.
+func (tc TransportConfig) newProxy() (func(*http.Request) (*url.URL, error), error) {
+	if len(tc.ProxyURL) == 0 {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(tc.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	np := newNoProxy(tc.NoProxy)
+	return func(request *http.Request) (*url.URL, error) {
+		if np.matches(request.URL.Hostname()) {
+			return nil, nil
+		}
+
+		return proxyURL, nil
+	}, nil
 }
 
 // NewTransport creates an http.Transport using this unmarshaled configuration
-// together with TLS information
-func (tc TransportConfig) NewTransport(c *arrangetls.Config) (transport *http.Transport, err error) {
+// together with TLS information.  The TLS certificates are loaded once, even if
+// c.Reload is set.
+func (tc TransportConfig) NewTransport(c *arrangetls.Config) (*http.Transport, error) {
+	return tc.newTransport(c, nil)
+}
+
+// newTransport is like NewTransport, but binds the watcher for any reloadable TLS
+// certificates to the given lifecycle.
+func (tc TransportConfig) newTransport(c *arrangetls.Config, lifecycle fx.Lifecycle) (transport *http.Transport, err error) {
 	transport = &http.Transport{
 		TLSHandshakeTimeout:    tc.TLSHandshakeTimeout,
 		DisableKeepAlives:      tc.DisableKeepAlives,
@@ -53,30 +151,158 @@ func (tc TransportConfig) NewTransport(c *arrangetls.Config) (transport *http.Tr
 		ForceAttemptHTTP2:      tc.ForceAttemptHTTP2,
 	}
 
-	transport.TLSClientConfig, err = c.New()
+	if tc.DialTimeout > 0 || tc.DialKeepAlive > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   tc.DialTimeout,
+			KeepAlive: tc.DialKeepAlive,
+		}).DialContext
+	}
+
+	if tc.DisableHTTP2 {
+		// a non-nil, empty map disables HTTP/2 in net/http
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	transport.Proxy, err = tc.newProxy()
+	if err == nil {
+		transport.TLSClientConfig, err = newTLSConfig(c, lifecycle)
+	}
+
 	return
 }
 
+// ClientHealthCheckFactory is an optional interface that a ClientFactory may implement
+// to supply a check that is run against the client when the enclosing application starts.
+//
+// ClientConfig implements this interface using its HealthCheck field.
+type ClientHealthCheckFactory interface {
+	// NewClientHealthCheck returns the startup check for the client.
+	NewClientHealthCheck() ClientHealthCheck
+}
+
+// ClientHealthCheckError indicates that a client's health check received a response
+// with a non-2xx status code.
+type ClientHealthCheckError struct {
+	// URL is the URL that was checked.
+	URL string
+
+	// StatusCode is the status code of the response.
+	StatusCode int
+}
+
+// Error describes the URL and status code of the failed check.
+func (chce *ClientHealthCheckError) Error() string {
+	var o strings.Builder
+	o.WriteString("Health check of ")
+	o.WriteString(chce.URL)
+	o.WriteString(" failed with status code ")
+	o.WriteString(strconv.Itoa(chce.StatusCode))
+
+	return o.String()
+}
+
+// ClientHealthCheck describes an optional request made with a client when the enclosing
+// application starts.  This can be used both to warm up connections and to verify that
+// a dependency is available.  The zero value of this type performs no check.
+type ClientHealthCheck struct {
+	// URL is the URL to check.  If unset, no check is performed.
+	URL string `json:"url" yaml:"url"`
+
+	// Method is the HTTP method used for the check.  If unset, GET is used.
+	Method string `json:"method" yaml:"method"`
+
+	// Timeout is the optional time limit for the check.  If unset, the check is bounded
+	// by the client's own timeout and the enclosing application's start timeout.
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+}
+
+// Check performs this health check using the given client.  A transport error or a
+// response with a non-2xx status code causes this method to return an error.
+func (chc ClientHealthCheck) Check(ctx context.Context, client *http.Client) error {
+	if len(chc.URL) == 0 {
+		return nil
+	}
+
+	if chc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, chc.Timeout)
+		defer cancel()
+	}
+
+	method := chc.Method
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, chc.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &ClientHealthCheckError{
+			URL:        chc.URL,
+			StatusCode: response.StatusCode,
+		}
+	}
+
+	return nil
+}
+
 // ClientConfig holds unmarshaled client configuration options.  It is the
 // built-in ClientFactory implementation in this package.
 type ClientConfig struct {
-	Timeout   time.Duration
-	Transport TransportConfig
-	Header    http.Header
-	TLS       *arrangetls.Config
+	// Timeout corresponds to http.Client.Timeout
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+
+	// Transport is the configuration for the client's http.Transport
+	Transport TransportConfig `json:"transport" yaml:"transport"`
+
+	// Header supplies HTTP headers to emit on every request from this client
+	Header http.Header `json:"header" yaml:"header"`
+
+	// TLS is the optional unmarshaled TLS configuration for the client's transport
+	TLS *arrangetls.Config `json:"tls" yaml:"tls"`
+
+	// HealthCheck is the optional check made with the client when the
+	// enclosing application starts.
+	HealthCheck ClientHealthCheck `json:"healthCheck" yaml:"healthCheck"`
 }
 
-// NewClient produces an http.Client given these unmarshaled configuration options
-func (cc ClientConfig) NewClient() (client *http.Client, err error) {
+// NewClient produces an http.Client given these unmarshaled configuration options.
+// The TLS certificates are loaded once, even if TLS.Reload is set.  Use NewClientLifecycle
+// or ProvideClient to reload them.
+func (cc ClientConfig) NewClient() (*http.Client, error) {
+	return cc.NewClientLifecycle(nil)
+}
+
+// NewClientLifecycle is like NewClient, but binds the watcher for any reloadable TLS
+// certificates to the given lifecycle.  If lifecycle is nil, this method is equivalent to NewClient.
+func (cc ClientConfig) NewClientLifecycle(lifecycle fx.Lifecycle) (client *http.Client, err error) {
 	client = &http.Client{
 		Timeout: cc.Timeout,
 	}
 
 	header := httpaux.NewHeader(cc.Header)
-	transport, err := cc.Transport.NewTransport(cc.TLS)
+	transport, err := cc.Transport.newTransport(cc.TLS, lifecycle)
 	if err == nil {
-		client.Transport = roundtrip.Header(header.SetTo)(transport)
+		// use a chain so that the transport's CloseIdleConnections is preserved
+		client.Transport = roundtrip.NewChain(
+			roundtrip.Header(header.SetTo),
+		).Then(transport)
 	}
 
 	return
 }
+
+// NewClientHealthCheck returns this configuration's HealthCheck.
+func (cc ClientConfig) NewClientHealthCheck() ClientHealthCheck {
+	return cc.HealthCheck
+}
@@ -0,0 +1,260 @@
+package arrangehttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange/arrangetls"
+	"gopkg.in/yaml.v3"
+)
+
+type ClientFactorySuite struct {
+	suite.Suite
+}
+
+// expectedClientConfig is the ClientConfig that the unmarshal tests expect.
+func (suite *ClientFactorySuite) expectedClientConfig() ClientConfig {
+	return ClientConfig{
+		Timeout: 15 * time.Second,
+		Transport: TransportConfig{
+			TLSHandshakeTimeout:    2 * time.Second,
+			DisableKeepAlives:      true,
+			DisableCompression:     true,
+			MaxIdleConns:           10,
+			MaxIdleConnsPerHost:    5,
+			MaxConnsPerHost:        20,
+			IdleConnTimeout:        time.Minute,
+			ResponseHeaderTimeout:  3 * time.Second,
+			ExpectContinueTimeout:  time.Second,
+			ProxyConnectHeader:     http.Header{"Proxy-Authorization": {"Basic xyz"}},
+			MaxResponseHeaderBytes: 4096,
+			WriteBufferSize:        1024,
+			ReadBufferSize:         2048,
+			ForceAttemptHTTP2:      true,
+			DisableHTTP2:           true,
+			DialTimeout:            5 * time.Second,
+			DialKeepAlive:          30 * time.Second,
+			ProxyURL:               "http://proxy.example.com:3128",
+			NoProxy:                []string{"localhost", ".internal.net", "10.0.0.0/8"},
+		},
+		Header: http.Header{"X-Multi": {"1", "2"}},
+		HealthCheck: ClientHealthCheck{
+			URL:     "http://localhost/health",
+			Method:  http.MethodHead,
+			Timeout: 500 * time.Millisecond,
+		},
+	}
+}
+
+func (suite *ClientFactorySuite) TestJSON() {
+	const document = `{
+		"timeout": 15000000000,
+		"transport": {
+			"tlsHandshakeTimeout": 2000000000,
+			"disableKeepAlives": true,
+			"disableCompression": true,
+			"maxIdleConns": 10,
+			"maxIdleConnsPerHost": 5,
+			"maxConnsPerHost": 20,
+			"idleConnTimeout": 60000000000,
+			"responseHeaderTimeout": 3000000000,
+			"expectContinueTimeout": 1000000000,
+			"proxyConnectHeader": {"Proxy-Authorization": ["Basic xyz"]},
+			"maxResponseHeaderBytes": 4096,
+			"writeBufferSize": 1024,
+			"readBufferSize": 2048,
+			"forceAttemptHTTP2": true,
+			"disableHTTP2": true,
+			"dialTimeout": 5000000000,
+			"dialKeepAlive": 30000000000,
+			"proxyURL": "http://proxy.example.com:3128",
+			"noProxy": ["localhost", ".internal.net", "10.0.0.0/8"]
+		},
+		"header": {"X-Multi": ["1", "2"]},
+		"healthCheck": {
+			"url": "http://localhost/health",
+			"method": "HEAD",
+			"timeout": 500000000
+		}
+	}`
+
+	var actual ClientConfig
+	suite.Require().NoError(json.Unmarshal([]byte(document), &actual))
+	suite.Equal(suite.expectedClientConfig(), actual)
+
+	data, err := json.Marshal(actual)
+	suite.Require().NoError(err)
+
+	var roundTrip ClientConfig
+	suite.Require().NoError(json.Unmarshal(data, &roundTrip))
+	suite.Equal(actual, roundTrip)
+}
+
+func (suite *ClientFactorySuite) TestYAML() {
+	const document = `
+timeout: 15s
+transport:
+  tlsHandshakeTimeout: 2s
+  disableKeepAlives: true
+  disableCompression: true
+  maxIdleConns: 10
+  maxIdleConnsPerHost: 5
+  maxConnsPerHost: 20
+  idleConnTimeout: 1m
+  responseHeaderTimeout: 3s
+  expectContinueTimeout: 1s
+  proxyConnectHeader:
+    Proxy-Authorization: ["Basic xyz"]
+  maxResponseHeaderBytes: 4096
+  writeBufferSize: 1024
+  readBufferSize: 2048
+  forceAttemptHTTP2: true
+  disableHTTP2: true
+  dialTimeout: 5s
+  dialKeepAlive: 30s
+  proxyURL: http://proxy.example.com:3128
+  noProxy:
+    - localhost
+    - .internal.net
+    - 10.0.0.0/8
+header:
+  X-Multi: ["1", "2"]
+healthCheck:
+  url: http://localhost/health
+  method: HEAD
+  timeout: 500ms
+`
+
+	var actual ClientConfig
+	suite.Require().NoError(yaml.Unmarshal([]byte(document), &actual))
+	suite.Equal(suite.expectedClientConfig(), actual)
+
+	data, err := yaml.Marshal(actual)
+	suite.Require().NoError(err)
+
+	var roundTrip ClientConfig
+	suite.Require().NoError(yaml.Unmarshal(data, &roundTrip))
+	suite.Equal(actual, roundTrip)
+}
+
+func (suite *ClientFactorySuite) TestNewTransportDefaults() {
+	transport, err := TransportConfig{}.NewTransport(nil)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(transport)
+
+	suite.Nil(transport.DialContext)
+	suite.Nil(transport.Proxy)
+	suite.Nil(transport.TLSNextProto)
+	suite.Nil(transport.TLSClientConfig)
+}
+
+func (suite *ClientFactorySuite) TestNewTransportDialer() {
+	transport, err := TransportConfig{DialTimeout: time.Second}.NewTransport(nil)
+	suite.Require().NoError(err)
+	suite.NotNil(transport.DialContext)
+}
+
+func (suite *ClientFactorySuite) TestNewTransportDisableHTTP2() {
+	transport, err := TransportConfig{
+		ForceAttemptHTTP2: true,
+		DisableHTTP2:      true,
+	}.NewTransport(nil)
+
+	suite.Require().NoError(err)
+	suite.False(transport.ForceAttemptHTTP2)
+	suite.NotNil(transport.TLSNextProto)
+	suite.Empty(transport.TLSNextProto)
+}
+
+func (suite *ClientFactorySuite) TestNewTransportBadProxyURL() {
+	_, err := TransportConfig{ProxyURL: "http://bad\x7f"}.NewTransport(nil)
+	suite.Error(err)
+}
+
+func (suite *ClientFactorySuite) TestNewTransportProxy() {
+	transport, err := TransportConfig{
+		ProxyURL: "http://proxy.example.com:3128",
+		NoProxy:  []string{"localhost", ".internal.net", "example.org:8080", "10.0.0.0/8", "192.168.1.1", "::1"},
+	}.NewTransport(nil)
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(transport.Proxy)
+
+	testCases := []struct {
+		url     string
+		proxied bool
+	}{
+		{url: "http://localhost:8080/", proxied: false},
+		{url: "http://LOCALHOST/", proxied: false},
+		{url: "http://internal.net/", proxied: false},
+		{url: "http://api.internal.net/", proxied: false},
+		{url: "http://notinternal.net/", proxied: true},
+		{url: "http://www.example.org/", proxied: false},
+		{url: "http://10.1.2.3/", proxied: false},
+		{url: "http://11.1.2.3/", proxied: true},
+		{url: "http://192.168.1.1:9000/", proxied: false},
+		{url: "http://192.168.1.2/", proxied: true},
+		{url: "http://[::1]:8080/", proxied: false},
+		{url: "https://www.google.com/", proxied: true},
+	}
+
+	for _, testCase := range testCases {
+		suite.Run(testCase.url, func() {
+			proxyURL, err := transport.Proxy(httptest.NewRequest("GET", testCase.url, nil))
+			suite.Require().NoError(err)
+			if testCase.proxied {
+				suite.Require().NotNil(proxyURL)
+				suite.Equal("proxy.example.com:3128", proxyURL.Host)
+			} else {
+				suite.Nil(proxyURL)
+			}
+		})
+	}
+}
+
+func (suite *ClientFactorySuite) TestNewTransportNoProxyAll() {
+	transport, err := TransportConfig{
+		ProxyURL: "http://proxy.example.com:3128",
+		NoProxy:  []string{" ", "*"},
+	}.NewTransport(nil)
+
+	suite.Require().NoError(err)
+	proxyURL, err := transport.Proxy(httptest.NewRequest("GET", "http://www.google.com/", nil))
+	suite.NoError(err)
+	suite.Nil(proxyURL)
+}
+
+func (suite *ClientFactorySuite) TestNewClientLifecycle() {
+	cc := ClientConfig{
+		TLS: &arrangetls.Config{
+			Certificates: arrangetls.ExternalCertificates{
+				{
+					CertificateFile: CertificateFile,
+					KeyFile:         KeyFile,
+				},
+			},
+			Reload: &arrangetls.ReloadConfig{Interval: time.Hour},
+		},
+	}
+
+	lifecycle := new(hookLifecycle)
+	client, err := cc.NewClientLifecycle(lifecycle)
+	suite.Require().NoError(err)
+	suite.NotNil(client)
+	suite.Require().Len(lifecycle.hooks, 1)
+	suite.NoError(lifecycle.hooks[0].OnStart(context.Background()))
+	suite.NoError(lifecycle.hooks[0].OnStop(context.Background()))
+
+	client, err = cc.NewClient()
+	suite.Require().NoError(err)
+	suite.NotNil(client)
+}
+
+func TestClientFactory(t *testing.T) {
+	suite.Run(t, new(ClientFactorySuite))
+}
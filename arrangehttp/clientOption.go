@@ -6,11 +6,15 @@ import (
 	"strings"
 
 	"github.com/xmidt-org/arrange/internal/arrangereflect"
+	"github.com/xmidt-org/httpaux/roundtrip"
 	"go.uber.org/multierr"
 )
 
 // InvalidClientOptionTypeError is returned by a ClientOption produced by AsClientOption
 // to indicate that a type could not be converted.
+//
+// Deprecated: AsClientOption will be removed in a future release.  Use AsOption with
+// http.Client instead, which checks types at compile time.
 type InvalidClientOptionTypeError struct {
 	Type reflect.Type
 }
@@ -26,20 +30,34 @@ func (icote *InvalidClientOptionTypeError) Error() string {
 
 // ClientOption is a general-purpose modifier for an *http.Client.  Typically, these
 // will be created as value group within an enclosing *fx.App.
+//
+// Deprecated: ClientOption will be removed in a future release.  Use Option[http.Client]
+// instead.  FromClientOption can be used to convert existing ClientOption instances.
 type ClientOption interface {
 	// ApplyToClient modifies the given client.  This method can return an error to
 	// indicate that the option was incorrectly applied.
 	ApplyToClient(*http.Client) error
 }
 
-// ClientOptionFunc is a function type that implements ClientOption.
+// ClientOptionFunc is a function type that implements ClientOption.  It also
+// implements Option[http.Client].
+//
+// Deprecated: Use OptionFunc[http.Client] instead.
 type ClientOptionFunc func(*http.Client) error
 
 func (cof ClientOptionFunc) ApplyToClient(c *http.Client) error {
 	return cof(c)
 }
 
+// Apply allows this function type to be used as an Option[http.Client].
+func (cof ClientOptionFunc) Apply(c *http.Client) error {
+	return cof(c)
+}
+
 // ClientOptions is an aggregate set of ClientOption that acts as a single option.
+// It also implements Option[http.Client].
+//
+// Deprecated: Use Options[http.Client] instead.
 type ClientOptions []ClientOption
 
 // ApplyToClient invokes each option in order.  Options are always invoked, even when
@@ -53,6 +71,11 @@ func (co ClientOptions) ApplyToClient(c *http.Client) (err error) {
 	return
 }
 
+// Apply allows this aggregate to be used as an Option[http.Client].
+func (co ClientOptions) Apply(c *http.Client) error {
+	return co.ApplyToClient(c)
+}
+
 // AsClientOption converts a value into a ClientOption.  This function never returns nil
 // and does not panic if v cannot be converted.
 //
@@ -64,13 +87,20 @@ func (co ClientOptions) ApplyToClient(c *http.Client) (err error) {
 //
 // Any other kind of value will result in a ClientOption that returns an error indicating
 // that the type cannot be converted.
-func AsClientOption(v any) ClientOption {
+//
+// The result is a ClientOptionFunc, which is also an Option[http.Client], so it can be passed
+// to either form of the client constructors, e.g. ProvideClient or ProvideClientWith.
+//
+// Deprecated: Use AsOption[http.Client] instead, which checks types at compile time.
+func AsClientOption(v any) ClientOptionFunc {
 	type clientOptionNoError interface {
 		ApplyToClient(*http.Client)
 	}
 
-	if co, ok := v.(ClientOption); ok {
-		return co
+	if cof, ok := v.(ClientOptionFunc); ok {
+		return cof
+	} else if co, ok := v.(ClientOption); ok {
+		return co.ApplyToClient
 	} else if co, ok := v.(clientOptionNoError); ok {
 		return ClientOptionFunc(func(c *http.Client) error {
 			co.ApplyToClient(c)
@@ -92,18 +122,35 @@ func AsClientOption(v any) ClientOption {
 	})
 }
 
+// FromClientOption converts a legacy ClientOption into an Option[http.Client].  This function
+// is a migration aid for code that still produces ClientOption instances.
+func FromClientOption(co ClientOption) Option[http.Client] {
+	if o, ok := co.(Option[http.Client]); ok {
+		return o
+	}
+
+	return OptionFunc[http.Client](co.ApplyToClient)
+}
+
 // ClientMiddlewareFunc is the underlying type for round tripper decoration.
 type ClientMiddlewareFunc interface {
 	~func(http.RoundTripper) http.RoundTripper
 }
 
-// ClientMiddleware returns a ClientOption that applies the given middleware
-// to the Transport (http.RoundTripper).
-func ClientMiddleware[M ClientMiddlewareFunc](fns ...M) ClientOption {
-	return AsClientOption(func(c *http.Client) {
-		c.Transport = arrangereflect.Decorate(
-			arrangereflect.Safe[http.RoundTripper](c.Transport, http.DefaultTransport),
-			fns...,
-		)
+// ClientMiddleware returns a client option that applies the given middleware
+// to the Transport (http.RoundTripper).  The CloseIdleConnections behavior of the
+// transport is preserved, so that http.Client.CloseIdleConnections continues to work.
+//
+// The result is both an Option[http.Client] and a legacy ClientOption, so it can be passed
+// to either form of the client constructors.
+func ClientMiddleware[M ClientMiddlewareFunc](fns ...M) ClientOptionFunc {
+	return ClientOptionFunc(func(c *http.Client) error {
+		next := arrangereflect.Safe[http.RoundTripper](c.Transport, http.DefaultTransport)
+		for i := len(fns) - 1; i >= 0; i-- {
+			next = roundtrip.PreserveCloseIdler(next, fns[i](next))
+		}
+
+		c.Transport = next
+		return nil
 	})
 }
@@ -36,7 +36,7 @@ func (suite *ClientOptionSuite) testClientMiddleware(initialTransport http.Round
 		})
 	}
 
-	ClientMiddleware(middleware...).ApplyToClient(c)
+	suite.Require().NoError(ClientMiddleware(middleware...).Apply(c))
 	suite.Require().NotNil(c.Transport)
 
 	response, err := c.Transport.RoundTrip(new(http.Request))
@@ -54,6 +54,110 @@ func (suite *ClientOptionSuite) testClientMiddleware(initialTransport http.Round
 }
 
 func (suite *ClientOptionSuite) TestClientMiddleware() {
+	for _, count := range []int{0, 1, 2, 5} {
+		suite.Run(fmt.Sprintf("count=%d", count), func() {
+			suite.testClientMiddleware(
+				RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+					return &http.Response{Header: make(http.Header)}, nil
+				}),
+				count,
+			)
+		})
+	}
+}
+
+func (suite *ClientOptionSuite) TestClientMiddlewarePreservesCloseIdler() {
+	var (
+		transport = new(mockCloseIdlerTransport)
+		c         = &http.Client{Transport: transport}
+	)
+
+	transport.On("CloseIdleConnections").Once()
+	suite.Require().NoError(
+		ClientMiddleware(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(next.RoundTrip)
+		}).Apply(c),
+	)
+
+	c.CloseIdleConnections()
+	transport.AssertExpectations(suite.T())
+}
+
+func (suite *ClientOptionSuite) TestAsClientOption() {
+	var called int
+	for _, v := range []any{
+		ClientOptionFunc(func(*http.Client) error { called++; return nil }),
+		func(*http.Client) error { called++; return nil },
+		func(*http.Client) { called++ },
+	} {
+		suite.NoError(AsClientOption(v).ApplyToClient(suite.target))
+	}
+
+	suite.Equal(3, called)
+
+	var icote *InvalidClientOptionTypeError
+	suite.ErrorAs(AsClientOption(123).ApplyToClient(suite.target), &icote)
+}
+
+func (suite *ClientOptionSuite) TestFromClientOption() {
+	var called int
+	legacy := []ClientOption{
+		ClientOptionFunc(func(*http.Client) error { called++; return nil }),
+		ClientOptions{
+			AsClientOption(func(*http.Client) { called++ }),
+		},
+		AsClientOption(func(*http.Client) { called++ }),
+	}
+
+	for _, co := range legacy {
+		suite.NoError(FromClientOption(co).Apply(suite.target))
+	}
+
+	suite.Equal(3, called)
+}
+
+// legacyClientOption is a ClientOption implemented the way code written before
+// Option[http.Client] implemented it.
+type legacyClientOption struct {
+	called *int
+}
+
+func (lco legacyClientOption) ApplyToClient(*http.Client) error {
+	*lco.called++
+	return nil
+}
+
+func (suite *ClientOptionSuite) TestLegacyEntryPoints() {
+	var (
+		called     int
+		middleware = ClientMiddleware(func(next http.RoundTripper) http.RoundTripper {
+			called++
+			return next
+		})
+
+		legacy = []ClientOption{legacyClientOption{called: &called}, middleware}
+	)
+
+	// ClientMiddleware is usable with either form of option
+	_ = []Option[http.Client]{middleware}
+
+	c, err := NewClient(ClientConfig{}, legacy...)
+	suite.Require().NoError(err)
+	suite.NotNil(c)
+	suite.Equal(2, called)
+
+	c, err = NewClientCustom(ClientConfig{}, legacy...)
+	suite.Require().NoError(err)
+	suite.NotNil(c)
+	suite.Equal(4, called)
+
+	c, err = ApplyClientOptions(suite.target, legacy...)
+	suite.NoError(err)
+	suite.Same(suite.target, c)
+	suite.Equal(6, called)
+
+	suite.NotNil(ProvideClient("main", legacy...))
+	suite.NotNil(ProvideClientCustom[ClientConfig]("main", legacy...))
 }
 
 func TestClientOption(t *testing.T) {
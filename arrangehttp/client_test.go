@@ -1 +1,217 @@
 package arrangehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type ClientHealthCheckSuite struct {
+	suite.Suite
+}
+
+func (suite *ClientHealthCheckSuite) TestNoURL() {
+	suite.NoError(ClientHealthCheck{}.Check(context.Background(), http.DefaultClient))
+}
+
+func (suite *ClientHealthCheckSuite) TestBadURL() {
+	suite.Error(
+		ClientHealthCheck{URL: "this is not a valid URL\x7f"}.Check(context.Background(), http.DefaultClient),
+	)
+}
+
+func (suite *ClientHealthCheckSuite) TestStatusCode() {
+	for _, testCase := range []struct {
+		status      int
+		expectError bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusNoContent},
+		{status: http.StatusNotFound, expectError: true},
+		{status: http.StatusInternalServerError, expectError: true},
+	} {
+		suite.Run(http.StatusText(testCase.status), func() {
+			server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				suite.Equal(http.MethodGet, request.Method)
+				response.WriteHeader(testCase.status)
+			}))
+
+			defer server.Close()
+			err := ClientHealthCheck{URL: server.URL}.Check(context.Background(), server.Client())
+			if testCase.expectError {
+				var chce *ClientHealthCheckError
+				suite.Require().ErrorAs(err, &chce)
+				suite.Equal(testCase.status, chce.StatusCode)
+				suite.Contains(chce.Error(), server.URL)
+			} else {
+				suite.NoError(err)
+			}
+		})
+	}
+}
+
+func (suite *ClientHealthCheckSuite) TestTimeout() {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-done
+	}))
+
+	defer server.Close()
+	defer close(done)
+
+	err := ClientHealthCheck{URL: server.URL, Timeout: 50 * time.Millisecond}.Check(context.Background(), server.Client())
+	suite.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func (suite *ClientHealthCheckSuite) TestClientConfig() {
+	expected := ClientHealthCheck{URL: "http://localhost/health", Method: http.MethodHead}
+	suite.Equal(expected, ClientConfig{HealthCheck: expected}.NewClientHealthCheck())
+}
+
+func TestClientHealthCheck(t *testing.T) {
+	suite.Run(t, new(ClientHealthCheckSuite))
+}
+
+type ProvideClientSuite struct {
+	suite.Suite
+}
+
+// orderOption returns an option that records its position in the order of application.
+func (suite *ProvideClientSuite) orderOption(order *[]string, name string) Option[http.Client] {
+	return AsOption[http.Client](func(c *http.Client) {
+		suite.Require().NotNil(c)
+		*order = append(*order, name)
+	})
+}
+
+func (suite *ProvideClientSuite) TestNoOptions() {
+	var client *http.Client
+	app := fxtest.New(
+		suite.T(),
+		ProvideClient("main"),
+		fx.Populate(
+			fx.Annotate(
+				&client,
+				arrange.Tags().Name("main").ParamTags(),
+			),
+		),
+	)
+
+	app.RequireStart()
+	app.RequireStop()
+	suite.NotNil(client)
+}
+
+func (suite *ProvideClientSuite) TestExternalOptions() {
+	var (
+		order  []string
+		client *http.Client
+	)
+
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			fx.Annotate(
+				ClientConfig{Timeout: 15 * time.Second},
+				arrange.Tags().Name("main.config").ResultTags(),
+			),
+			fx.Annotate(
+				suite.orderOption(&order, "injected"),
+				arrange.Tags().Group("main.options").ResultTags(),
+				fx.As(new(Option[http.Client])),
+			),
+		),
+		ProvideClientWith(
+			"main",
+			suite.orderOption(&order, "external0"),
+			AsOption[http.Client](func(c *http.Client) {
+				// external options must see the configured client
+				suite.Equal(15*time.Second, c.Timeout)
+				order = append(order, "external1")
+			}),
+		),
+		fx.Populate(
+			fx.Annotate(
+				&client,
+				arrange.Tags().Name("main").ParamTags(),
+			),
+		),
+	)
+
+	app.RequireStart()
+	app.RequireStop()
+	suite.NotNil(client)
+	suite.Equal([]string{"injected", "external0", "external1"}, order)
+}
+
+func (suite *ProvideClientSuite) TestLegacyOptions() {
+	var (
+		order  []string
+		client *http.Client
+	)
+
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			fx.Annotate(
+				suite.orderOption(&order, "injected"),
+				arrange.Tags().Group("main.options").ResultTags(),
+				fx.As(new(Option[http.Client])),
+			),
+			fx.Annotate(
+				AsClientOption(func(*http.Client) { order = append(order, "legacy") }),
+				arrange.Tags().Group("main.options").ResultTags(),
+				fx.As(new(ClientOption)),
+			),
+		),
+		ProvideClient(
+			"main",
+			AsClientOption(func(*http.Client) { order = append(order, "external") }),
+		),
+		fx.Populate(
+			fx.Annotate(
+				&client,
+				arrange.Tags().Name("main").ParamTags(),
+			),
+		),
+	)
+
+	app.RequireStart()
+	app.RequireStop()
+	suite.NotNil(client)
+	suite.Equal([]string{"legacy", "injected", "external"}, order)
+}
+
+func (suite *ProvideClientSuite) TestExternalOptionError() {
+	expectedErr := errors.New("expected")
+	app := fx.New(
+		fx.NopLogger,
+		ProvideClientWith(
+			"main",
+			InvalidOption[http.Client](expectedErr),
+		),
+	)
+
+	suite.ErrorIs(app.Err(), expectedErr)
+}
+
+func (suite *ProvideClientSuite) TestNoName() {
+	app := fx.New(
+		fx.NopLogger,
+		ProvideClient(""),
+	)
+
+	suite.ErrorIs(app.Err(), ErrClientNameRequired)
+}
+
+func TestProvideClient(t *testing.T) {
+	suite.Run(t, new(ProvideClientSuite))
+}
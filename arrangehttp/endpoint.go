@@ -0,0 +1,104 @@
+package arrangehttp
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/xmidt-org/arrange/arrangetls"
+)
+
+// Endpoint is an additional network address on which a server listens.  This allows a single
+// server, with one handler, to be reachable on several addresses at once, e.g. both IPv4 and
+// IPv6, or both a TCP port and a unix socket.
+//
+// Endpoint is a ListenerFactory.  Unlike DefaultListenerFactory, it ignores http.Server.Addr
+// and http.Server.TLSConfig in favor of its own Address and TLS.
+type Endpoint struct {
+	// Network is the tcp or unix network to listen on.  The default is "tcp".
+	Network string `json:"network" yaml:"network"`
+
+	// Address is the bind address of this endpoint.  If unset, the endpoint binds to the
+	// first port available.  For a unix network, this is the path of the socket file.
+	Address string `json:"address" yaml:"address"`
+
+	// UnixSocket configures the permissions and ownership of the socket file
+	// when Network is a unix network.
+	UnixSocket UnixSocket `json:"unixSocket" yaml:"unixSocket"`
+
+	// SocketActivation is the optional name of a socket passed by systemd socket activation.
+	// If set and the process was socket activated, the endpoint uses that socket and ignores
+	// Network and Address.  See SystemdListenerFactory.
+	SocketActivation string `json:"socketActivation" yaml:"socketActivation"`
+
+	// TLS is the optional TLS configuration for this endpoint.  If unset, this endpoint
+	// serves plain HTTP, regardless of the server's TLS configuration.
+	TLS *arrangetls.Config `json:"tls" yaml:"tls"`
+}
+
+// Listen creates the listener for this endpoint.  If TLS is set, the returned
+// listener creates TLS connections.
+func (e Endpoint) Listen(ctx context.Context, server *http.Server) (net.Listener, error) {
+	return e.listen(ctx, server, ListenerChain{}, e.listenNetwork(net.ListenConfig{}))
+}
+
+// listenNetwork returns a ListenerFactory that creates this endpoint's undecorated network
+// listener.  This is the inherited socket named by SocketActivation if the process was socket
+// activated.
+func (e Endpoint) listenNetwork(lc net.ListenConfig) ListenerFactoryFunc {
+	return func(ctx context.Context, _ *http.Server) (net.Listener, error) {
+		if len(e.SocketActivation) > 0 {
+			l, activated, err := SystemdListenerFactory{Name: e.SocketActivation}.inherit()
+			if err != nil || activated {
+				return l, err
+			}
+		}
+
+		return DefaultListenerFactory{
+			ListenConfig: lc,
+			Network:      e.Network,
+			UnixSocket:   e.UnixSocket,
+		}.listenNetwork(ctx, e.Address)
+	}
+}
+
+// listen creates this endpoint's network listener with the given factory, decorates it
+// with a chain, and then applies any TLS configuration.
+//
+// If the TLS certificates are reloadable, they are watched until the returned listener is closed.
+func (e Endpoint) listen(ctx context.Context, server *http.Server, chain ListenerChain, listen ListenerFactoryFunc) (net.Listener, error) {
+	tc, cs, err := e.TLS.NewWithStore(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := listen(ctx, server)
+	if err != nil {
+		return nil, err
+	}
+
+	l = chain.Then(l)
+	if tc != nil {
+		l = tls.NewListener(l, tc)
+	}
+
+	if cs != nil {
+		cs.Start()
+		l = &storeListener{Listener: l, store: cs}
+	}
+
+	return l, nil
+}
+
+// storeListener stops a CertificateStore when the listener that uses it is closed.
+type storeListener struct {
+	net.Listener
+	store *arrangetls.CertificateStore
+}
+
+// Close closes the decorated listener and stops the store.
+func (sl *storeListener) Close() error {
+	sl.store.Stop()
+	return sl.Listener.Close()
+}
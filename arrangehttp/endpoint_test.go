@@ -0,0 +1,168 @@
+package arrangehttp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange/arrangetls"
+)
+
+type EndpointSuite struct {
+	suite.Suite
+}
+
+func (suite *EndpointSuite) tlsConfig() *arrangetls.Config {
+	return &arrangetls.Config{
+		Certificates: arrangetls.ExternalCertificates{
+			{
+				CertificateFile: CertificateFile,
+				KeyFile:         KeyFile,
+			},
+		},
+	}
+}
+
+func (suite *EndpointSuite) TestListen() {
+	// the server's address and TLS configuration are ignored
+	server := &http.Server{
+		Addr:      "invalid address",
+		TLSConfig: new(tls.Config),
+	}
+
+	l, err := Endpoint{Address: "127.0.0.1:0"}.Listen(context.Background(), server)
+	suite.Require().NoError(err)
+	defer l.Close()
+	suite.IsType((*net.TCPListener)(nil), l)
+}
+
+func (suite *EndpointSuite) TestListenTLS() {
+	l, err := Endpoint{
+		Address: "127.0.0.1:0",
+		TLS:     suite.tlsConfig(),
+	}.Listen(context.Background(), new(http.Server))
+
+	suite.Require().NoError(err)
+	defer l.Close()
+	_, isTCP := l.(*net.TCPListener)
+	suite.False(isTCP, "the endpoint's listener should create TLS connections")
+}
+
+func (suite *EndpointSuite) TestListenTLSReload() {
+	tc := suite.tlsConfig()
+	tc.Reload = &arrangetls.ReloadConfig{Interval: time.Hour}
+	l, err := Endpoint{
+		Address: "127.0.0.1:0",
+		TLS:     tc,
+	}.Listen(context.Background(), new(http.Server))
+
+	suite.Require().NoError(err)
+
+	// the certificates are watched until the listener is closed
+	suite.Require().IsType((*storeListener)(nil), l)
+	suite.NoError(l.Close())
+}
+
+func (suite *EndpointSuite) TestListenError() {
+	l, err := Endpoint{
+		Address: "127.0.0.1:0",
+		TLS: &arrangetls.Config{
+			Certificates: arrangetls.ExternalCertificates{
+				{
+					CertificateFile: "no such file",
+					KeyFile:         "no such file",
+				},
+			},
+		},
+	}.Listen(context.Background(), new(http.Server))
+
+	suite.Error(err)
+	suite.Nil(l)
+
+	l, err = Endpoint{Network: "bogus"}.Listen(context.Background(), new(http.Server))
+	suite.Error(err)
+	suite.Nil(l)
+}
+
+func (suite *EndpointSuite) TestNewServerEndpoints() {
+	sc := ServerConfig{
+		Endpoints: []Endpoint{
+			{Address: "127.0.0.1:0"},
+			{Address: "127.0.0.1:0", TLS: suite.tlsConfig()},
+		},
+		ConnectionLimit: &ConnectionLimit{Max: 10},
+	}
+
+	lfs := sc.NewServerEndpoints()
+	suite.Require().Len(lfs, 2)
+	for _, lf := range lfs {
+		l, err := lf.Listen(context.Background(), new(http.Server))
+		suite.Require().NoError(err)
+		l.Close()
+	}
+
+	suite.Empty(ServerConfig{}.NewServerEndpoints())
+}
+
+func (suite *EndpointSuite) TestNewServerEndpointsSharedLimit() {
+	sc := ServerConfig{
+		Address: "127.0.0.1:0",
+		Endpoints: []Endpoint{
+			{Address: "127.0.0.1:0"},
+		},
+		ConnectionLimit: &ConnectionLimit{Max: 1, Reject: true},
+	}
+
+	primary, err := sc.Listen(context.Background(), &http.Server{Addr: sc.Address})
+	suite.Require().NoError(err)
+	defer primary.Close()
+
+	lfs := sc.NewServerEndpoints()
+	suite.Require().Len(lfs, 1)
+	endpoint, err := lfs[0].Listen(context.Background(), new(http.Server))
+	suite.Require().NoError(err)
+	defer endpoint.Close()
+
+	client1, err := net.Dial("tcp", primary.Addr().String())
+	suite.Require().NoError(err)
+	defer client1.Close()
+	server1, err := primary.Accept()
+	suite.Require().NoError(err)
+	defer server1.Close()
+
+	// the endpoint has no free slot while the primary listener's connection is open
+	client2, err := net.Dial("tcp", endpoint.Addr().String())
+	suite.Require().NoError(err)
+	defer client2.Close()
+	go endpoint.Accept() //nolint:errcheck
+
+	suite.Require().NoError(client2.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	_, err = client2.Read(make([]byte, 1))
+	suite.ErrorIs(err, io.EOF)
+	suite.Equal(uint64(1), sc.ConnectionLimit.Counters().Total())
+	suite.Equal(uint64(1), sc.ConnectionLimit.Counters().Rejected())
+}
+
+func (suite *EndpointSuite) TestNewServerEndpointsInvalidChain() {
+	sc := ServerConfig{
+		Endpoints: []Endpoint{
+			{Address: "127.0.0.1:0"},
+		},
+		ConnectionLimit: &ConnectionLimit{},
+	}
+
+	lfs := sc.NewServerEndpoints()
+	suite.Require().Len(lfs, 1)
+	l, err := lfs[0].Listen(context.Background(), new(http.Server))
+	suite.ErrorIs(err, ErrInvalidConnectionLimit)
+	suite.Nil(l)
+}
+
+func TestEndpoint(t *testing.T) {
+	suite.Run(t, new(EndpointSuite))
+}
@@ -0,0 +1,194 @@
+package arrangehttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/multierr"
+)
+
+const (
+	// HandoffEnv is the environment variable that describes the listeners passed to a process
+	// by Handoff.Restart.  Its value is a URL-encoded query string mapping each listener's
+	// name onto its file descriptor, e.g. "main=3&metrics=4".
+	HandoffEnv = "ARRANGE_LISTEN_FDS"
+
+	// handoffFDsStart is the first file descriptor passed to a child process via exec.Cmd.ExtraFiles.
+	handoffFDsStart = 3
+)
+
+var (
+	// ErrNoHandoffListeners indicates that Handoff.Restart was called before any listeners
+	// were created through the Handoff.
+	ErrNoHandoffListeners = errors.New("No listeners are available to hand off")
+
+	// ErrHandoffNotSupported indicates that Handoff.Restart was called on a platform that
+	// cannot pass listeners to another process.
+	ErrHandoffNotSupported = errors.New("Handing off listeners is not supported on this platform")
+)
+
+// filer is implemented by the network listeners that can be passed to another process.
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Handoff supports restarting a process without downtime.  Listeners created through a
+// Handoff's factories are tracked by name, and Restart starts a new copy of the process
+// that inherits them.  In the new process, the same factories adopt the inherited sockets
+// rather than listening again, so connections are never refused.
+//
+// A typical restart, e.g. in response to SIGHUP, calls Restart and then stops the current
+// application.  BindServer's shutdown drains the old process's connections while the new
+// process accepts connections on the same sockets.
+type Handoff struct {
+	lock      sync.Mutex
+	inherited map[string]int
+	listeners map[string]net.Listener
+}
+
+// NewHandoff creates a Handoff with any listeners passed to this process by a parent's
+// Handoff.Restart.  HandoffEnv is removed from the environment, so that the file descriptors
+// it describes are not misinterpreted by processes this process starts.
+func NewHandoff() (*Handoff, error) {
+	h := &Handoff{
+		inherited: make(map[string]int),
+		listeners: make(map[string]net.Listener),
+	}
+
+	value, ok := os.LookupEnv(HandoffEnv)
+	if !ok {
+		return h, nil
+	}
+
+	os.Unsetenv(HandoffEnv)
+	fds, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range fds {
+		fd, err := strconv.Atoi(values[0])
+		if err != nil || fd < handoffFDsStart {
+			return nil, errors.New("Invalid " + HandoffEnv + ": " + strconv.Quote(value))
+		}
+
+		h.inherited[name] = fd
+	}
+
+	return h, nil
+}
+
+// Inherited returns the sorted names of the listeners passed to this process that have
+// not yet been adopted.
+func (h *Handoff) Inherited() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	names := make([]string, 0, len(h.inherited))
+	for name := range h.inherited {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Factory returns a ListenerFactory for the named listener.  If a listener with this name
+// was passed to this process, it is adopted.  Otherwise, the given DefaultListenerFactory
+// creates a new one.  In either case, the factory's ListenerChain and any TLS configuration
+// are applied to the network listener, which is tracked for a subsequent Restart.
+//
+// By convention, the name is the server's name.
+func (h *Handoff) Factory(name string, f DefaultListenerFactory) ListenerFactory {
+	return h.factory(name, f.ListenerChain, func(ctx context.Context, server *http.Server) (net.Listener, error) {
+		return f.listenNetwork(ctx, server.Addr)
+	})
+}
+
+// factory returns a ListenerFactory for the named listener that uses listen to create
+// the network listener when no listener with that name was passed to this process.
+func (h *Handoff) factory(name string, lc ListenerChain, listen ListenerFactoryFunc) ListenerFactory {
+	return ListenerFactoryFunc(func(ctx context.Context, server *http.Server) (net.Listener, error) {
+		l, err := h.listen(ctx, name, listen, server)
+		if err != nil {
+			return nil, err
+		}
+
+		return decorateListener(l, lc, server), nil
+	})
+}
+
+// listen adopts or creates the named network listener and tracks it.  The lock is not held
+// while the listener is created, since that can block, e.g. on a unix socket's stale socket check.
+func (h *Handoff) listen(ctx context.Context, name string, listen ListenerFactoryFunc, server *http.Server) (l net.Listener, err error) {
+	h.lock.Lock()
+	fd, inherited := h.inherited[name]
+	delete(h.inherited, name)
+	h.lock.Unlock()
+
+	if inherited {
+		l, err = adoptListener(fd, name)
+	} else {
+		l, err = listen(ctx, server)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := l.(filer); !ok {
+		l.Close()
+		return nil, errors.New("The listener " + strconv.Quote(name) + " cannot be handed off")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.listeners[name] = l
+	return l, nil
+}
+
+// CloseInherited closes the listeners passed to this process that have not been adopted.
+// Once all of an application's listeners have been created, call this method so that
+// unused sockets, e.g. for an endpoint that was removed, do not stay open.
+func (h *Handoff) CloseInherited() error {
+	return h.closeInherited(func(string) bool { return true })
+}
+
+// closeServerInherited closes the inherited listeners named after a server, as
+// ServerConfig.NewServerHandoff names them, that have not been adopted.
+func (h *Handoff) closeServerInherited(serverName string) error {
+	return h.closeInherited(func(name string) bool {
+		return name == serverName || strings.HasPrefix(name, serverName+".endpoints.")
+	})
+}
+
+// closeInherited closes the inherited listeners that have not been adopted and
+// whose names match a predicate.
+func (h *Handoff) closeInherited(match func(string) bool) (err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for name, fd := range h.inherited {
+		if !match(name) {
+			continue
+		}
+
+		delete(h.inherited, name)
+		f, claimErr := claimInherited(fd, name)
+		if claimErr == nil {
+			claimErr = f.Close()
+		}
+
+		err = multierr.Append(err, claimErr)
+	}
+
+	return
+}
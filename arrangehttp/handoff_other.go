@@ -0,0 +1,11 @@
+//go:build !unix
+
+package arrangehttp
+
+import "os"
+
+// Restart always returns ErrHandoffNotSupported, since listeners can only be passed to
+// another process on unix platforms.
+func (h *Handoff) Restart() (*os.Process, error) {
+	return nil, ErrHandoffNotSupported
+}
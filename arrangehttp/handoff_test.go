@@ -0,0 +1,407 @@
+//go:build unix
+
+package arrangehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+const handoffHelperName = "handoff"
+
+func init() {
+	testHelpers[handoffHelperName] = runHandoffHelper
+}
+
+// runHandoffHelper serves HTTP on the listener named "main" inherited from a parent's
+// Handoff.Restart.  Each response is "new".
+func runHandoffHelper() int {
+	h, err := NewHandoff()
+	if err == nil && len(h.Inherited()) == 0 {
+		err = errors.New("no listeners were inherited")
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			io.WriteString(response, "new") //nolint:errcheck
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	l, err := h.Factory("main", DefaultListenerFactory{}).Listen(context.Background(), server)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	server.Serve(l) //nolint:errcheck
+	return 0
+}
+
+type HandoffSuite struct {
+	suite.Suite
+}
+
+func (suite *HandoffSuite) SetupTest() {
+	suite.T().Setenv(HandoffEnv, "")
+	os.Unsetenv(HandoffEnv)
+}
+
+// inherit creates a listening socket and returns a duplicate of its descriptor, as a parent
+// process would pass it, along with its address.  The original listener is closed, so the
+// socket is only open as long as the duplicate is.
+func (suite *HandoffSuite) inherit() (fd int, address string) {
+	original, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer original.Close()
+
+	f, err := original.(*net.TCPListener).File()
+	suite.Require().NoError(err)
+	defer f.Close()
+
+	fd, err = syscall.Dup(int(f.Fd()))
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { forgetAdopted(fd) })
+	return fd, original.Addr().String()
+}
+
+// assertClosed verifies that nothing is listening on an address.
+func (suite *HandoffSuite) assertClosed(address string) {
+	c, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err == nil {
+		c.Close()
+	}
+
+	suite.ErrorIs(err, syscall.ECONNREFUSED)
+}
+
+// get makes a request on a new connection and returns the response body.
+func (suite *HandoffSuite) get(address string) (string, error) {
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+		Timeout:   5 * time.Second,
+	}
+
+	response, err := client.Get("http://" + address)
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	return string(body), err
+}
+
+func (suite *HandoffSuite) TestNotInherited() {
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+	suite.Empty(h.Inherited())
+
+	cmd, err := h.command()
+	suite.ErrorIs(err, ErrNoHandoffListeners)
+	suite.Nil(cmd)
+
+	l, err := h.Factory("main", DefaultListenerFactory{}).Listen(context.Background(), &http.Server{Addr: "127.0.0.1:0"})
+	suite.Require().NoError(err)
+	defer l.Close()
+	suite.IsType((*net.TCPListener)(nil), l)
+
+	cmd, err = h.command()
+	suite.Require().NoError(err)
+	suite.Require().Len(cmd.ExtraFiles, 1)
+	cmd.ExtraFiles[0].Close()
+	suite.Contains(cmd.Env, HandoffEnv+"=main=3")
+}
+
+func (suite *HandoffSuite) TestInvalidEnv() {
+	for _, value := range []string{"main=bad", "main=1", "%zz"} {
+		suite.T().Setenv(HandoffEnv, value)
+		h, err := NewHandoff()
+		suite.Error(err)
+		suite.Nil(h)
+	}
+}
+
+func (suite *HandoffSuite) TestAdopt() {
+	original, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer original.Close()
+
+	f, err := original.(*net.TCPListener).File()
+	suite.Require().NoError(err)
+
+	// the handoff takes ownership of the descriptor, so it must not belong to an *os.File
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	suite.Require().NoError(err)
+	defer forgetAdopted(fd)
+
+	suite.T().Setenv(HandoffEnv, "main="+strconv.Itoa(fd))
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+	suite.Equal([]string{"main"}, h.Inherited())
+	_, ok := os.LookupEnv(HandoffEnv)
+	suite.False(ok)
+
+	l, err := h.Factory("main", DefaultListenerFactory{}).Listen(context.Background(), &http.Server{})
+	suite.Require().NoError(err)
+	defer l.Close()
+	suite.Equal(original.Addr().String(), l.Addr().String())
+	suite.Empty(h.Inherited())
+}
+
+func (suite *HandoffSuite) TestServerConfig() {
+	original, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer original.Close()
+
+	f, err := original.(*net.TCPListener).File()
+	suite.Require().NoError(err)
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	suite.Require().NoError(err)
+	defer forgetAdopted(fd)
+
+	suite.T().Setenv(HandoffEnv, "main="+strconv.Itoa(fd))
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+
+	lf, endpoints := ServerConfig{
+		Address:         "invalid address",
+		ConnectionLimit: &ConnectionLimit{Max: 10},
+	}.NewServerHandoff(h, "main")
+
+	suite.Empty(endpoints)
+	l, err := lf.Listen(context.Background(), &http.Server{Addr: "invalid address"})
+	suite.Require().NoError(err)
+	defer l.Close()
+	suite.Equal(original.Addr().String(), l.Addr().String())
+	suite.Empty(h.Inherited())
+
+	cmd, err := h.command()
+	suite.Require().NoError(err)
+	suite.Require().Len(cmd.ExtraFiles, 1)
+	cmd.ExtraFiles[0].Close()
+	suite.Contains(cmd.Env, HandoffEnv+"=main=3")
+}
+
+func (suite *HandoffSuite) TestServerConfigEndpoints() {
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+
+	lf, endpoints := ServerConfig{
+		Address: "127.0.0.1:0",
+		Endpoints: []Endpoint{
+			{Address: "127.0.0.1:0"},
+		},
+	}.NewServerHandoff(h, "main")
+
+	suite.Require().Len(endpoints, 1)
+	l, err := lf.Listen(context.Background(), &http.Server{Addr: "127.0.0.1:0"})
+	suite.Require().NoError(err)
+	defer l.Close()
+
+	e, err := endpoints[0].Listen(context.Background(), new(http.Server))
+	suite.Require().NoError(err)
+	defer e.Close()
+
+	cmd, err := h.command()
+	suite.Require().NoError(err)
+	suite.Require().Len(cmd.ExtraFiles, 2)
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+
+	suite.Contains(cmd.Env, HandoffEnv+"=main=3&main.endpoints.0=4")
+}
+
+func (suite *HandoffSuite) TestProvideServer() {
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			h,
+			fx.Annotate(
+				ServerConfig{
+					Address: "127.0.0.1:0",
+				},
+				arrange.Tags().Name("main.config").ResultTags(),
+			),
+		),
+		ProvideServer("main"),
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	cmd, err := h.command()
+	suite.Require().NoError(err)
+	suite.Require().Len(cmd.ExtraFiles, 1)
+	cmd.ExtraFiles[0].Close()
+	suite.Contains(cmd.Env, HandoffEnv+"=main=3")
+}
+
+func (suite *HandoffSuite) TestListenUnlocked() {
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+
+	var (
+		listening = make(chan struct{})
+		proceed   = make(chan struct{})
+		result    = make(chan error, 1)
+	)
+
+	go func() {
+		_, err := h.factory("main", ListenerChain{}, func(context.Context, *http.Server) (net.Listener, error) {
+			close(listening)
+			<-proceed
+			return nil, errors.New("expected")
+		}).Listen(context.Background(), new(http.Server))
+
+		result <- err
+	}()
+
+	<-listening
+	names := make(chan []string, 1)
+	go func() { names <- h.Inherited() }()
+
+	// the Handoff is usable while another listener is being created
+	select {
+	case n := <-names:
+		suite.Empty(n)
+	case <-time.After(5 * time.Second):
+		suite.Fail("the Handoff was locked while a listener was created")
+	}
+
+	close(proceed)
+	suite.Error(<-result)
+}
+
+func (suite *HandoffSuite) TestCloseInherited() {
+	fd, address := suite.inherit()
+	suite.T().Setenv(HandoffEnv, "removed="+strconv.Itoa(fd))
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+	suite.Equal([]string{"removed"}, h.Inherited())
+
+	suite.NoError(h.CloseInherited())
+	suite.Empty(h.Inherited())
+	suite.assertClosed(address)
+}
+
+func (suite *HandoffSuite) TestProvideServerClosesInherited() {
+	var (
+		mainFD, mainAddress         = suite.inherit()
+		endpointFD, endpointAddress = suite.inherit()
+		otherFD, otherAddress       = suite.inherit()
+	)
+
+	suite.T().Setenv(HandoffEnv, fmt.Sprintf("main=%d&main.endpoints.0=%d&other=%d", mainFD, endpointFD, otherFD))
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+
+	// the configuration no longer has any endpoints
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			h,
+			fx.Annotate(
+				ServerConfig{
+					Address: "127.0.0.1:0",
+				},
+				arrange.Tags().Name("main.config").ResultTags(),
+			),
+		),
+		ProvideServer("main"),
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	// the server adopted its listener and closed its unused endpoint, but not other servers' sockets
+	suite.Equal([]string{"other"}, h.Inherited())
+	_, err = suite.get(mainAddress)
+	suite.NoError(err)
+	suite.assertClosed(endpointAddress)
+
+	c, err := net.Dial("tcp", otherAddress)
+	suite.Require().NoError(err)
+	c.Close()
+	suite.NoError(h.CloseInherited())
+}
+
+func (suite *HandoffSuite) TestRestart() {
+	h, err := NewHandoff()
+	suite.Require().NoError(err)
+
+	server := &http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			io.WriteString(response, "old") //nolint:errcheck
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	l, err := h.Factory("main", DefaultListenerFactory{}).Listen(context.Background(), server)
+	suite.Require().NoError(err)
+	address := l.Addr().String()
+	go server.Serve(l) //nolint:errcheck
+	defer server.Close()
+
+	body, err := suite.get(address)
+	suite.Require().NoError(err)
+	suite.Equal("old", body)
+
+	suite.T().Setenv(testHelperEnv, handoffHelperName)
+	process, err := h.Restart()
+	suite.Require().NoError(err)
+	defer func() {
+		process.Kill() //nolint:errcheck
+		process.Wait() //nolint:errcheck
+	}()
+
+	// both processes accept connections until the new one has been seen
+	suite.Eventually(
+		func() bool {
+			body, err := suite.get(address)
+			return err == nil && body == "new"
+		},
+		10*time.Second,
+		10*time.Millisecond,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	suite.Require().NoError(server.Shutdown(ctx))
+
+	for i := 0; i < 10; i++ {
+		body, err := suite.get(address)
+		suite.Require().NoError(err)
+		suite.Equal("new", body)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	suite.Run(t, new(HandoffSuite))
+}
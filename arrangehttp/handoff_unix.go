@@ -0,0 +1,108 @@
+//go:build unix
+
+package arrangehttp
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// command creates the command that restarts this process, passing it the listeners created
+// through this Handoff.  The command runs the current executable with the current arguments,
+// environment, and standard streams.
+func (h *Handoff) command() (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.listeners) == 0 {
+		return nil, ErrNoHandoffListeners
+	}
+
+	names := make([]string, 0, len(h.listeners))
+	for name := range h.listeners {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	var (
+		fds   = make(url.Values, len(names))
+		files = make([]*os.File, 0, len(names))
+	)
+
+	for _, name := range names {
+		f, err := h.listeners[name].(filer).File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+
+			return nil, err
+		}
+
+		fds.Set(name, strconv.Itoa(handoffFDsStart+len(files)))
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...) //nolint:gosec
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, HandoffEnv+"=") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+
+	cmd.Env = append(cmd.Env, HandoffEnv+"="+fds.Encode())
+	cmd.ExtraFiles = files
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// Restart starts a new copy of this process that inherits the listeners created through this
+// Handoff.  This process continues to accept connections until its listeners are closed, which
+// leaves the sockets open in the new process.  In particular, unix socket files are not removed
+// when this process's listeners close.
+func (h *Handoff) Restart() (*os.Process, error) {
+	cmd, err := h.command()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, l := range h.listeners {
+		// starting the command puts the shared sockets into blocking mode, which
+		// would prevent this process's listeners from closing
+		if sc, ok := l.(syscall.Conn); ok {
+			if rc, rcErr := sc.SyscallConn(); rcErr == nil {
+				rc.Control(func(fd uintptr) { syscall.SetNonblock(int(fd), true) }) //nolint:errcheck
+			}
+		}
+
+		if ul, ok := l.(*net.UnixListener); ok && err == nil {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
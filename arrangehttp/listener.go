@@ -16,12 +16,12 @@ import (
 // with that configuration.
 //
 // The returned net.Listener may be decorated arbitrarily.  Callers cannot
-// assume the actual type will be *net.TCPListener, although that will always
-// be the ultimate listener that accepts connections.
+// assume the actual type will be *net.TCPListener.  The ultimate listener that
+// accepts connections may also be a *net.UnixListener or an inherited listener.
 //
 // The built-in implementation of this type is DefaultListenerFactory.
 type ListenerFactory interface {
-	// Listen creates the appropriate net.Listener, binding to a TCP address in
+	// Listen creates the appropriate net.Listener, binding to an address in
 	// the process
 	Listen(context.Context, *http.Server) (net.Listener, error)
 }
@@ -121,9 +121,18 @@ type DefaultListenerFactory struct {
 	// ListenConfig is the object used to create the net.Listener
 	ListenConfig net.ListenConfig
 
-	// Network is the network to listen on, which must always be a TCP network.
-	// If not set, "tcp" is used.
+	// Network is the network to listen on, which must be either a TCP network or
+	// a unix network.  If not set, "tcp" is used.  For a unix network, http.Server.Addr
+	// is the path of the socket file.
 	Network string
+
+	// UnixSocket configures the socket file when Network is a unix network.
+	UnixSocket UnixSocket
+
+	// ListenerChain is the optional set of decorators applied to the network listener
+	// before any TLS listener.  Decorators that must see the raw connections, such as
+	// connection limits, belong here rather than in a chain applied to this factory.
+	ListenerChain ListenerChain
 }
 
 // Listen provides the default ListenerFactory behavior for this package.
@@ -131,19 +140,50 @@ type DefaultListenerFactory struct {
 // to be configured externally and ensures that the listen address matches
 // the server address.
 func (f DefaultListenerFactory) Listen(ctx context.Context, server *http.Server) (net.Listener, error) {
+	l, err := f.listenNetwork(ctx, server.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return decorateListener(l, f.ListenerChain, server), nil
+}
+
+// listenNetwork creates the undecorated network listener on the given address.
+func (f DefaultListenerFactory) listenNetwork(ctx context.Context, address string) (net.Listener, error) {
 	network := f.Network
 	if len(network) == 0 {
 		network = "tcp"
 	}
 
-	l, err := f.ListenConfig.Listen(ctx, network, server.Addr)
+	unix := isUnixNetwork(network)
+	if unix {
+		if err := f.UnixSocket.removeStale(network, address); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := f.ListenConfig.Listen(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
 
+	if unix {
+		if err := f.UnixSocket.apply(address); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// decorateListener applies a chain to a network listener, followed by TLS if the
+// server has a TLS configuration.
+func decorateListener(l net.Listener, lc ListenerChain, server *http.Server) net.Listener {
+	l = lc.Then(l)
 	if server.TLSConfig != nil {
 		l = tls.NewListener(l, server.TLSConfig)
 	}
 
-	return l, nil
+	return l
 }
@@ -0,0 +1,401 @@
+package arrangehttp
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrInvalidConnectionLimit indicates that a ConnectionLimit has a nonpositive Max.
+	ErrInvalidConnectionLimit = errors.New("The maximum number of connections must be positive")
+
+	// ErrInvalidAcceptRate indicates that an AcceptRateLimit has a nonpositive Rate.
+	ErrInvalidAcceptRate = errors.New("The accept rate must be positive")
+)
+
+const (
+	// acceptRateSweepInterval is how often idle per-address state is discarded by
+	// the listener that LimitAcceptRate creates.
+	acceptRateSweepInterval = time.Minute
+)
+
+// ListenerCounters tracks the connections that pass through a limiting listener.
+// The zero value is ready to use, and all methods are safe for concurrent use.
+type ListenerCounters struct {
+	active   atomic.Int64
+	rejected atomic.Uint64
+	total    atomic.Uint64
+}
+
+// Active returns the number of accepted connections that have not yet been closed.
+func (lc *ListenerCounters) Active() int64 {
+	return lc.active.Load()
+}
+
+// Rejected returns the number of connections that were closed immediately after being
+// accepted because they exceeded a limit.
+func (lc *ListenerCounters) Rejected() uint64 {
+	return lc.rejected.Load()
+}
+
+// Total returns the number of connections that have been accepted and handed to the server.
+// Rejected connections are not included.
+func (lc *ListenerCounters) Total() uint64 {
+	return lc.total.Load()
+}
+
+// countedConn is a net.Conn that updates counters, and runs an optional release
+// function, exactly once when closed.
+type countedConn struct {
+	net.Conn
+	counters  *ListenerCounters
+	release   func()
+	closeOnce sync.Once
+}
+
+func newCountedConn(c net.Conn, counters *ListenerCounters, release func()) net.Conn {
+	counters.total.Add(1)
+	counters.active.Add(1)
+	return &countedConn{
+		Conn:     c,
+		counters: counters,
+		release:  release,
+	}
+}
+
+// Close closes the underlying connection and updates the counters.
+func (cc *countedConn) Close() error {
+	err := cc.Conn.Close()
+	cc.closeOnce.Do(func() {
+		cc.counters.active.Add(-1)
+		if cc.release != nil {
+			cc.release()
+		}
+	})
+
+	return err
+}
+
+// reject closes a connection that exceeded a limit.
+func reject(c net.Conn, counters *ListenerCounters) {
+	counters.rejected.Add(1)
+	c.Close()
+}
+
+// connectionLimitListener enforces a maximum number of concurrent connections.
+type connectionLimitListener struct {
+	net.Listener
+	counters  *ListenerCounters
+	slots     chan struct{}
+	reject    bool
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (cll *connectionLimitListener) release() {
+	<-cll.slots
+}
+
+// Accept waits for a free slot before accepting a connection or, if rejecting,
+// closes any connection accepted while no slot is free.
+func (cll *connectionLimitListener) Accept() (net.Conn, error) {
+	var (
+		limited  = cll.slots != nil
+		blocking = limited && !cll.reject
+		release  func()
+	)
+
+	if limited {
+		release = cll.release
+	}
+
+	for {
+		if blocking {
+			select {
+			case cll.slots <- struct{}{}:
+			case <-cll.closed:
+				return nil, net.ErrClosed
+			}
+		}
+
+		c, err := cll.Listener.Accept()
+		if err != nil {
+			if blocking {
+				cll.release()
+			}
+
+			return nil, err
+		}
+
+		if limited && !blocking {
+			select {
+			case cll.slots <- struct{}{}:
+			default:
+				reject(c, cll.counters)
+				continue
+			}
+		}
+
+		return newCountedConn(c, cll.counters, release), nil
+	}
+}
+
+// Close closes the underlying listener and unblocks any Accept waiting for a slot.
+func (cll *connectionLimitListener) Close() error {
+	cll.closeOnce.Do(func() {
+		close(cll.closed)
+	})
+
+	return cll.Listener.Close()
+}
+
+// LimitConnections returns a ListenerConstructor that allows at most max concurrent connections.
+// A connection's slot is freed when it is closed.  When no slot is free, Accept blocks until one is.
+// If reject is set, Accept instead continues to accept connections, closing each one immediately
+// until a slot is free.
+//
+// All listeners created by the returned constructor share the same max connections, so a server
+// with several listeners can use one constructor to limit its connections as a whole.
+//
+// The counters, which may be nil, are updated as connections are accepted, rejected, and closed.
+// If max is nonpositive, the returned constructor only counts connections.
+func LimitConnections(max int, reject bool, counters *ListenerCounters) ListenerConstructor {
+	if counters == nil {
+		counters = new(ListenerCounters)
+	}
+
+	var slots chan struct{}
+	if max > 0 {
+		slots = make(chan struct{}, max)
+	}
+
+	return func(next net.Listener) net.Listener {
+		return &connectionLimitListener{
+			Listener: next,
+			counters: counters,
+			slots:    slots,
+			reject:   reject,
+			closed:   make(chan struct{}),
+		}
+	}
+}
+
+// tokenBucket is the rate limiting state for a single source address.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// acceptRateLimiter holds the per-address rate limiting state shared by the listeners
+// that a LimitAcceptRate constructor creates.
+type acceptRateLimiter struct {
+	counters *ListenerCounters
+	rate     float64
+	burst    float64
+	now      func() time.Time
+
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// acceptRateListener limits the rate at which connections are accepted from each source address.
+type acceptRateListener struct {
+	net.Listener
+	*acceptRateLimiter
+}
+
+// sourceAddress returns the IP address of a connection's peer.
+func sourceAddress(c net.Conn) string {
+	addr := c.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
+// allow takes a token from the source's bucket, if one is available.
+func (arl *acceptRateLimiter) allow(source string) bool {
+	arl.lock.Lock()
+	defer arl.lock.Unlock()
+
+	now := arl.now()
+	if now.Sub(arl.lastSweep) >= acceptRateSweepInterval {
+		arl.sweep(now)
+	}
+
+	b, ok := arl.buckets[source]
+	if !ok {
+		b = &tokenBucket{tokens: arl.burst, last: now}
+		arl.buckets[source] = b
+	} else {
+		b.tokens = math.Min(arl.burst, b.tokens+now.Sub(b.last).Seconds()*arl.rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// sweep discards the buckets that would have refilled completely, since they are
+// equivalent to new buckets.
+func (arl *acceptRateLimiter) sweep(now time.Time) {
+	for source, b := range arl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*arl.rate >= arl.burst {
+			delete(arl.buckets, source)
+		}
+	}
+
+	arl.lastSweep = now
+}
+
+// Accept returns the next connection whose source address is within its rate.  Other
+// connections are closed immediately.
+func (arl *acceptRateListener) Accept() (net.Conn, error) {
+	for {
+		c, err := arl.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if !arl.allow(sourceAddress(c)) {
+			reject(c, arl.counters)
+			continue
+		}
+
+		return newCountedConn(c, arl.counters, nil), nil
+	}
+}
+
+// LimitAcceptRate returns a ListenerConstructor that limits how quickly connections are accepted
+// from each source IP address.  Each address may open rate connections per second on average, with
+// bursts of up to burst connections.  A connection over the limit is closed immediately.  If burst
+// is less than one, it defaults to rate rounded up, or one if that is larger.
+//
+// All listeners created by the returned constructor share the same per-address limits, so an
+// address cannot exceed its rate by connecting to each of a server's listeners.
+//
+// The counters, which may be nil, are updated as connections are accepted, rejected, and closed.
+func LimitAcceptRate(rate float64, burst int, counters *ListenerCounters) ListenerConstructor {
+	if counters == nil {
+		counters = new(ListenerCounters)
+	}
+
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+
+	limiter := &acceptRateLimiter{
+		counters: counters,
+		rate:     rate,
+		burst:    float64(burst),
+		now:      time.Now,
+		buckets:  make(map[string]*tokenBucket),
+	}
+
+	return func(next net.Listener) net.Listener {
+		return &acceptRateListener{
+			Listener:          next,
+			acceptRateLimiter: limiter,
+		}
+	}
+}
+
+// ConnectionLimit is the unmarshaled configuration for LimitConnections.  Every listener created
+// through the same instance shares its Max and its counters, which are available through the Counters
+// method.  An instance should not be copied or modified after use.
+type ConnectionLimit struct {
+	// Max is the maximum number of concurrent connections.
+	Max int `json:"max" yaml:"max"`
+
+	// Reject indicates that connections over Max are closed immediately.  If unset,
+	// the server stops accepting connections until the count drops below Max.
+	Reject bool `json:"reject" yaml:"reject"`
+
+	counters    ListenerCounters
+	once        sync.Once
+	constructor ListenerConstructor
+}
+
+// Counters returns the counters updated by the listeners this configuration creates.
+func (cl *ConnectionLimit) Counters() *ListenerCounters {
+	return &cl.counters
+}
+
+// NewListenerConstructor creates the ListenerConstructor described by this configuration.
+// If this instance is nil, this method returns nil.  If Max is not positive,
+// ErrInvalidConnectionLimit is returned.
+//
+// Each call returns the same constructor, so that all of a server's listeners share the limit.
+func (cl *ConnectionLimit) NewListenerConstructor() (ListenerConstructor, error) {
+	switch {
+	case cl == nil:
+		return nil, nil
+
+	case cl.Max <= 0:
+		return nil, ErrInvalidConnectionLimit
+
+	default:
+		cl.once.Do(func() {
+			cl.constructor = LimitConnections(cl.Max, cl.Reject, &cl.counters)
+		})
+
+		return cl.constructor, nil
+	}
+}
+
+// AcceptRateLimit is the unmarshaled configuration for LimitAcceptRate.  Every listener created
+// through the same instance shares its per-address limits and its counters, which are available
+// through the Counters method.  An instance should not be copied or modified after use.
+type AcceptRateLimit struct {
+	// Rate is the average number of connections per second allowed from each source IP address.
+	Rate float64 `json:"rate" yaml:"rate"`
+
+	// Burst is the maximum number of connections that a source IP address may open at once.
+	Burst int `json:"burst" yaml:"burst"`
+
+	counters    ListenerCounters
+	once        sync.Once
+	constructor ListenerConstructor
+}
+
+// Counters returns the counters updated by the listeners this configuration creates.
+func (arl *AcceptRateLimit) Counters() *ListenerCounters {
+	return &arl.counters
+}
+
+// NewListenerConstructor creates the ListenerConstructor described by this configuration.
+// If this instance is nil, this method returns nil.  If Rate is not positive, ErrInvalidAcceptRate
+// is returned.
+//
+// Each call returns the same constructor, so that all of a server's listeners share the limits.
+func (arl *AcceptRateLimit) NewListenerConstructor() (ListenerConstructor, error) {
+	switch {
+	case arl == nil:
+		return nil, nil
+
+	case arl.Rate <= 0:
+		return nil, ErrInvalidAcceptRate
+
+	default:
+		arl.once.Do(func() {
+			arl.constructor = LimitAcceptRate(arl.Rate, arl.Burst, &arl.counters)
+		})
+
+		return arl.constructor, nil
+	}
+}
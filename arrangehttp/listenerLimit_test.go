@@ -0,0 +1,342 @@
+package arrangehttp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ListenerLimitSuite struct {
+	suite.Suite
+}
+
+// listen creates a loopback TCP listener decorated with the given constructor.
+func (suite *ListenerLimitSuite) listen(lc ListenerConstructor) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	return lc(l)
+}
+
+func (suite *ListenerLimitSuite) dial(l net.Listener) net.Conn {
+	c, err := net.Dial("tcp", l.Addr().String())
+	suite.Require().NoError(err)
+	return c
+}
+
+// accept runs Accept in a separate goroutine.
+func (suite *ListenerLimitSuite) accept(l net.Listener) <-chan net.Conn {
+	ch := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			ch <- c
+		}
+
+		close(ch)
+	}()
+
+	return ch
+}
+
+// assertClosedByServer verifies that the server side closed a client connection.
+func (suite *ListenerLimitSuite) assertClosedByServer(c net.Conn) {
+	suite.Require().NoError(c.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	_, err := c.Read(make([]byte, 1))
+	suite.ErrorIs(err, io.EOF)
+}
+
+func (suite *ListenerLimitSuite) TestLimitConnectionsBlocking() {
+	var counters ListenerCounters
+	l := suite.listen(LimitConnections(1, false, &counters))
+	defer l.Close()
+
+	client1 := suite.dial(l)
+	defer client1.Close()
+	server1 := <-suite.accept(l)
+	suite.Require().NotNil(server1)
+
+	client2 := suite.dial(l)
+	defer client2.Close()
+	accepted := suite.accept(l)
+
+	select {
+	case <-accepted:
+		suite.Fail("Accept should block while no slot is free")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	suite.Equal(int64(1), counters.Active())
+	suite.NoError(server1.Close())
+	server1.Close() // counters are only updated once
+
+	select {
+	case server2 := <-accepted:
+		suite.Require().NotNil(server2)
+		server2.Close()
+	case <-time.After(5 * time.Second):
+		suite.Fail("Accept did not unblock")
+	}
+
+	suite.Equal(uint64(2), counters.Total())
+	suite.Zero(counters.Rejected())
+	suite.Zero(counters.Active())
+}
+
+func (suite *ListenerLimitSuite) TestLimitConnectionsClose() {
+	l := suite.listen(LimitConnections(1, false, nil))
+
+	client := suite.dial(l)
+	defer client.Close()
+	server := <-suite.accept(l)
+	suite.Require().NotNil(server)
+	defer server.Close()
+
+	accepted := suite.accept(l)
+	suite.NoError(l.Close())
+
+	select {
+	case c := <-accepted:
+		suite.Nil(c)
+	case <-time.After(5 * time.Second):
+		suite.Fail("Close did not unblock Accept")
+	}
+}
+
+func (suite *ListenerLimitSuite) TestLimitConnectionsReject() {
+	var counters ListenerCounters
+	l := suite.listen(LimitConnections(1, true, &counters))
+	defer l.Close()
+
+	client1 := suite.dial(l)
+	defer client1.Close()
+	server1 := <-suite.accept(l)
+	suite.Require().NotNil(server1)
+
+	accepted := suite.accept(l)
+	client2 := suite.dial(l)
+	defer client2.Close()
+	suite.assertClosedByServer(client2)
+	suite.Equal(uint64(1), counters.Rejected())
+
+	server1.Close()
+	client3 := suite.dial(l)
+	defer client3.Close()
+
+	select {
+	case server3 := <-accepted:
+		suite.Require().NotNil(server3)
+		server3.Close()
+	case <-time.After(5 * time.Second):
+		suite.Fail("Accept did not return a connection")
+	}
+
+	suite.Equal(uint64(2), counters.Total())
+	suite.Equal(uint64(1), counters.Rejected())
+}
+
+func (suite *ListenerLimitSuite) TestLimitConnectionsShared() {
+	var (
+		counters ListenerCounters
+		lc       = LimitConnections(1, true, &counters)
+		l1       = suite.listen(lc)
+		l2       = suite.listen(lc)
+	)
+
+	defer l1.Close()
+	defer l2.Close()
+
+	client1 := suite.dial(l1)
+	defer client1.Close()
+	server1 := <-suite.accept(l1)
+	suite.Require().NotNil(server1)
+	defer server1.Close()
+
+	// the second listener has no free slot, since both share the same max
+	accepted := suite.accept(l2)
+	client2 := suite.dial(l2)
+	defer client2.Close()
+	suite.assertClosedByServer(client2)
+	suite.Equal(uint64(1), counters.Rejected())
+
+	l2.Close()
+	<-accepted
+	suite.Equal(uint64(1), counters.Total())
+}
+
+func (suite *ListenerLimitSuite) TestLimitConnectionsUnlimited() {
+	var counters ListenerCounters
+	l := suite.listen(LimitConnections(0, false, &counters))
+	defer l.Close()
+
+	for i := 0; i < 3; i++ {
+		c := suite.dial(l)
+		defer c.Close()
+		s := <-suite.accept(l)
+		suite.Require().NotNil(s)
+		defer s.Close()
+	}
+
+	suite.Equal(int64(3), counters.Active())
+	suite.Equal(uint64(3), counters.Total())
+}
+
+func (suite *ListenerLimitSuite) TestLimitAcceptRate() {
+	var (
+		counters ListenerCounters
+		now      atomic.Int64
+		l        = suite.listen(LimitAcceptRate(1, 2, &counters))
+	)
+
+	defer l.Close()
+	now.Store(time.Now().UnixNano())
+	l.(*acceptRateListener).now = func() time.Time { return time.Unix(0, now.Load()) }
+
+	for i := 0; i < 2; i++ {
+		c := suite.dial(l)
+		defer c.Close()
+		s := <-suite.accept(l)
+		suite.Require().NotNil(s)
+		defer s.Close()
+	}
+
+	accepted := suite.accept(l)
+	client := suite.dial(l)
+	defer client.Close()
+	suite.assertClosedByServer(client)
+	suite.Equal(uint64(1), counters.Rejected())
+
+	// time passes, enough for one more token
+	now.Add(int64(time.Second))
+	client = suite.dial(l)
+	defer client.Close()
+
+	select {
+	case s := <-accepted:
+		suite.Require().NotNil(s)
+		s.Close()
+	case <-time.After(5 * time.Second):
+		suite.Fail("Accept did not return a connection")
+	}
+
+	suite.Equal(uint64(3), counters.Total())
+	suite.Equal(int64(2), counters.Active())
+}
+
+func (suite *ListenerLimitSuite) TestAcceptRateSweep() {
+	now := time.Now()
+	arl := LimitAcceptRate(10, 0, nil)(nil).(*acceptRateListener)
+	arl.now = func() time.Time { return now }
+	suite.Equal(float64(10), arl.burst)
+
+	suite.True(arl.allow("192.0.2.1"))
+	suite.True(arl.allow("192.0.2.2"))
+	suite.Len(arl.buckets, 2)
+
+	now = now.Add(acceptRateSweepInterval)
+	suite.True(arl.allow("192.0.2.3"))
+	suite.Len(arl.buckets, 1)
+
+	arl = LimitAcceptRate(0.5, 0, nil)(nil).(*acceptRateListener)
+	suite.Equal(float64(1), arl.burst)
+}
+
+func (suite *ListenerLimitSuite) TestLimitAcceptRateShared() {
+	var (
+		lc = LimitAcceptRate(1, 1, nil)
+		l1 = lc(nil).(*acceptRateListener)
+		l2 = lc(nil).(*acceptRateListener)
+	)
+
+	suite.Same(l1.acceptRateLimiter, l2.acceptRateLimiter)
+	suite.True(l1.allow("192.0.2.1"))
+	suite.False(l2.allow("192.0.2.1"))
+	suite.True(l2.allow("192.0.2.2"))
+}
+
+func (suite *ListenerLimitSuite) TestConfig() {
+	var (
+		nilLimit *ConnectionLimit
+		nilRate  *AcceptRateLimit
+	)
+
+	lc, err := nilLimit.NewListenerConstructor()
+	suite.NoError(err)
+	suite.Nil(lc)
+
+	lc, err = nilRate.NewListenerConstructor()
+	suite.NoError(err)
+	suite.Nil(lc)
+
+	_, err = (&ConnectionLimit{}).NewListenerConstructor()
+	suite.ErrorIs(err, ErrInvalidConnectionLimit)
+
+	_, err = (&AcceptRateLimit{}).NewListenerConstructor()
+	suite.ErrorIs(err, ErrInvalidAcceptRate)
+
+	// every listener created through a configuration shares its limits
+	var (
+		cl  = &ConnectionLimit{Max: 1, Reject: true}
+		arl = &AcceptRateLimit{Rate: 1}
+	)
+
+	lc1, err := cl.NewListenerConstructor()
+	suite.Require().NoError(err)
+	lc2, err := cl.NewListenerConstructor()
+	suite.Require().NoError(err)
+	suite.Same(lc1(nil).(*connectionLimitListener).counters, lc2(nil).(*connectionLimitListener).counters)
+	suite.Equal(lc1(nil).(*connectionLimitListener).slots, lc2(nil).(*connectionLimitListener).slots)
+
+	lc1, err = arl.NewListenerConstructor()
+	suite.Require().NoError(err)
+	lc2, err = arl.NewListenerConstructor()
+	suite.Require().NoError(err)
+	suite.Same(lc1(nil).(*acceptRateListener).acceptRateLimiter, lc2(nil).(*acceptRateListener).acceptRateLimiter)
+}
+
+func (suite *ListenerLimitSuite) TestServerConfig() {
+	sc := ServerConfig{
+		Address:         "127.0.0.1:0",
+		ConnectionLimit: &ConnectionLimit{Max: 10},
+		AcceptRate:      &AcceptRateLimit{Rate: 100},
+	}
+
+	server, err := sc.NewServer()
+	suite.Require().NoError(err)
+	server.Handler = http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(299)
+	})
+
+	l, err := sc.Listen(context.Background(), server)
+	suite.Require().NoError(err)
+	go server.Serve(l) //nolint:errcheck
+	defer server.Close()
+
+	response, err := http.Get("http://" + l.Addr().String())
+	suite.Require().NoError(err)
+	response.Body.Close()
+	suite.Equal(299, response.StatusCode)
+
+	suite.Equal(uint64(1), sc.ConnectionLimit.Counters().Total())
+	suite.Equal(uint64(1), sc.AcceptRate.Counters().Total())
+}
+
+func (suite *ListenerLimitSuite) TestServerConfigError() {
+	for _, sc := range []ServerConfig{
+		{Address: "127.0.0.1:0", ConnectionLimit: &ConnectionLimit{Max: -1}},
+		{Address: "127.0.0.1:0", AcceptRate: &AcceptRateLimit{Rate: -1}},
+	} {
+		l, err := sc.Listen(context.Background(), &http.Server{Addr: sc.Address})
+		suite.Error(err)
+		suite.Nil(l)
+	}
+}
+
+func TestListenerLimit(t *testing.T) {
+	suite.Run(t, new(ListenerLimitSuite))
+}
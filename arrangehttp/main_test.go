@@ -11,9 +11,18 @@ import (
 	"github.com/xmidt-org/arrange/arrangetls"
 )
 
+const (
+	// testHelperEnv is the environment variable that tells the test binary to run as a
+	// helper process rather than running tests.  Its value is a key in testHelpers.
+	testHelperEnv = "ARRANGEHTTP_TEST_HELPER"
+)
+
 var (
 	CertificateFile string
 	KeyFile         string
+
+	// testHelpers are the functions a test binary can run as a child process, keyed by name.
+	testHelpers = map[string]func() int{}
 )
 
 func removeFile(name string) {
@@ -24,6 +33,10 @@ func removeFile(name string) {
 }
 
 func TestMain(m *testing.M) {
+	if name := os.Getenv(testHelperEnv); len(name) > 0 {
+		os.Exit(testHelpers[name]())
+	}
+
 	certificate, err := arrangetls.CreateTestCertificate(&x509.Certificate{
 		SerialNumber: big.NewInt(837492837),
 		Issuer: pkix.Name{
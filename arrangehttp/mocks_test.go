@@ -2,6 +2,7 @@ package arrangehttp
 
 import (
 	"github.com/stretchr/testify/mock"
+	"go.uber.org/fx"
 )
 
 type mockOption[T any] struct {
@@ -28,3 +29,25 @@ func (m *mockOptionNoError[T]) Apply(t *T) {
 func (m *mockOptionNoError[T]) ExpectApply(t *T) *mock.Call {
 	return m.On("Apply", t)
 }
+
+type mockShutdowner struct {
+	mock.Mock
+}
+
+func (m *mockShutdowner) Shutdown(opts ...fx.ShutdownOption) error {
+	args := m.Called(opts)
+	return args.Error(0)
+}
+
+func (m *mockShutdowner) ExpectShutdown() *mock.Call {
+	return m.On("Shutdown", mock.Anything)
+}
+
+// hookLifecycle is an fx.Lifecycle that records the hooks appended to it.
+type hookLifecycle struct {
+	hooks []fx.Hook
+}
+
+func (hl *hookLifecycle) Append(h fx.Hook) {
+	hl.hooks = append(hl.hooks, h)
+}
@@ -0,0 +1,78 @@
+package arrangehttp
+
+import (
+	"net"
+	"strings"
+)
+
+// noProxy is a preprocessed list of hosts that bypass a proxy.
+type noProxy struct {
+	all      bool
+	ips      []net.IP
+	networks []*net.IPNet
+	domains  []string
+}
+
+// newNoProxy parses a no-proxy list.  Entries that cannot be parsed as an IP or
+// CIDR block are treated as domain names.
+func newNoProxy(entries []string) (np noProxy) {
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if len(entry) == 0 {
+			continue
+		}
+
+		if entry == "*" {
+			np.all = true
+		} else if _, network, err := net.ParseCIDR(entry); err == nil {
+			np.networks = append(np.networks, network)
+		} else if host, _, err := net.SplitHostPort(entry); err == nil {
+			np.add(host)
+		} else {
+			np.add(entry)
+		}
+	}
+
+	return
+}
+
+// add appends a host, without a port, to this no-proxy list.
+func (np *noProxy) add(host string) {
+	if ip := net.ParseIP(host); ip != nil {
+		np.ips = append(np.ips, ip)
+	} else {
+		np.domains = append(np.domains, strings.TrimPrefix(host, "."))
+	}
+}
+
+// matches tests if the given host, which must not have a port, bypasses the proxy.
+func (np noProxy) matches(host string) bool {
+	if np.all {
+		return true
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, candidate := range np.ips {
+			if candidate.Equal(ip) {
+				return true
+			}
+		}
+
+		for _, network := range np.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	host = strings.ToLower(host)
+	for _, domain := range np.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
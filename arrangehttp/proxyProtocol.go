@@ -0,0 +1,394 @@
+package arrangehttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProxyHeaderTimeout is the time allowed to read a PROXY protocol header
+	// when ProxyProtocol.HeaderTimeout is unset.
+	DefaultProxyHeaderTimeout = 5 * time.Second
+
+	// proxyV1MaxLength is the maximum length of a version 1 header, including the CRLF.
+	proxyV1MaxLength = 107
+
+	// proxyV2HeaderLength is the length of the fixed portion of a version 2 header.
+	proxyV2HeaderLength = 16
+)
+
+var (
+	// ErrProxyHeaderRequired indicates that a connection did not begin with a PROXY protocol
+	// header, or came from an untrusted source, when a header is required.
+	ErrProxyHeaderRequired = errors.New("A PROXY protocol header is required")
+
+	// ErrInvalidProxyHeader indicates that a PROXY protocol header was malformed.
+	ErrInvalidProxyHeader = errors.New("Invalid PROXY protocol header")
+
+	// ErrNoTrustedSources indicates that a ProxyProtocol configuration has no TrustedSources.
+	// Headers are only read from trusted proxies, so at least one source is required.
+	ErrNoTrustedSources = errors.New("PROXY protocol handling requires at least one trusted source")
+
+	proxyV1Signature = []byte("PROXY ")
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// ProxyProtocol is the unmarshaled configuration for reading HAProxy PROXY protocol headers,
+// both the version 1 text format and the version 2 binary format.  When a connection from a
+// trusted source begins with a header, the addresses in that header replace the connection's
+// RemoteAddr and LocalAddr.
+//
+// The header is read the first time the connection is read from or its addresses are
+// requested.  For an http.Server, this happens in the connection's own goroutine.
+type ProxyProtocol struct {
+	// TrustedSources are the CIDR ranges, or single IP addresses, of the proxies that are allowed
+	// to send headers.  This allowlist is required, and connections from other sources are not
+	// examined for a header.
+	TrustedSources []string `json:"trustedSources" yaml:"trustedSources"`
+
+	// HeaderTimeout is the maximum time to wait for the header.  If unset,
+	// DefaultProxyHeaderTimeout is used.
+	HeaderTimeout time.Duration `json:"headerTimeout" yaml:"headerTimeout"`
+
+	// Required indicates that every connection must come from a trusted source and begin with a
+	// header.  Reads from any other connection fail with ErrProxyHeaderRequired.  If unset, a
+	// connection without a header keeps its actual addresses.
+	Required bool `json:"required" yaml:"required"`
+}
+
+// parseTrustedSources parses CIDR ranges or single IP addresses.
+func parseTrustedSources(sources []string) ([]*net.IPNet, error) {
+	trusted := make([]*net.IPNet, 0, len(sources))
+	for _, s := range sources {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: s}
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		trusted = append(trusted, n)
+	}
+
+	return trusted, nil
+}
+
+// NewListenerConstructor creates the ListenerConstructor described by this configuration.
+// If this instance is nil, this method returns nil.  If TrustedSources is empty,
+// ErrNoTrustedSources is returned.  Any invalid TrustedSources result in an error.
+func (pp *ProxyProtocol) NewListenerConstructor() (ListenerConstructor, error) {
+	switch {
+	case pp == nil:
+		return nil, nil
+
+	case len(pp.TrustedSources) == 0:
+		return nil, ErrNoTrustedSources
+	}
+
+	trusted, err := parseTrustedSources(pp.TrustedSources)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := pp.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+
+	required := pp.Required
+	return func(next net.Listener) net.Listener {
+		return &proxyListener{
+			Listener: next,
+			trusted:  trusted,
+			timeout:  timeout,
+			required: required,
+		}
+	}, nil
+}
+
+// proxyListener decorates accepted connections so that they read PROXY protocol headers.
+type proxyListener struct {
+	net.Listener
+	trusted  []*net.IPNet
+	timeout  time.Duration
+	required bool
+}
+
+// isTrusted tests if a connection's actual remote address is a trusted source.
+func (pl *proxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, n := range pl.trusted {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Accept returns the next connection, decorated to read any PROXY protocol header.
+func (pl *proxyListener) Accept() (net.Conn, error) {
+	c, err := pl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &proxyConn{
+		Conn:       c,
+		reader:     bufio.NewReader(c),
+		remoteAddr: c.RemoteAddr(),
+		localAddr:  c.LocalAddr(),
+		timeout:    pl.timeout,
+		required:   pl.required,
+	}
+
+	if !pl.isTrusted(pc.remoteAddr) {
+		pc.headerOnce.Do(func() {
+			if pl.required {
+				pc.headerErr = ErrProxyHeaderRequired
+			}
+		})
+	}
+
+	return pc, nil
+}
+
+// proxyConn is a net.Conn that reads a PROXY protocol header before any other data.
+type proxyConn struct {
+	net.Conn
+	reader   *bufio.Reader
+	timeout  time.Duration
+	required bool
+
+	headerOnce sync.Once
+	headerErr  error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+
+	deadlineLock sync.Mutex
+	readDeadline time.Time
+}
+
+// SetDeadline records the read deadline, so that it can be restored after the header
+// is read, and then sets the deadlines of the connection.
+func (pc *proxyConn) SetDeadline(t time.Time) error {
+	pc.deadlineLock.Lock()
+	defer pc.deadlineLock.Unlock()
+	pc.readDeadline = t
+	return pc.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline records the read deadline, so that it can be restored after the header
+// is read, and then sets the read deadline of the connection.
+func (pc *proxyConn) SetReadDeadline(t time.Time) error {
+	pc.deadlineLock.Lock()
+	defer pc.deadlineLock.Unlock()
+	pc.readDeadline = t
+	return pc.Conn.SetReadDeadline(t)
+}
+
+// readHeader reads the header, if any, exactly once.  The header is read within the header
+// timeout or any earlier read deadline, and then the read deadline set by the caller is restored.
+func (pc *proxyConn) readHeader() error {
+	pc.headerOnce.Do(func() {
+		pc.deadlineLock.Lock()
+		deadline := time.Now().Add(pc.timeout)
+		if !pc.readDeadline.IsZero() && pc.readDeadline.Before(deadline) {
+			deadline = pc.readDeadline
+		}
+
+		err := pc.Conn.SetReadDeadline(deadline)
+		pc.deadlineLock.Unlock()
+		if err != nil {
+			pc.headerErr = err
+			return
+		}
+
+		pc.headerErr = pc.parseHeader()
+
+		pc.deadlineLock.Lock()
+		defer pc.deadlineLock.Unlock()
+		if err := pc.Conn.SetReadDeadline(pc.readDeadline); err != nil && pc.headerErr == nil {
+			pc.headerErr = err
+		}
+	})
+
+	return pc.headerErr
+}
+
+// hasPrefix tests if the buffered input begins with a prefix.  Only as many bytes as
+// necessary are read, so that a client sending less data than the prefix isn't blocked.
+func hasPrefix(r *bufio.Reader, prefix []byte) (bool, error) {
+	for i := 1; i <= len(prefix); i++ {
+		b, err := r.Peek(i)
+		if err != nil {
+			return false, err
+		}
+
+		if b[i-1] != prefix[i-1] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// parseHeader detects and parses either version of the header.
+func (pc *proxyConn) parseHeader() error {
+	if ok, err := hasPrefix(pc.reader, proxyV1Signature); err != nil {
+		return err
+	} else if ok {
+		return pc.parseV1()
+	}
+
+	if ok, err := hasPrefix(pc.reader, proxyV2Signature); err != nil {
+		return err
+	} else if ok {
+		return pc.parseV2()
+	}
+
+	if pc.required {
+		return ErrProxyHeaderRequired
+	}
+
+	return nil
+}
+
+// parseV1 parses a header of the form "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func (pc *proxyConn) parseV1() error {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLength {
+			return ErrInvalidProxyHeader
+		}
+
+		b, err := pc.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		line = append(line, b)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	} else if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return ErrInvalidProxyHeader
+	}
+
+	source, err := parseV1Address(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+
+	destination, err := parseV1Address(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+
+	pc.remoteAddr, pc.localAddr = source, destination
+	return nil
+}
+
+func parseV1Address(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// parseV2 parses the binary header.  Only TCP over IPv4 or IPv6 changes the addresses.
+// Any TLVs are skipped.
+func (pc *proxyConn) parseV2() error {
+	var header [proxyV2HeaderLength]byte
+	if _, err := io.ReadFull(pc.reader, header[:]); err != nil {
+		return err
+	}
+
+	version, command := header[12]>>4, header[12]&0x0F
+	if version != 2 || command > 1 {
+		return ErrInvalidProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(pc.reader, payload); err != nil {
+		return err
+	}
+
+	if command == 0 {
+		// LOCAL: the proxy's own connection, such as a health check
+		return nil
+	}
+
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return ErrInvalidProxyHeader
+		}
+
+		pc.remoteAddr = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		pc.localAddr = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return ErrInvalidProxyHeader
+		}
+
+		pc.remoteAddr = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		pc.localAddr = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+
+	return nil
+}
+
+// Read reads the header, if necessary, then reads from the connection.
+func (pc *proxyConn) Read(b []byte) (int, error) {
+	if err := pc.readHeader(); err != nil {
+		return 0, err
+	}
+
+	return pc.reader.Read(b)
+}
+
+// RemoteAddr returns the source address from the header.  If there was no header, or
+// it could not be read, this is the connection's actual remote address.
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	pc.readHeader() //nolint:errcheck // any error is returned from Read
+	return pc.remoteAddr
+}
+
+// LocalAddr returns the destination address from the header.  If there was no header, or
+// it could not be read, this is the connection's actual local address.
+func (pc *proxyConn) LocalAddr() net.Addr {
+	pc.readHeader() //nolint:errcheck // any error is returned from Read
+	return pc.localAddr
+}
@@ -0,0 +1,370 @@
+package arrangehttp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange/arrangetls"
+)
+
+// trustLoopback trusts the test clients as proxies.
+var trustLoopback = []string{"127.0.0.1"}
+
+type ProxyProtocolSuite struct {
+	suite.Suite
+}
+
+// proxyV2 builds a version 2 header.
+func proxyV2(command, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+// exchange sends data over a connection accepted by a listener decorated with the given
+// configuration, returning the accepted connection.
+func (suite *ProxyProtocolSuite) exchange(pp ProxyProtocol, data []byte) net.Conn {
+	lc, err := pp.NewListenerConstructor()
+	suite.Require().NoError(err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	l = lc(l)
+	suite.T().Cleanup(func() { l.Close() })
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { client.Close() })
+
+	_, err = client.Write(data)
+	suite.Require().NoError(err)
+
+	server, err := l.Accept()
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { server.Close() })
+	return server
+}
+
+// assertProxied verifies the addresses of a connection and that the payload follows the header.
+func (suite *ProxyProtocolSuite) assertProxied(c net.Conn, remoteAddr, localAddr string) {
+	suite.Equal(remoteAddr, c.RemoteAddr().String())
+	suite.Equal(localAddr, c.LocalAddr().String())
+
+	payload, err := bufio.NewReader(c).ReadString('\n')
+	suite.NoError(err)
+	suite.Equal("payload\n", payload)
+}
+
+func (suite *ProxyProtocolSuite) TestV1() {
+	testData := []struct {
+		header     string
+		remoteAddr string
+		localAddr  string
+	}{
+		{"PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", "192.0.2.1:56324", "192.0.2.2:443"},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", "[2001:db8::2]:443"},
+	}
+
+	for _, record := range testData {
+		suite.Run(record.header, func() {
+			c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback, Required: true}, []byte(record.header+"payload\n"))
+			suite.assertProxied(c, record.remoteAddr, record.localAddr)
+		})
+	}
+}
+
+func (suite *ProxyProtocolSuite) TestV1Unknown() {
+	c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback}, []byte("PROXY UNKNOWN\r\npayload\n"))
+	suite.assertProxied(c, c.(*proxyConn).Conn.RemoteAddr().String(), c.(*proxyConn).Conn.LocalAddr().String())
+}
+
+func (suite *ProxyProtocolSuite) TestV1Invalid() {
+	for _, header := range []string{
+		"PROXY TCP4 192.0.2.1\r\n",
+		"PROXY UDP4 192.0.2.1 192.0.2.2 56324 443\r\n",
+		"PROXY TCP4 bad 192.0.2.2 56324 443\r\n",
+		"PROXY TCP4 192.0.2.1 192.0.2.2 56324 99999\r\n",
+		"PROXY TCP4 " + string(make([]byte, proxyV1MaxLength)) + "\r\n",
+	} {
+		c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback}, []byte(header))
+		_, err := c.Read(make([]byte, 1))
+		suite.ErrorIs(err, ErrInvalidProxyHeader)
+	}
+}
+
+func (suite *ProxyProtocolSuite) TestV2() {
+	ipv4 := []byte{192, 0, 2, 1, 192, 0, 2, 2, 0xDC, 0x04, 0x01, 0xBB}
+	ipv6 := append(append(append([]byte{}, net.ParseIP("2001:db8::1")...), net.ParseIP("2001:db8::2")...), 0xDC, 0x04, 0x01, 0xBB)
+
+	testData := []struct {
+		name       string
+		header     []byte
+		remoteAddr string
+		localAddr  string
+	}{
+		{"IPv4", proxyV2(1, 0x11, ipv4), "192.0.2.1:56324", "192.0.2.2:443"},
+		{"IPv4WithTLV", proxyV2(1, 0x11, append(ipv4, 0x04, 0x00, 0x01, 0xFF)), "192.0.2.1:56324", "192.0.2.2:443"},
+		{"IPv6", proxyV2(1, 0x21, ipv6), "[2001:db8::1]:56324", "[2001:db8::2]:443"},
+	}
+
+	for _, record := range testData {
+		suite.Run(record.name, func() {
+			c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback, Required: true}, append(record.header, "payload\n"...))
+			suite.assertProxied(c, record.remoteAddr, record.localAddr)
+		})
+	}
+}
+
+func (suite *ProxyProtocolSuite) TestV2Local() {
+	c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback}, append(proxyV2(0, 0x00, nil), "payload\n"...))
+	suite.assertProxied(c, c.(*proxyConn).Conn.RemoteAddr().String(), c.(*proxyConn).Conn.LocalAddr().String())
+}
+
+func (suite *ProxyProtocolSuite) TestV2Invalid() {
+	for _, header := range [][]byte{
+		proxyV2(2, 0x11, nil),
+		proxyV2(1, 0x11, []byte{1, 2, 3}),
+		proxyV2(1, 0x21, []byte{1, 2, 3}),
+	} {
+		c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback}, header)
+		_, err := c.Read(make([]byte, 1))
+		suite.ErrorIs(err, ErrInvalidProxyHeader)
+	}
+}
+
+func (suite *ProxyProtocolSuite) TestNoHeader() {
+	c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback}, []byte("payload\n"))
+	suite.assertProxied(c, c.(*proxyConn).Conn.RemoteAddr().String(), c.(*proxyConn).Conn.LocalAddr().String())
+
+	c = suite.exchange(ProxyProtocol{TrustedSources: trustLoopback, Required: true}, []byte("payload\n"))
+	_, err := c.Read(make([]byte, 1))
+	suite.ErrorIs(err, ErrProxyHeaderRequired)
+}
+
+func (suite *ProxyProtocolSuite) TestUntrusted() {
+	const header = "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+	c := suite.exchange(ProxyProtocol{TrustedSources: []string{"192.0.2.0/24"}}, []byte(header))
+	suite.Equal("127.0.0.1", c.RemoteAddr().(*net.TCPAddr).IP.String())
+
+	// the header is not consumed from an untrusted source
+	data := make([]byte, len(header))
+	_, err := io.ReadFull(c, data)
+	suite.NoError(err)
+	suite.Equal(header, string(data))
+
+	c = suite.exchange(ProxyProtocol{TrustedSources: []string{"::1", "192.0.2.1"}, Required: true}, []byte(header))
+	_, err = c.Read(make([]byte, 1))
+	suite.ErrorIs(err, ErrProxyHeaderRequired)
+
+	c = suite.exchange(ProxyProtocol{TrustedSources: []string{"127.0.0.1"}, Required: true}, []byte(header+"payload\n"))
+	suite.assertProxied(c, "192.0.2.1:56324", "192.0.2.2:443")
+}
+
+func (suite *ProxyProtocolSuite) TestHeaderTimeout() {
+	c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback, HeaderTimeout: 50 * time.Millisecond}, []byte("PROX"))
+	_, err := c.Read(make([]byte, 1))
+	suite.ErrorIs(err, os.ErrDeadlineExceeded)
+}
+
+func (suite *ProxyProtocolSuite) TestReadDeadline() {
+	c := suite.exchange(ProxyProtocol{TrustedSources: trustLoopback}, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+
+	// a deadline set before the header is read still applies after it
+	suite.Require().NoError(c.SetReadDeadline(time.Now().Add(100 * time.Millisecond)))
+	suite.Equal("192.0.2.1:56324", c.RemoteAddr().String())
+	_, err := c.Read(make([]byte, 1))
+	suite.ErrorIs(err, os.ErrDeadlineExceeded)
+
+	c = suite.exchange(ProxyProtocol{TrustedSources: trustLoopback}, []byte("PROX"))
+	suite.Require().NoError(c.SetDeadline(time.Now().Add(100 * time.Millisecond)))
+	_, err = c.Read(make([]byte, 1))
+	suite.ErrorIs(err, os.ErrDeadlineExceeded)
+}
+
+func (suite *ProxyProtocolSuite) TestInvalidTrustedSources() {
+	for _, source := range []string{"bad", "192.0.2.0/99"} {
+		lc, err := (&ProxyProtocol{TrustedSources: []string{source}}).NewListenerConstructor()
+		suite.Error(err)
+		suite.Nil(lc)
+	}
+
+	var pp *ProxyProtocol
+	lc, err := pp.NewListenerConstructor()
+	suite.NoError(err)
+	suite.Nil(lc)
+
+	// there is no default allowlist
+	lc, err = (&ProxyProtocol{Required: true}).NewListenerConstructor()
+	suite.ErrorIs(err, ErrNoTrustedSources)
+	suite.Nil(lc)
+
+	_, err = ServerConfig{
+		Address:       "127.0.0.1:0",
+		ProxyProtocol: &ProxyProtocol{},
+	}.Listen(context.Background(), &http.Server{Addr: "127.0.0.1:0"})
+
+	suite.ErrorIs(err, ErrNoTrustedSources)
+}
+
+func (suite *ProxyProtocolSuite) TestServerConfigTLS() {
+	sc := ServerConfig{
+		Address: "127.0.0.1:0",
+		TLS: &arrangetls.Config{
+			Certificates: arrangetls.ExternalCertificates{
+				{
+					CertificateFile: CertificateFile,
+					KeyFile:         KeyFile,
+				},
+			},
+		},
+		AcceptRate:    &AcceptRateLimit{Rate: 100},
+		ProxyProtocol: &ProxyProtocol{TrustedSources: trustLoopback, Required: true},
+	}
+
+	server, err := sc.NewServer()
+	suite.Require().NoError(err)
+	server.Handler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.Write([]byte(request.RemoteAddr)) //nolint:errcheck
+	})
+
+	l, err := sc.Listen(context.Background(), server)
+	suite.Require().NoError(err)
+	go server.Serve(l) //nolint:errcheck
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				c, err := new(net.Dialer).DialContext(ctx, network, address)
+				if err == nil {
+					_, err = c.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+				}
+
+				return c, err
+			},
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec
+			},
+		},
+	}
+
+	defer client.CloseIdleConnections()
+	response, err := client.Get("https://" + l.Addr().String())
+	suite.Require().NoError(err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	suite.Require().NoError(err)
+	suite.Equal("192.0.2.1:56324", string(body))
+	suite.Equal(uint64(1), sc.AcceptRate.Counters().Total())
+}
+
+func (suite *ProxyProtocolSuite) TestServerConfigSilentClient() {
+	sc := ServerConfig{
+		Address:       "127.0.0.1:0",
+		AcceptRate:    &AcceptRateLimit{Rate: 100},
+		ProxyProtocol: &ProxyProtocol{TrustedSources: trustLoopback, HeaderTimeout: time.Minute},
+	}
+
+	server, err := sc.NewServer()
+	suite.Require().NoError(err)
+	server.Handler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		response.Write([]byte(request.RemoteAddr)) //nolint:errcheck
+	})
+
+	l, err := sc.Listen(context.Background(), server)
+	suite.Require().NoError(err)
+	go server.Serve(l) //nolint:errcheck
+	defer server.Close()
+
+	// a client that never sends its header must not prevent other connections from being accepted
+	silent, err := net.Dial("tcp", l.Addr().String())
+	suite.Require().NoError(err)
+	defer silent.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				c, err := new(net.Dialer).DialContext(ctx, network, address)
+				if err == nil {
+					_, err = c.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 80\r\n"))
+				}
+
+				return c, err
+			},
+		},
+		Timeout: 5 * time.Second,
+	}
+
+	defer client.CloseIdleConnections()
+	response, err := client.Get("http://" + l.Addr().String())
+	suite.Require().NoError(err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	suite.Require().NoError(err)
+	suite.Equal("192.0.2.1:56324", string(body))
+	suite.Equal(uint64(2), sc.AcceptRate.Counters().Total())
+}
+
+func (suite *ProxyProtocolSuite) TestServerConfigReadHeaderTimeout() {
+	sc := ServerConfig{
+		Address:           "127.0.0.1:0",
+		ReadHeaderTimeout: 100 * time.Millisecond,
+		TLS: &arrangetls.Config{
+			Certificates: arrangetls.ExternalCertificates{
+				{
+					CertificateFile: CertificateFile,
+					KeyFile:         KeyFile,
+				},
+			},
+		},
+		ProxyProtocol: &ProxyProtocol{TrustedSources: trustLoopback, HeaderTimeout: time.Minute},
+	}
+
+	server, err := sc.NewServer()
+	suite.Require().NoError(err)
+	server.Handler = http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(299)
+	})
+
+	l, err := sc.Listen(context.Background(), server)
+	suite.Require().NoError(err)
+	go server.Serve(l) //nolint:errcheck
+	defer server.Close()
+
+	// a client that stalls after its PROXY header and part of its request must be disconnected
+	c, err := net.Dial("tcp", l.Addr().String())
+	suite.Require().NoError(err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"))
+	suite.Require().NoError(err)
+
+	client := tls.Client(c, &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec
+	})
+
+	suite.Require().NoError(client.SetDeadline(time.Now().Add(5 * time.Second)))
+	suite.Require().NoError(client.Handshake())
+	_, err = client.Write([]byte("GET / HTTP/1.1\r\n"))
+	suite.Require().NoError(err)
+
+	_, err = client.Read(make([]byte, 1))
+	suite.Require().Error(err)
+	suite.NotErrorIs(err, os.ErrDeadlineExceeded, "the server did not close the stalled connection")
+}
+
+func TestProxyProtocol(t *testing.T) {
+	suite.Run(t, new(ProxyProtocolSuite))
+}
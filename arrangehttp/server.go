@@ -1,12 +1,14 @@
 package arrangehttp
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/http"
 	"reflect"
 
 	"github.com/xmidt-org/arrange"
+	"github.com/xmidt-org/arrange/internal/arrangereflect"
 	"go.uber.org/fx"
 )
 
@@ -42,8 +44,22 @@ func NewServer(sc ServerConfig, h http.Handler, opts ...Option[http.Server]) (*h
 // NewServerCustom is a server constructor that allows a client to customize the concrete
 // ServerFactory and http.Handler for the server.  This function is useful when you have a
 // custom (possibly unmarshaled) configuration struct that implements ServerFactory.
-func NewServerCustom[F ServerFactory, H http.Handler](sf F, h H, opts ...Option[http.Server]) (s *http.Server, err error) {
-	s, err = sf.NewServer()
+//
+// If the ServerFactory also implements ServerMiddlewareFactory, its middleware is applied
+// to the handler before any options.
+func NewServerCustom[F ServerFactory, H http.Handler](sf F, h H, opts ...Option[http.Server]) (*http.Server, error) {
+	return newServerCustom(sf, h, nil, opts...)
+}
+
+// newServerCustom is like NewServerCustom, but uses the ServerLifecycleFactory behavior of the
+// ServerFactory, if any, when a lifecycle is supplied.
+func newServerCustom[F ServerFactory, H http.Handler](sf F, h H, lifecycle fx.Lifecycle, opts ...Option[http.Server]) (s *http.Server, err error) {
+	if slf, ok := any(sf).(ServerLifecycleFactory); ok && lifecycle != nil {
+		s, err = slf.NewServerLifecycle(lifecycle)
+	} else {
+		s, err = sf.NewServer()
+	}
+
 	if err == nil {
 		// guard against both the http.Handler being nil and it being
 		// a non-nil interface tuple that points to a nil instance.
@@ -55,74 +71,121 @@ func NewServerCustom[F ServerFactory, H http.Handler](sf F, h H, opts ...Option[
 			s.Handler = h
 		}
 
+		if smf, ok := any(sf).(ServerMiddlewareFactory); ok {
+			if m := smf.NewServerMiddleware(); m != nil {
+				s.Handler = m(s.Handler)
+			}
+		}
+
 		s, err = ApplyServerOptions(s, opts...)
 	}
 
 	return
 }
 
-func serve(server *http.Server, listener net.Listener) error {
-	return server.Serve(listener)
-}
+// BindServer binds a server to the enclosing application's lifecycle.
+//
+// - If listener is not nil, then the server is started with http.Server.Serve using that listener.
+// - Otherwise, DefaultListenerFactory is used to create the listener, which will use TLS if
+// server.TLSConfig is set.  As with http.Server.ListenAndServe, an empty server.Addr means
+// ":http", or ":https" if server.TLSConfig is set.
+//
+// The server is also started on any additional listeners.  The server is shutdown on all of its
+// listeners together, and an abnormal exit on any of them is treated as a failure of the server.
+//
+// The listener is always created synchronously when the application starts, so errors such as
+// an address that is already in use will cause application startup to fail.  If the server later
+// exits with an error other than http.ErrServerClosed, that error is logged and the application
+// is shutdown with ServerAbnormalExitCode.
+//
+// The server is shutdown gracefully via http.Server.Shutdown, bounded by the application's stop
+// timeout.  If the graceful shutdown does not complete in time, the server is closed.
+func BindServer(server *http.Server, listener net.Listener, lifecycle fx.Lifecycle, shutdowner fx.Shutdowner, more ...net.Listener) {
+	endpoints := make([]ListenerFactory, 0, len(more))
+	for _, l := range more {
+		endpoints = append(endpoints, serverListenerFactory(nil, l))
+	}
 
-func listenAndServeTLS(server *http.Server, _ net.Listener) error {
-	return server.ListenAndServeTLS("", "") // certificates must be in the TLSConfig
-}
+	lf := serverListenerFactory(nil, listener)
+	if arrangereflect.Safe[net.Listener](listener, nil) == nil {
+		lf = ListenerFactoryFunc(listenAndServe)
+	}
 
-func listenAndServe(server *http.Server, _ net.Listener) error {
-	return server.ListenAndServe()
+	(&serverBinding{
+		server:     server,
+		lf:         lf,
+		shutdowner: shutdowner,
+		endpoints:  endpoints,
+	}).bind(lifecycle)
 }
 
-func newServerHook(server *http.Server, listener net.Listener, shutdowner fx.Shutdowner) (hook fx.Hook) {
-	lv := reflect.ValueOf(listener)
+// listenAndServe is the ListenerFactory used by BindServer when no listener is supplied.
+// It behaves like DefaultListenerFactory, except that an empty server address defaults
+// in the same way as http.Server.ListenAndServe and ListenAndServeTLS.
+func listenAndServe(ctx context.Context, server *http.Server) (net.Listener, error) {
+	address := server.Addr
+	if len(address) == 0 {
+		address = ":http"
+		if server.TLSConfig != nil {
+			address = ":https"
+		}
+	}
 
-	var startFunc func(*http.Server, net.Listener) error
+	l, err := DefaultListenerFactory{}.listenNetwork(ctx, address)
+	if err != nil {
+		return nil, err
+	}
 
-	switch {
-	// handle the case of a non-nil interface which is invalid (nil object underneath)
-	case lv.IsValid() && (lv.Kind() != reflect.Ptr || !lv.IsNil()):
-		startFunc = serve
+	return decorateListener(l, ListenerChain{}, server), nil
+}
 
-	case server.TLSConfig != nil:
-		startFunc = listenAndServeTLS
+// BindServerListenerFactory binds a server to the enclosing application's lifecycle, using
+// a ListenerFactory to create the server's listener.  The listener is created synchronously
+// when the application starts, so errors such as an address that is already in use will
+// cause application startup to fail.  The server is then started with http.Server.Serve.
+//
+// If lf is nil, DefaultListenerFactory is used.  Any endpoints create additional listeners
+// for the server, e.g. an Endpoint for each extra address.  The server is shutdown in the
+// same manner as BindServer.
+func BindServerListenerFactory(server *http.Server, lf ListenerFactory, lifecycle fx.Lifecycle, shutdowner fx.Shutdowner, endpoints ...ListenerFactory) {
+	(&serverBinding{
+		server:     server,
+		lf:         arrangereflect.Safe[ListenerFactory](lf, DefaultListenerFactory{}),
+		shutdowner: shutdowner,
+		endpoints:  endpoints,
+	}).bind(lifecycle)
+}
 
-	default:
-		startFunc = listenAndServe
+// serverListenerFactory determines the ListenerFactory used to start a server.  An injected
+// listener takes precedence, followed by the given ListenerFactory.  Otherwise, DefaultListenerFactory
+// is used.  In all cases, the given constructors decorate the resulting listener.
+func serverListenerFactory(lf ListenerFactory, listener net.Listener, lcs ...ListenerConstructor) ListenerFactory {
+	if l := arrangereflect.Safe[net.Listener](listener, nil); l != nil {
+		lf = ListenerFactoryFunc(func(context.Context, *http.Server) (net.Listener, error) {
+			return l, nil
+		})
+	} else if lf == nil {
+		lf = DefaultListenerFactory{}
 	}
 
-	hook = fx.StartStopHook(
-		func() {
-			go func() {
-				var exitCode int
-				defer func() {
-					shutdowner.Shutdown(
-						fx.ExitCode(exitCode),
-					)
-				}()
-
-				err := startFunc(server, listener)
-				if !errors.Is(err, http.ErrServerClosed) {
-					exitCode = ServerAbnormalExitCode
-				}
-			}()
-		},
-		server.Shutdown,
-	)
-
-	return
+	return NewListenerChain(lcs...).Factory(lf)
 }
 
-// BindServer binds a server to the enclosing application's lifecycle.
-//
-// - If listener is not nil, then the server is started with http.Server.Serve.
-// - If server.TLSConfig is not nil, then a TLS listener is created and the server is started via http.Server.ServeTLS.
-// - Finally, by default the server is started with http.Server.ListenAndServe.
-//
-// The server is shutdown gracefully via http.Server.Shutdown.
-func BindServer(server *http.Server, listener net.Listener, lifecycle fx.Lifecycle, shutdowner fx.Shutdowner) {
-	lifecycle.Append(
-		newServerHook(server, listener, shutdowner),
-	)
+// serverListenerFactories returns the ListenerFactory for a server's primary listener, if the
+// ServerFactory supplies one, along with the factories for its additional endpoints.  If a
+// Handoff is supplied and the ServerFactory implements ServerHandoffFactory, every listener
+// is created through the Handoff.
+func serverListenerFactories(sf any, serverName string, h *Handoff) (lf ListenerFactory, endpoints []ListenerFactory) {
+	if shf, ok := sf.(ServerHandoffFactory); ok && h != nil {
+		return shf.NewServerHandoff(h, serverName)
+	}
+
+	lf, _ = sf.(ListenerFactory)
+	if sef, ok := sf.(ServerEndpointsFactory); ok {
+		endpoints = sef.NewServerEndpoints()
+	}
+
+	return
 }
 
 // ProvideServer assembles a server out of application components in a standard, opinionated way.
@@ -134,13 +197,44 @@ func BindServer(server *http.Server, listener net.Listener, lifecycle fx.Lifecyc
 //   - http.Handler is an optional dependency with the name serverName+".handler"
 //   - []ServerOption is an optional value group dependency with the name serverName+".options"
 //   - net.Listener is an optional dependency with the name serverName+".listener"
+//   - []ListenerConstructor is an optional value group dependency with the name serverName+".listener.constructors"
+//   - chan<- error is an optional dependency with the name serverName+".errors"
+//   - ServerObserver is an optional dependency with the name serverName+".observer"
+//   - *Handoff is an optional, unnamed dependency shared by all servers
 //
 // The external set of options, if supplied, is applied to the server after any injected options.
 // This allows for options that come from outside the enclosing fx.App, as might be the case
 // for options driven by the command line.
 //
-// BindServer is used as an fx.Invoke function to bind the resulting server to the enclosing
-// application's lifecycle.
+// BindServerListenerFactory is used to bind the resulting server to the enclosing application's
+// lifecycle.  If a net.Listener was injected, the server uses it.  Otherwise, if the ServerFactory
+// also implements ListenerFactory, as ServerConfig does, it is used to create the listener.
+// Any injected ListenerConstructors decorate the listener in either case.
+//
+// If the ServerFactory also implements ServerEndpointsFactory, as ServerConfig does, the server
+// also listens on each additional endpoint, and any injected ListenerConstructors decorate those
+// listeners as well.  All of the server's listeners are created when the application starts.
+//
+// If the server exits with an error other than http.ErrServerClosed, that error is sent to the
+// injected error channel.  The channel should be buffered, as the error is logged instead if
+// the channel cannot immediately accept it.  The application is then shutdown with
+// ServerAbnormalExitCode.
+//
+// If a ServerObserver is injected, it receives a ServerEvent when the server starts listening,
+// when it exits abnormally, and when its shutdown completes.  ZapServerObserver can be used
+// to log these events.
+//
+// If a *Handoff is injected and the ServerFactory also implements ServerHandoffFactory, as ServerConfig
+// does, the server's listeners are created through the Handoff so that a Handoff.Restart can pass
+// them to the restarted process.  An injected net.Listener still takes precedence.  Once the server
+// has started, any inherited listeners named after it that it did not adopt are closed.
+//
+// If the ServerFactory also implements ServerShutdownFactory, as ServerConfig does, the
+// returned ServerShutdown strategy is used to stop the server.
+//
+// If the ServerFactory also implements ServerLifecycleFactory, as ServerConfig does, the server
+// is created with NewServerLifecycle, so that resources such as certificate watchers are bound
+// to the application's lifecycle.
 func ProvideServer(serverName string, external ...Option[http.Server]) fx.Option {
 	return ProvideServerCustom[ServerConfig, http.Handler](serverName, external...)
 }
@@ -152,18 +246,13 @@ func ProvideServerCustom[F ServerFactory, H http.Handler](serverName string, ext
 		return fx.Error(ErrServerNameRequired)
 	}
 
-	// Use the named constructor function when possible so that uber/fx's error reporting
-	// will call out that function in logs.
-	ctor := NewServerCustom[F, H]
-	if len(external) > 0 {
-		ctor = func(sf F, h H, injected ...Option[http.Server]) (s *http.Server, err error) {
-			s, err = NewServerCustom(sf, h, injected...)
-			if err == nil {
-				s, err = ApplyServerOptions(s, external...)
-			}
-
-			return
+	ctor := func(sf F, h H, lifecycle fx.Lifecycle, injected ...Option[http.Server]) (s *http.Server, err error) {
+		s, err = newServerCustom(sf, h, lifecycle, injected...)
+		if err == nil {
+			s, err = ApplyServerOptions(s, external...)
 		}
+
+		return
 	}
 
 	return fx.Options(
@@ -173,18 +262,54 @@ func ProvideServerCustom[F ServerFactory, H http.Handler](serverName string, ext
 				arrange.Tags().
 					OptionalName(serverName+".config").
 					OptionalName(serverName+".handler").
+					Skip().
 					Group(serverName+".options").
-					OptionalName(serverName+".listener").
 					ParamTags(),
 				arrange.Tags().Name(serverName).ResultTags(),
 			),
 		),
 		fx.Invoke(
 			fx.Annotate(
-				BindServer,
+				func(sf F, server *http.Server, listener net.Listener, lcs []ListenerConstructor, serveErrs chan<- error, observer ServerObserver, h *Handoff, lifecycle fx.Lifecycle, shutdowner fx.Shutdowner) {
+					var shutdown ServerShutdown
+					if ssf, ok := any(sf).(ServerShutdownFactory); ok {
+						shutdown = ssf.NewServerShutdown()
+					}
+
+					lf, efs := serverListenerFactories(sf, serverName, h)
+					endpoints := make([]ListenerFactory, 0, len(efs))
+					for _, ef := range efs {
+						endpoints = append(endpoints, NewListenerChain(lcs...).Factory(ef))
+					}
+
+					(&serverBinding{
+						name:       serverName,
+						server:     server,
+						lf:         serverListenerFactory(lf, listener, lcs...),
+						shutdowner: shutdowner,
+						serveErrs:  serveErrs,
+						observer:   arrangereflect.Safe[ServerObserver](observer, nil),
+						shutdown:   shutdown,
+						endpoints:  endpoints,
+					}).bind(lifecycle)
+
+					if _, ok := any(sf).(ServerHandoffFactory); ok && h != nil {
+						// this runs after the server's listeners have been created
+						lifecycle.Append(fx.Hook{
+							OnStart: func(context.Context) error {
+								return h.closeServerInherited(serverName)
+							},
+						})
+					}
+				},
 				arrange.Tags().
+					OptionalName(serverName+".config").
 					Name(serverName).
 					OptionalName(serverName+".listener").
+					Group(serverName+".listener.constructors").
+					OptionalName(serverName+".errors").
+					OptionalName(serverName+".observer").
+					Optional().
 					ParamTags(),
 			),
 		),
@@ -0,0 +1,145 @@
+package arrangehttp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"go.uber.org/fx"
+)
+
+// serverBinding holds the components used to bind an *http.Server to the
+// lifecycle of an enclosing fx.App.
+type serverBinding struct {
+	name       string
+	server     *http.Server
+	lf         ListenerFactory
+	shutdowner fx.Shutdowner
+
+	// endpoints are the optional factories for the server's additional listeners.
+	endpoints []ListenerFactory
+
+	// serveErrs is the optional channel that receives any error that causes
+	// the server to exit abnormally.
+	serveErrs chan<- error
+
+	// observer is the optional ServerObserver that receives lifecycle events.
+	observer ServerObserver
+
+	// shutdown is the strategy used to stop the server.
+	shutdown ServerShutdown
+
+	// addr is the actual address of the primary listener, established when the server starts.
+	addr net.Addr
+}
+
+// bind appends this binding's hook to the given lifecycle.
+func (sb *serverBinding) bind(lifecycle fx.Lifecycle) {
+	lifecycle.Append(fx.Hook{
+		OnStart: sb.onStart,
+		OnStop:  sb.onStop,
+	})
+}
+
+// notify dispatches an event to the observer, if one is set.
+func (sb *serverBinding) notify(t ServerEventType, addr net.Addr, err error) {
+	if sb.observer != nil {
+		sb.observer.OnServerEvent(ServerEvent{
+			Type: t,
+			Name: sb.name,
+			Addr: addr,
+			Err:  err,
+		})
+	}
+}
+
+// onStart creates the server's listeners synchronously, so that bind errors are
+// returned to the enclosing application.  The server is then run in its own goroutine.
+// If any listener cannot be created, those already created are closed.
+func (sb *serverBinding) onStart(ctx context.Context) error {
+	listeners := make([]net.Listener, 0, 1+len(sb.endpoints))
+	for _, lf := range append([]ListenerFactory{sb.lf}, sb.endpoints...) {
+		l, err := lf.Listen(ctx, sb.server)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+
+			return err
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	sb.addr = listeners[0].Addr()
+	for _, l := range listeners {
+		sb.notify(ServerListening, l.Addr(), nil)
+	}
+
+	go sb.serve(listeners)
+	return nil
+}
+
+// onStop shuts down the server using this binding's ServerShutdown strategy.
+func (sb *serverBinding) onStop(ctx context.Context) error {
+	err := sb.shutdown.Shutdown(ctx, sb.server)
+	sb.notify(ServerShutdownComplete, sb.addr, err)
+	return err
+}
+
+// serveResult is the outcome of serving on one of a server's listeners.
+type serveResult struct {
+	addr net.Addr
+	err  error
+}
+
+// serve runs the server against each of the given listeners, then shuts down the enclosing
+// application when the server exits.  An abnormal exit on any listener is treated as a
+// failure of the whole server, and the remaining listeners are stopped along with the
+// enclosing application.
+func (sb *serverBinding) serve(listeners []net.Listener) {
+	var exitCode int
+	defer func() {
+		sb.shutdowner.Shutdown(
+			fx.ExitCode(exitCode),
+		)
+	}()
+
+	// buffered, so that no goroutine blocks once the first abnormal exit is reported
+	results := make(chan serveResult, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			results <- serveResult{
+				addr: l.Addr(),
+				err:  sb.server.Serve(l),
+			}
+		}(l)
+	}
+
+	for range listeners {
+		r := <-results
+		if !errors.Is(r.err, http.ErrServerClosed) {
+			exitCode = ServerAbnormalExitCode
+			sb.notify(ServerServeError, r.addr, r.err)
+			sb.reportServeError(r.addr, r.err)
+			return
+		}
+	}
+}
+
+// reportServeError sends an abnormal exit error to the serveErrs channel.  If that channel
+// is unset or cannot accept the error, the error is logged instead using the server's
+// ErrorLog or, if that is unset, the standard logger.
+func (sb *serverBinding) reportServeError(addr net.Addr, err error) {
+	select {
+	case sb.serveErrs <- err:
+	default:
+		if sb.server.ErrorLog != nil {
+			sb.server.ErrorLog.Printf("arrangehttp: server on %s exited abnormally: %s", addr, err)
+		} else {
+			log.Printf("arrangehttp: server on %s exited abnormally: %s", addr, err)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package arrangehttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange"
+	"github.com/xmidt-org/arrange/arrangetls"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// errorListener is a net.Listener whose Accept always fails with a permanent error.
+type errorListener struct {
+	net.Listener
+	err error
+}
+
+func (el errorListener) Accept() (net.Conn, error) {
+	return nil, el.err
+}
+
+type ServerBindingSuite struct {
+	suite.Suite
+}
+
+func (suite *ServerBindingSuite) newErrorListener(err error) net.Listener {
+	l, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(listenErr)
+	suite.T().Cleanup(func() { l.Close() })
+	return errorListener{Listener: l, err: err}
+}
+
+func (suite *ServerBindingSuite) TestBindServerListener() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+
+	var (
+		lifecycle  = fxtest.NewLifecycle(suite.T())
+		shutdowner = new(mockShutdowner)
+		shutdown   = make(chan struct{})
+		server     = &http.Server{
+			Handler: http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+				response.WriteHeader(299)
+			}),
+		}
+	)
+
+	shutdowner.ExpectShutdown().Return(nil).Run(func(mock.Arguments) {
+		close(shutdown)
+	})
+
+	BindServer(server, l, lifecycle, shutdowner)
+	lifecycle.RequireStart()
+
+	response, err := http.Get("http://" + l.Addr().String())
+	suite.Require().NoError(err)
+	response.Body.Close()
+	suite.Equal(299, response.StatusCode)
+
+	lifecycle.RequireStop()
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		suite.Fail("The application was not shutdown")
+	}
+}
+
+func (suite *ServerBindingSuite) TestBindServerAddressInUse() {
+	existing, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer existing.Close()
+
+	var (
+		lifecycle  = fxtest.NewLifecycle(suite.T())
+		shutdowner = new(mockShutdowner)
+		server     = &http.Server{
+			Addr: existing.Addr().String(),
+		}
+	)
+
+	BindServer(server, nil, lifecycle, shutdowner)
+	suite.Error(lifecycle.Start(context.Background()))
+	shutdowner.AssertExpectations(suite.T())
+}
+
+func (suite *ServerBindingSuite) TestBindServerDefaultAddress() {
+	testData := []struct {
+		server *http.Server
+		port   string
+	}{
+		{&http.Server{}, "80"},
+		{&http.Server{TLSConfig: new(tls.Config)}, "443"},
+	}
+
+	for _, record := range testData {
+		suite.Run(record.port, func() {
+			// binding a privileged port may not be permitted, in which case the error names the address
+			l, err := listenAndServe(context.Background(), record.server)
+			if err != nil {
+				suite.Contains(err.Error(), ":"+record.port)
+				return
+			}
+
+			defer l.Close()
+			_, port, err := net.SplitHostPort(l.Addr().String())
+			suite.Require().NoError(err)
+			suite.Equal(record.port, port)
+		})
+	}
+}
+
+func (suite *ServerBindingSuite) TestServeErrorChannel() {
+	var (
+		expectedErr = errors.New("expected")
+		serveErrs   = make(chan error, 1)
+		lifecycle   = fxtest.NewLifecycle(suite.T())
+		shutdowner  = new(mockShutdowner)
+		shutdown    = make(chan struct{})
+	)
+
+	shutdowner.ExpectShutdown().Return(nil).Run(func(mock.Arguments) {
+		close(shutdown)
+	})
+
+	(&serverBinding{
+		server:     new(http.Server),
+		lf:         serverListenerFactory(nil, suite.newErrorListener(expectedErr)),
+		shutdowner: shutdowner,
+		serveErrs:  serveErrs,
+	}).bind(lifecycle)
+
+	lifecycle.RequireStart()
+	select {
+	case actualErr := <-serveErrs:
+		suite.Same(expectedErr, actualErr)
+	case <-time.After(2 * time.Second):
+		suite.Fail("No serve error was reported")
+	}
+
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		suite.Fail("The application was not shutdown")
+	}
+
+	lifecycle.RequireStop()
+}
+
+func (suite *ServerBindingSuite) TestServeErrorLog() {
+	var (
+		output     bytes.Buffer
+		lifecycle  = fxtest.NewLifecycle(suite.T())
+		shutdowner = new(mockShutdowner)
+		shutdown   = make(chan struct{})
+	)
+
+	shutdowner.ExpectShutdown().Return(nil).Run(func(mock.Arguments) {
+		close(shutdown)
+	})
+
+	BindServer(
+		&http.Server{
+			ErrorLog: log.New(&output, "", 0),
+		},
+		suite.newErrorListener(errors.New("expected")),
+		lifecycle,
+		shutdowner,
+	)
+
+	lifecycle.RequireStart()
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		suite.Fail("The application was not shutdown")
+	}
+
+	lifecycle.RequireStop()
+	suite.Contains(output.String(), "exited abnormally: expected")
+}
+
+func (suite *ServerBindingSuite) TestProvideServerErrors() {
+	var (
+		expectedErr = errors.New("expected")
+		serveErrs   = make(chan error, 1)
+	)
+
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			fx.Annotate(
+				func() net.Listener { return suite.newErrorListener(expectedErr) },
+				arrange.Tags().Name("main.listener").ResultTags(),
+			),
+			fx.Annotate(
+				func() chan<- error { return serveErrs },
+				arrange.Tags().Name("main.errors").ResultTags(),
+			),
+		),
+		ProvideServer("main"),
+	)
+
+	suite.Require().NoError(app.Start(context.Background()))
+	defer app.Stop(context.Background())
+
+	select {
+	case actualErr := <-serveErrs:
+		suite.Same(expectedErr, actualErr)
+	case <-time.After(2 * time.Second):
+		suite.Fail("No serve error was reported")
+	}
+
+	select {
+	case signal := <-app.Wait():
+		suite.Equal(ServerAbnormalExitCode, signal.ExitCode)
+	case <-time.After(2 * time.Second):
+		suite.Fail("The application was not shutdown")
+	}
+}
+
+func (suite *ServerBindingSuite) TestProvideServerObserver() {
+	var (
+		events   = make(chan ServerEvent, 3)
+		observer = ServerObserverFunc(func(e ServerEvent) {
+			events <- e
+		})
+	)
+
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			fx.Annotate(
+				ServerConfig{
+					Address: "127.0.0.1:0",
+				},
+				arrange.Tags().Name("main.config").ResultTags(),
+			),
+			fx.Annotate(
+				observer,
+				arrange.Tags().Name("main.observer").ResultTags(),
+				fx.As(new(ServerObserver)),
+			),
+		),
+		ProvideServer("main"),
+	)
+
+	app.RequireStart()
+	listening := <-events
+	suite.Equal(ServerListening, listening.Type)
+	suite.Equal("main", listening.Name)
+	suite.Require().NotNil(listening.Addr)
+	suite.NoError(listening.Err)
+
+	app.RequireStop()
+	shutdownComplete := <-events
+	suite.Equal(ServerShutdownComplete, shutdownComplete.Type)
+	suite.Equal("main", shutdownComplete.Name)
+	suite.Equal(listening.Addr, shutdownComplete.Addr)
+	suite.NoError(shutdownComplete.Err)
+}
+
+func (suite *ServerBindingSuite) TestServeErrorObserver() {
+	var (
+		expectedErr = errors.New("expected")
+		events      = make(chan ServerEvent, 3)
+		lifecycle   = fxtest.NewLifecycle(suite.T())
+		shutdowner  = new(mockShutdowner)
+		shutdown    = make(chan struct{})
+	)
+
+	shutdowner.ExpectShutdown().Return(nil).Run(func(mock.Arguments) {
+		close(shutdown)
+	})
+
+	(&serverBinding{
+		name:       "test",
+		server:     &http.Server{ErrorLog: log.New(io.Discard, "", 0)},
+		lf:         serverListenerFactory(nil, suite.newErrorListener(expectedErr)),
+		shutdowner: shutdowner,
+		observer: ServerObserverFunc(func(e ServerEvent) {
+			events <- e
+		}),
+	}).bind(lifecycle)
+
+	lifecycle.RequireStart()
+	suite.Equal(ServerListening, (<-events).Type)
+
+	serveError := <-events
+	suite.Equal(ServerServeError, serveError.Type)
+	suite.Equal("test", serveError.Name)
+	suite.NotNil(serveError.Addr)
+	suite.Same(expectedErr, serveError.Err)
+
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		suite.Fail("The application was not shutdown")
+	}
+
+	lifecycle.RequireStop()
+}
+
+func (suite *ServerBindingSuite) TestBindServerMultipleListeners() {
+	var (
+		lifecycle  = fxtest.NewLifecycle(suite.T())
+		shutdowner = new(mockShutdowner)
+		shutdown   = make(chan struct{})
+		server     = &http.Server{
+			Handler: http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+				response.WriteHeader(299)
+			}),
+		}
+
+		addrs []string
+		more  []net.Listener
+	)
+
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		suite.Require().NoError(err)
+		addrs = append(addrs, l.Addr().String())
+		more = append(more, l)
+	}
+
+	shutdowner.ExpectShutdown().Return(nil).Run(func(mock.Arguments) {
+		close(shutdown)
+	})
+
+	BindServer(server, more[0], lifecycle, shutdowner, more[1:]...)
+	lifecycle.RequireStart()
+
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+
+	for _, addr := range addrs {
+		response, err := client.Get("http://" + addr)
+		suite.Require().NoError(err)
+		response.Body.Close()
+		suite.Equal(299, response.StatusCode)
+	}
+
+	lifecycle.RequireStop()
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		suite.Fail("The application was not shutdown")
+	}
+
+	// all listeners are shutdown together
+	for _, addr := range addrs {
+		_, err := client.Get("http://" + addr)
+		suite.Error(err)
+	}
+}
+
+func (suite *ServerBindingSuite) TestBindServerEndpointError() {
+	var (
+		expectedErr = errors.New("expected")
+		lifecycle   = fxtest.NewLifecycle(suite.T())
+		shutdowner  = new(mockShutdowner)
+		primary     net.Listener
+	)
+
+	BindServerListenerFactory(
+		&http.Server{Addr: "127.0.0.1:0"},
+		ListenerFactoryFunc(func(ctx context.Context, server *http.Server) (l net.Listener, err error) {
+			primary, err = DefaultListenerFactory{}.Listen(ctx, server)
+			return primary, err
+		}),
+		lifecycle,
+		shutdowner,
+		ListenerFactoryFunc(func(context.Context, *http.Server) (net.Listener, error) {
+			return nil, expectedErr
+		}),
+	)
+
+	suite.ErrorIs(lifecycle.Start(context.Background()), expectedErr)
+	shutdowner.AssertExpectations(suite.T())
+
+	// the listener that was created has been closed
+	suite.Require().NotNil(primary)
+	_, err := net.Dial("tcp", primary.Addr().String())
+	suite.Error(err)
+}
+
+func (suite *ServerBindingSuite) TestServeErrorOnAnyListener() {
+	var (
+		expectedErr = errors.New("expected")
+		serveErrs   = make(chan error, 1)
+		lifecycle   = fxtest.NewLifecycle(suite.T())
+		shutdowner  = new(mockShutdowner)
+		shutdown    = make(chan []fx.ShutdownOption, 1)
+	)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+
+	shutdowner.ExpectShutdown().Return(nil).Run(func(args mock.Arguments) {
+		shutdown <- args.Get(0).([]fx.ShutdownOption)
+	}).Once()
+
+	(&serverBinding{
+		server:     new(http.Server),
+		lf:         serverListenerFactory(nil, l),
+		shutdowner: shutdowner,
+		serveErrs:  serveErrs,
+		endpoints: []ListenerFactory{
+			serverListenerFactory(nil, suite.newErrorListener(expectedErr)),
+		},
+	}).bind(lifecycle)
+
+	lifecycle.RequireStart()
+	select {
+	case actualErr := <-serveErrs:
+		suite.Same(expectedErr, actualErr)
+	case <-time.After(2 * time.Second):
+		suite.Fail("No serve error was reported")
+	}
+
+	select {
+	case opts := <-shutdown:
+		suite.Equal([]fx.ShutdownOption{fx.ExitCode(ServerAbnormalExitCode)}, opts)
+	case <-time.After(2 * time.Second):
+		suite.Fail("The application was not shutdown")
+	}
+
+	lifecycle.RequireStop()
+}
+
+func (suite *ServerBindingSuite) TestProvideServerEndpoints() {
+	var (
+		events   = make(chan ServerEvent, 4)
+		observer = ServerObserverFunc(func(e ServerEvent) {
+			events <- e
+		})
+	)
+
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			fx.Annotate(
+				ServerConfig{
+					Address: "127.0.0.1:0",
+					TLS: &arrangetls.Config{
+						Certificates: arrangetls.ExternalCertificates{
+							{
+								CertificateFile: CertificateFile,
+								KeyFile:         KeyFile,
+							},
+						},
+					},
+					Endpoints: []Endpoint{
+						{Address: "127.0.0.1:0"},
+					},
+				},
+				arrange.Tags().Name("main.config").ResultTags(),
+			),
+			fx.Annotate(
+				http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+					response.WriteHeader(299)
+				}),
+				arrange.Tags().Name("main.handler").ResultTags(),
+				fx.As(new(http.Handler)),
+			),
+			fx.Annotate(
+				observer,
+				arrange.Tags().Name("main.observer").ResultTags(),
+				fx.As(new(ServerObserver)),
+			),
+		),
+		ProvideServer("main"),
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec
+			},
+		},
+	}
+
+	defer client.CloseIdleConnections()
+	for _, scheme := range []string{"https", "http"} {
+		listening := <-events
+		suite.Require().Equal(ServerListening, listening.Type)
+
+		response, err := client.Get(scheme + "://" + listening.Addr.String())
+		suite.Require().NoError(err)
+		response.Body.Close()
+		suite.Equal(299, response.StatusCode)
+	}
+}
+
+func TestServerBinding(t *testing.T) {
+	suite.Run(t, new(ServerBindingSuite))
+}
@@ -0,0 +1,113 @@
+package arrangehttp
+
+import (
+	"net"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// ServerEventType identifies the kind of lifecycle event that occurred for a server.
+type ServerEventType int
+
+const (
+	// ServerListening indicates that a server's listener has been created and the
+	// server is about to accept connections.
+	ServerListening ServerEventType = iota
+
+	// ServerServeError indicates that a server exited with an error other than
+	// http.ErrServerClosed.
+	ServerServeError
+
+	// ServerShutdownComplete indicates that a server's graceful shutdown has finished.
+	// The event's Err field holds any error returned by http.Server.Shutdown.
+	ServerShutdownComplete
+)
+
+// String returns a human-readable name for this event type.
+func (set ServerEventType) String() string {
+	switch set {
+	case ServerListening:
+		return "listening"
+
+	case ServerServeError:
+		return "serveError"
+
+	case ServerShutdownComplete:
+		return "shutdownComplete"
+
+	default:
+		return "ServerEventType(" + strconv.Itoa(int(set)) + ")"
+	}
+}
+
+// ServerEvent describes something that happened during a server's lifecycle.
+type ServerEvent struct {
+	// Type is the kind of event.
+	Type ServerEventType
+
+	// Name is the name of the server, as passed to ProvideServer.  This field
+	// will be empty for servers bound without a name.
+	Name string
+
+	// Addr is the actual network address the server is listening on.
+	Addr net.Addr
+
+	// Err is the error associated with this event, if any.
+	Err error
+}
+
+// ServerObserver receives lifecycle events for servers.  An observer can be injected into
+// ProvideServer or ProvideServerCustom to provide visibility into a server's startup and shutdown.
+type ServerObserver interface {
+	// OnServerEvent is invoked for each lifecycle event.  Implementations should not
+	// block, as events are dispatched synchronously.
+	OnServerEvent(ServerEvent)
+}
+
+// ServerObserverFunc is a closure type that implements ServerObserver.
+type ServerObserverFunc func(ServerEvent)
+
+// OnServerEvent implements ServerObserver.
+func (sof ServerObserverFunc) OnServerEvent(e ServerEvent) {
+	sof(e)
+}
+
+// ZapServerObserver is a ServerObserver that logs each event to a zap.Logger.
+type ZapServerObserver struct {
+	// Logger is the zap.Logger that receives log entries.  If this field is nil,
+	// nothing is logged.
+	Logger *zap.Logger
+}
+
+// OnServerEvent logs the given event.
+func (zso ZapServerObserver) OnServerEvent(e ServerEvent) {
+	if zso.Logger == nil {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("server", e.Name),
+	}
+
+	if e.Addr != nil {
+		fields = append(fields, zap.Stringer("address", e.Addr))
+	}
+
+	switch {
+	case e.Type == ServerListening:
+		zso.Logger.Info("server listening", fields...)
+
+	case e.Type == ServerServeError:
+		zso.Logger.Error("server exited abnormally", append(fields, zap.Error(e.Err))...)
+
+	case e.Type == ServerShutdownComplete && e.Err != nil:
+		zso.Logger.Error("server shutdown failed", append(fields, zap.Error(e.Err))...)
+
+	case e.Type == ServerShutdownComplete:
+		zso.Logger.Info("server shutdown complete", fields...)
+
+	default:
+		zso.Logger.Warn("unrecognized server event", append(fields, zap.Stringer("type", e.Type))...)
+	}
+}
@@ -0,0 +1,107 @@
+package arrangehttp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type ServerEventSuite struct {
+	suite.Suite
+}
+
+func (suite *ServerEventSuite) TestServerEventTypeString() {
+	suite.Equal("listening", ServerListening.String())
+	suite.Equal("serveError", ServerServeError.String())
+	suite.Equal("shutdownComplete", ServerShutdownComplete.String())
+	suite.Equal("ServerEventType(-1)", ServerEventType(-1).String())
+}
+
+func (suite *ServerEventSuite) TestServerObserverFunc() {
+	var (
+		expected = ServerEvent{Type: ServerListening, Name: "test"}
+		actual   ServerEvent
+	)
+
+	ServerObserverFunc(func(e ServerEvent) {
+		actual = e
+	}).OnServerEvent(expected)
+
+	suite.Equal(expected, actual)
+}
+
+func (suite *ServerEventSuite) TestZapServerObserverNilLogger() {
+	suite.NotPanics(func() {
+		ZapServerObserver{}.OnServerEvent(ServerEvent{})
+	})
+}
+
+func (suite *ServerEventSuite) TestZapServerObserver() {
+	var (
+		core, logs = observer.New(zapcore.DebugLevel)
+		zso        = ZapServerObserver{Logger: zap.New(core)}
+		addr       = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+		serveErr   = errors.New("serve error")
+	)
+
+	testCases := []struct {
+		event           ServerEvent
+		expectedLevel   zapcore.Level
+		expectedMessage string
+	}{
+		{
+			event:           ServerEvent{Type: ServerListening, Name: "main", Addr: addr},
+			expectedLevel:   zapcore.InfoLevel,
+			expectedMessage: "server listening",
+		},
+		{
+			event:           ServerEvent{Type: ServerServeError, Name: "main", Addr: addr, Err: serveErr},
+			expectedLevel:   zapcore.ErrorLevel,
+			expectedMessage: "server exited abnormally",
+		},
+		{
+			event:           ServerEvent{Type: ServerShutdownComplete, Name: "main", Addr: addr, Err: serveErr},
+			expectedLevel:   zapcore.ErrorLevel,
+			expectedMessage: "server shutdown failed",
+		},
+		{
+			event:           ServerEvent{Type: ServerShutdownComplete, Name: "main", Addr: addr},
+			expectedLevel:   zapcore.InfoLevel,
+			expectedMessage: "server shutdown complete",
+		},
+		{
+			event:           ServerEvent{Type: ServerEventType(-1), Name: "main"},
+			expectedLevel:   zapcore.WarnLevel,
+			expectedMessage: "unrecognized server event",
+		},
+	}
+
+	for _, testCase := range testCases {
+		suite.Run(testCase.expectedMessage, func() {
+			zso.OnServerEvent(testCase.event)
+			entries := logs.TakeAll()
+			suite.Require().Len(entries, 1)
+			suite.Equal(testCase.expectedLevel, entries[0].Level)
+			suite.Equal(testCase.expectedMessage, entries[0].Message)
+
+			fields := entries[0].ContextMap()
+			suite.Equal("main", fields["server"])
+			if testCase.event.Addr != nil {
+				suite.Equal(addr.String(), fields["address"])
+			}
+
+			if testCase.event.Err != nil {
+				suite.Equal(serveErr.Error(), fields["error"])
+			}
+		})
+	}
+}
+
+func TestServerEvent(t *testing.T) {
+	suite.Run(t, new(ServerEventSuite))
+}
@@ -2,11 +2,16 @@ package arrangehttp
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/xmidt-org/arrange/arrangetls"
+	"github.com/xmidt-org/httpaux"
+	"github.com/xmidt-org/httpaux/server"
+	"go.uber.org/fx"
 )
 
 // ServerFactory is the strategy for instantiating an *http.Server.  ServerConfig is this
@@ -19,18 +24,89 @@ type ServerFactory interface {
 	NewServer() (*http.Server, error)
 }
 
+// ServerMiddlewareFactory is an optional interface that a ServerFactory may implement
+// to decorate the server's handler.  NewServerCustom applies this middleware after the
+// handler has been set on the server but before any options are applied.
+//
+// ServerConfig implements this interface in order to emit its configured headers.
+type ServerMiddlewareFactory interface {
+	// NewServerMiddleware returns the middleware for the server's handler.  This method
+	// may return nil, in which case no decoration is done.
+	NewServerMiddleware() func(http.Handler) http.Handler
+}
+
+// ServerShutdownFactory is an optional interface that a ServerFactory may implement
+// to control how a server is stopped when the enclosing application stops.
+//
+// ServerConfig implements this interface using its ShutdownTimeout and DrainPeriod.
+type ServerShutdownFactory interface {
+	// NewServerShutdown returns the shutdown strategy for the server.
+	NewServerShutdown() ServerShutdown
+}
+
+// ServerLifecycleFactory is an optional interface that a ServerFactory may implement when
+// the servers it creates hold resources, such as certificate watchers, that must be bound to
+// the enclosing application's lifecycle.  ProvideServerCustom uses NewServerLifecycle rather
+// than NewServer when it is available.
+//
+// ServerConfig implements this interface so that its TLS certificates are reloaded while the
+// application runs when TLS.Reload is set.
+type ServerLifecycleFactory interface {
+	// NewServerLifecycle is like ServerFactory.NewServer, but binds any resources the server
+	// uses to the given lifecycle.
+	NewServerLifecycle(fx.Lifecycle) (*http.Server, error)
+}
+
+// ServerEndpointsFactory is an optional interface that a ServerFactory may implement
+// to have a server listen on additional endpoints alongside its primary listener.
+//
+// ServerConfig implements this interface using its Endpoints.
+type ServerEndpointsFactory interface {
+	// NewServerEndpoints returns a ListenerFactory for each additional endpoint.  This
+	// method may return an empty slice, in which case the server has only its primary listener.
+	NewServerEndpoints() []ListenerFactory
+}
+
+// ServerHandoffFactory is an optional interface that a ServerFactory may implement to create
+// a server's listeners through a Handoff, so that they survive a Handoff.Restart.  ProvideServerCustom
+// uses NewServerHandoff rather than the ServerFactory's ListenerFactory and ServerEndpointsFactory
+// implementations when a *Handoff is injected.
+//
+// ServerConfig implements this interface, naming its primary listener after the server.
+type ServerHandoffFactory interface {
+	// NewServerHandoff returns the ListenerFactory for the server's primary listener and for
+	// each of its additional endpoints.  The serverName is used to name the listeners.
+	NewServerHandoff(h *Handoff, serverName string) (ListenerFactory, []ListenerFactory)
+}
+
 // ServerConfig is the built-in ServerFactory implementation for this package.
 // This struct can be unmarshaled from an external source, or supplied literally
 // to the *fx.App.
 type ServerConfig struct {
-	// Network is the tcp network to listen on.  The default is "tcp".
+	// Network is the tcp or unix network to listen on.  The default is "tcp".
 	Network string `json:"network" yaml:"network"`
 
 	// Address is the bind address of the server.  If unset, the server binds to
 	// the first port available.  In that case, CaptureListenAddress can be used
-	// to obtain the bind address for the server.
+	// to obtain the bind address for the server.  For a unix network, this is
+	// the path of the socket file.
 	Address string `json:"address" yaml:"address"`
 
+	// UnixSocket configures the permissions and ownership of the socket file
+	// when Network is a unix network.
+	UnixSocket UnixSocket `json:"unixSocket" yaml:"unixSocket"`
+
+	// SocketActivation is the optional name of a socket passed by systemd socket activation,
+	// which is usually the server's name.  If set and the process was socket activated, the
+	// server uses that socket and ignores Network and Address.  See SystemdListenerFactory.
+	SocketActivation string `json:"socketActivation" yaml:"socketActivation"`
+
+	// Endpoints are optional additional addresses on which the server listens, each with
+	// its own network and TLS configuration.  Connection limits, accept rate limits, and
+	// PROXY protocol handling apply to the server as a whole:  the endpoints share the limits
+	// and counters of the server's primary listener.
+	Endpoints []Endpoint `json:"endpoints" yaml:"endpoints"`
+
 	// ReadTimeout corresponds to http.Server.ReadTimeout
 	ReadTimeout time.Duration `json:"readTimeout" yaml:"readTimeout"`
 
@@ -50,20 +126,53 @@ type ServerConfig struct {
 	// only used for listeners created via Listen.
 	KeepAlive time.Duration `json:"keepAlive" yaml:"keepAlive"`
 
+	// ShutdownTimeout is the maximum time to wait for a graceful shutdown of the server.
+	// If the server has not shutdown by then, it is closed forcibly.  If unset, the
+	// enclosing application's stop timeout is used.
+	ShutdownTimeout time.Duration `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+
+	// DrainPeriod is the optional grace period, prior to the graceful shutdown, during which
+	// keep-alives are disabled and the server continues to serve requests.  Note that the
+	// enclosing application's stop timeout must allow for both this period and ShutdownTimeout.
+	DrainPeriod time.Duration `json:"drainPeriod" yaml:"drainPeriod"`
+
 	// Header supplies HTTP headers to emit on every response from this server
 	Header http.Header `json:"header" yaml:"header"`
 
 	// TLS is the optional unmarshaled TLS configuration.  If set, the resulting
 	// server will use HTTPS.
 	TLS *arrangetls.Config `json:"tls" yaml:"tls"`
+
+	// ConnectionLimit optionally limits the number of concurrent connections.  Its
+	// Counters method exposes the connection counts.  See LimitConnections.
+	ConnectionLimit *ConnectionLimit `json:"connectionLimit" yaml:"connectionLimit"`
+
+	// AcceptRate optionally limits the rate of new connections from each source IP address.
+	// Its Counters method exposes the connection counts.  See LimitAcceptRate.
+	//
+	// The source address is always the peer of the network connection.  If ProxyProtocol is
+	// also set, that is the proxy rather than the client in its PROXY header, since reading the
+	// header as each connection is accepted would let a slow client stall the server.
+	AcceptRate *AcceptRateLimit `json:"acceptRate" yaml:"acceptRate"`
+
+	// ProxyProtocol optionally reads HAProxy PROXY protocol headers, so that the server sees
+	// the addresses of the clients behind a load balancer rather than the load balancer itself.
+	ProxyProtocol *ProxyProtocol `json:"proxyProtocol" yaml:"proxyProtocol"`
 }
 
 // NewServer is the built-in implementation of ServerFactory in this package.
 // This should serve most needs.  Nothing needs to be done to use this implementation.
 // By default, a Fluent Builder chain begun with Server() will use ServerConfig.
-func (sc ServerConfig) NewServer() (server *http.Server, err error) {
-	// TODO: header := httpaux.NewHeader(sc.Header)
+//
+// The TLS certificates are loaded once, even if TLS.Reload is set.  Use NewServerLifecycle
+// or ProvideServer to reload them.
+func (sc ServerConfig) NewServer() (*http.Server, error) {
+	return sc.NewServerLifecycle(nil)
+}
 
+// NewServerLifecycle is like NewServer, but binds the watcher for any reloadable TLS
+// certificates to the given lifecycle.  If lifecycle is nil, this method is equivalent to NewServer.
+func (sc ServerConfig) NewServerLifecycle(lifecycle fx.Lifecycle) (server *http.Server, err error) {
 	server = &http.Server{
 		Addr:              sc.Address,
 		ReadTimeout:       sc.ReadTimeout,
@@ -73,16 +182,153 @@ func (sc ServerConfig) NewServer() (server *http.Server, err error) {
 		MaxHeaderBytes:    sc.MaxHeaderBytes,
 	}
 
-	server.TLSConfig, err = sc.TLS.New()
+	server.TLSConfig, err = newTLSConfig(sc.TLS, lifecycle)
+	return
+}
+
+// newTLSConfig creates the *tls.Config described by an optional arrangetls.Config.  If the
+// certificates are reloadable, their watcher is bound to the lifecycle.  If lifecycle is nil,
+// the certificates are loaded once.
+func newTLSConfig(c *arrangetls.Config, lifecycle fx.Lifecycle) (*tls.Config, error) {
+	tc, cs, err := c.NewWithStore(nil)
+	if cs != nil && lifecycle != nil {
+		arrangetls.BindCertificateStore(cs, lifecycle)
+	}
+
+	return tc, err
+}
+
+// NewServerMiddleware returns middleware that sets this configuration's Header on
+// every response.  If no headers are configured, this method returns nil.
+func (sc ServerConfig) NewServerMiddleware() func(http.Handler) http.Handler {
+	header := httpaux.NewHeader(sc.Header)
+	if header.Len() == 0 {
+		return nil
+	}
+
+	return server.Header(header.SetTo)
+}
+
+// NewServerShutdown returns the ServerShutdown strategy described by this configuration.
+func (sc ServerConfig) NewServerShutdown() ServerShutdown {
+	return ServerShutdown{
+		DrainPeriod: sc.DrainPeriod,
+		Timeout:     sc.ShutdownTimeout,
+	}
+}
+
+// listenerChain returns the decorators for the network listener described by this configuration.
+func (sc ServerConfig) listenerChain() (lc ListenerChain, err error) {
+	var connectionLimit, acceptRate, proxyProtocol ListenerConstructor
+	if connectionLimit, err = sc.ConnectionLimit.NewListenerConstructor(); err != nil {
+		return
+	} else if connectionLimit != nil {
+		lc = lc.Append(connectionLimit)
+	}
+
+	if proxyProtocol, err = sc.ProxyProtocol.NewListenerConstructor(); err != nil {
+		return
+	} else if proxyProtocol != nil {
+		lc = lc.Append(proxyProtocol)
+	}
+
+	// the accept rate is checked against the network listener's own connections, so
+	// that a PROXY header is never read on the accept goroutine
+	if acceptRate, err = sc.AcceptRate.NewListenerConstructor(); err != nil {
+		return
+	} else if acceptRate != nil {
+		lc = lc.Append(acceptRate)
+	}
+
 	return
 }
 
-// Listen is the ListenerFactory implementation driven by ServerConfig
+// Listen is the ListenerFactory implementation driven by ServerConfig.  Any connection limits
+// and PROXY protocol handling are applied to the network listener, beneath TLS.
 func (sc ServerConfig) Listen(ctx context.Context, s *http.Server) (net.Listener, error) {
+	lc, err := sc.listenerChain()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := sc.listenNetwork(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return decorateListener(l, lc, s), nil
+}
+
+// listenNetwork creates the undecorated network listener for the server.  This is the
+// inherited socket named by SocketActivation if the process was socket activated.
+func (sc ServerConfig) listenNetwork(ctx context.Context, s *http.Server) (net.Listener, error) {
+	if len(sc.SocketActivation) > 0 {
+		l, activated, err := SystemdListenerFactory{Name: sc.SocketActivation}.inherit()
+		if err != nil || activated {
+			return l, err
+		}
+	}
+
 	return DefaultListenerFactory{
 		ListenConfig: net.ListenConfig{
 			KeepAlive: sc.KeepAlive,
 		},
-		Network: sc.Network,
-	}.Listen(ctx, s)
+		Network:    sc.Network,
+		UnixSocket: sc.UnixSocket,
+	}.listenNetwork(ctx, s.Addr)
+}
+
+// NewServerHandoff creates the server's listeners through the given Handoff.  The primary listener
+// is named after the server, and each endpoint is named after the server and its index, e.g.
+// "main.endpoints.0".  If no listener with a given name was passed to this process, that listener
+// is created as Listen or NewServerEndpoints would create it.
+func (sc ServerConfig) NewServerHandoff(h *Handoff, serverName string) (ListenerFactory, []ListenerFactory) {
+	lf := ListenerFactoryFunc(func(ctx context.Context, s *http.Server) (net.Listener, error) {
+		lc, err := sc.listenerChain()
+		if err != nil {
+			return nil, err
+		}
+
+		return h.factory(serverName, lc, sc.listenNetwork).Listen(ctx, s)
+	})
+
+	return lf, sc.newServerEndpoints(h, serverName)
+}
+
+// NewServerEndpoints returns a ListenerFactory for each of this configuration's Endpoints.
+// Each endpoint's listener is decorated in the same way as the listener returned by Listen,
+// and shares that listener's limits.
+func (sc ServerConfig) NewServerEndpoints() []ListenerFactory {
+	return sc.newServerEndpoints(nil, "")
+}
+
+// newServerEndpoints returns a ListenerFactory for each of this configuration's Endpoints.
+// If h is not nil, the endpoints' network listeners are created through it, named after
+// the server.
+func (sc ServerConfig) newServerEndpoints(h *Handoff, serverName string) []ListenerFactory {
+	lfs := make([]ListenerFactory, 0, len(sc.Endpoints))
+	for i, e := range sc.Endpoints {
+		var (
+			e      = e
+			name   = serverName + ".endpoints." + strconv.Itoa(i)
+			listen = e.listenNetwork(net.ListenConfig{KeepAlive: sc.KeepAlive})
+		)
+
+		lfs = append(lfs, ListenerFactoryFunc(func(ctx context.Context, s *http.Server) (net.Listener, error) {
+			lc, err := sc.listenerChain()
+			if err != nil {
+				return nil, err
+			}
+
+			if h == nil {
+				return e.listen(ctx, s, lc, listen)
+			}
+
+			return e.listen(ctx, s, lc, func(ctx context.Context, s *http.Server) (net.Listener, error) {
+				return h.listen(ctx, name, listen, s)
+			})
+		}))
+	}
+
+	return lfs
 }
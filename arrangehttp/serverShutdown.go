@@ -0,0 +1,121 @@
+package arrangehttp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// ShutdownPhase identifies a step in the shutdown of a server.
+type ShutdownPhase int
+
+const (
+	// ShutdownPhaseDrain is the optional phase where keep-alives are disabled and
+	// the server continues to serve requests for a grace period.
+	ShutdownPhaseDrain ShutdownPhase = iota
+
+	// ShutdownPhaseShutdown is the graceful shutdown via http.Server.Shutdown.
+	ShutdownPhaseShutdown
+
+	// ShutdownPhaseClose is the forced shutdown via http.Server.Close, which is only
+	// attempted when the graceful shutdown did not complete in time.
+	ShutdownPhaseClose
+)
+
+// String returns a human-readable name for this phase.
+func (sp ShutdownPhase) String() string {
+	switch sp {
+	case ShutdownPhaseDrain:
+		return "drain"
+
+	case ShutdownPhaseShutdown:
+		return "shutdown"
+
+	case ShutdownPhaseClose:
+		return "close"
+
+	default:
+		return "ShutdownPhase(" + strconv.Itoa(int(sp)) + ")"
+	}
+}
+
+// ShutdownError indicates that a particular phase of a server's shutdown failed.
+type ShutdownError struct {
+	// Phase is the shutdown phase that failed.
+	Phase ShutdownPhase
+
+	// Err is the error that occurred during the phase.
+	Err error
+}
+
+// Unwrap returns the error that caused the phase to fail.
+func (se *ShutdownError) Unwrap() error {
+	return se.Err
+}
+
+// Error describes the phase and the underlying error.
+func (se *ShutdownError) Error() string {
+	var o strings.Builder
+	o.WriteString("server ")
+	o.WriteString(se.Phase.String())
+	o.WriteString(" phase failed: ")
+	o.WriteString(se.Err.Error())
+
+	return o.String()
+}
+
+// ServerShutdown is the strategy for stopping a server.  The zero value of this type
+// performs a graceful shutdown bounded only by the context passed to Shutdown.
+type ServerShutdown struct {
+	// DrainPeriod is the optional grace period, before the graceful shutdown, during which
+	// keep-alives are disabled and the server continues to serve requests.  This gives
+	// clients a chance to move to other servers.  If unset, there is no drain phase.
+	DrainPeriod time.Duration
+
+	// Timeout is the optional maximum time to wait for http.Server.Shutdown to complete.
+	// If unset, the deadline of the context passed to Shutdown is used.
+	Timeout time.Duration
+}
+
+// Shutdown stops the given server in phases:
+//
+//   - If DrainPeriod is set, keep-alives are disabled and the server continues to serve for that period.
+//   - http.Server.Shutdown is called, bounded by Timeout if set.
+//   - If the graceful shutdown did not complete in time, http.Server.Close is called.
+//
+// The given context bounds the entire shutdown.  Each failed phase is reported as a *ShutdownError,
+// and the returned error may be an aggregate which can be inspected via go.uber.org/multierr.
+func (ss ServerShutdown) Shutdown(ctx context.Context, server *http.Server) (err error) {
+	if ss.DrainPeriod > 0 {
+		server.SetKeepAlivesEnabled(false)
+		timer := time.NewTimer(ss.DrainPeriod)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			err = &ShutdownError{Phase: ShutdownPhaseDrain, Err: ctx.Err()}
+		}
+	}
+
+	shutdownCtx := ctx
+	if ss.Timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(ctx, ss.Timeout)
+		defer cancel()
+	}
+
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		err = multierr.Append(err, &ShutdownError{Phase: ShutdownPhaseShutdown, Err: shutdownErr})
+		if shutdownCtx.Err() != nil {
+			if closeErr := server.Close(); closeErr != nil {
+				err = multierr.Append(err, &ShutdownError{Phase: ShutdownPhaseClose, Err: closeErr})
+			}
+		}
+	}
+
+	return
+}
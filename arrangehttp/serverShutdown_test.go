@@ -0,0 +1,178 @@
+package arrangehttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/multierr"
+)
+
+type ServerShutdownSuite struct {
+	suite.Suite
+
+	url     string
+	server  *http.Server
+	served  chan error
+	block   chan struct{}
+	blocked chan struct{}
+}
+
+func (suite *ServerShutdownSuite) SetupTest() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+
+	var (
+		served  = make(chan error, 1)
+		block   = make(chan struct{})
+		blocked = make(chan struct{}, 1)
+		server  = &http.Server{
+			Handler: http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				if request.URL.Path == "/block" {
+					blocked <- struct{}{}
+					<-block
+				}
+
+				response.WriteHeader(299)
+			}),
+		}
+	)
+
+	suite.url = "http://" + listener.Addr().String()
+	suite.served = served
+	suite.block = block
+	suite.blocked = blocked
+	suite.server = server
+
+	go func() {
+		served <- server.Serve(listener)
+	}()
+}
+
+func (suite *ServerShutdownSuite) TearDownTest() {
+	close(suite.block)
+	suite.server.Close()
+}
+
+// startBlockedRequest starts a request that will not complete until the test ends,
+// and returns a channel that receives the request's error.
+func (suite *ServerShutdownSuite) startBlockedRequest() <-chan error {
+	var (
+		result = make(chan error, 1)
+		url    = suite.url + "/block"
+	)
+
+	go func() {
+		response, err := http.Get(url)
+		if err == nil {
+			response.Body.Close()
+		}
+
+		result <- err
+	}()
+
+	select {
+	case <-suite.blocked:
+	case <-time.After(2 * time.Second):
+		suite.Require().Fail("The blocking request did not reach the server")
+	}
+
+	return result
+}
+
+func (suite *ServerShutdownSuite) TestShutdownPhaseString() {
+	suite.Equal("drain", ShutdownPhaseDrain.String())
+	suite.Equal("shutdown", ShutdownPhaseShutdown.String())
+	suite.Equal("close", ShutdownPhaseClose.String())
+	suite.Equal("ShutdownPhase(-1)", ShutdownPhase(-1).String())
+}
+
+func (suite *ServerShutdownSuite) TestShutdownError() {
+	var (
+		cause = errors.New("cause")
+		err   = &ShutdownError{Phase: ShutdownPhaseClose, Err: cause}
+	)
+
+	suite.ErrorIs(err, cause)
+	suite.Equal("server close phase failed: cause", err.Error())
+}
+
+func (suite *ServerShutdownSuite) TestDefault() {
+	suite.NoError(ServerShutdown{}.Shutdown(context.Background(), suite.server))
+	suite.ErrorIs(<-suite.served, http.ErrServerClosed)
+}
+
+func (suite *ServerShutdownSuite) TestDrain() {
+	done := make(chan error, 1)
+	go func() {
+		done <- ServerShutdown{DrainPeriod: 500 * time.Millisecond}.Shutdown(context.Background(), suite.server)
+	}()
+
+	// the server should continue to serve, but without keep-alives
+	suite.Eventually(
+		func() bool {
+			response, err := http.Get(suite.url)
+			if err != nil {
+				return false
+			}
+
+			response.Body.Close()
+			return response.StatusCode == 299 && response.Close
+		},
+		time.Second,
+		10*time.Millisecond,
+	)
+
+	select {
+	case err := <-done:
+		suite.NoError(err)
+	case <-time.After(2 * time.Second):
+		suite.Fail("Shutdown did not complete after the drain period")
+	}
+
+	suite.ErrorIs(<-suite.served, http.ErrServerClosed)
+}
+
+func (suite *ServerShutdownSuite) TestDrainCanceled() {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := ServerShutdown{DrainPeriod: time.Hour}.Shutdown(ctx, suite.server)
+	suite.Require().Error(err)
+
+	var se *ShutdownError
+	suite.Require().ErrorAs(err, &se)
+	suite.Equal(ShutdownPhaseDrain, se.Phase)
+	suite.ErrorIs(se, context.DeadlineExceeded)
+}
+
+func (suite *ServerShutdownSuite) TestTimeout() {
+	requestErr := suite.startBlockedRequest()
+
+	err := ServerShutdown{Timeout: 100 * time.Millisecond}.Shutdown(context.Background(), suite.server)
+	suite.Require().Error(err)
+
+	errs := multierr.Errors(err)
+	suite.Require().Len(errs, 1)
+
+	var se *ShutdownError
+	suite.Require().ErrorAs(errs[0], &se)
+	suite.Equal(ShutdownPhaseShutdown, se.Phase)
+	suite.ErrorIs(se, context.DeadlineExceeded)
+
+	// the fallback to Close should have terminated the in-flight request
+	select {
+	case err := <-requestErr:
+		suite.Error(err)
+	case <-time.After(2 * time.Second):
+		suite.Fail("The in-flight request was not terminated")
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	suite.Run(t, new(ServerShutdownSuite))
+}
@@ -1,10 +1,16 @@
 package arrangehttp
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange"
+	"github.com/xmidt-org/arrange/arrangetls"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxtest"
 )
@@ -80,6 +86,93 @@ func (suite *ServerSuite) TestNewServer() {
 	suite.Equal(":1234", server.Addr)
 }
 
+func (suite *ServerSuite) TestNewServerHeader() {
+	server, err := NewServer(
+		ServerConfig{
+			Header: http.Header{
+				"X-Content-Type-Options": {"nosniff"},
+				"X-Multi":                {"1", "2"},
+				"x-overridden":           {"configured"},
+			},
+		},
+		http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.Header().Set("X-Overridden", "handler")
+			response.WriteHeader(299)
+		}),
+	)
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(server)
+
+	response := httptest.NewRecorder()
+	server.Handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	suite.Equal(299, response.Code)
+	suite.Equal([]string{"nosniff"}, response.Result().Header["X-Content-Type-Options"])
+	suite.Equal([]string{"1", "2"}, response.Result().Header["X-Multi"])
+	suite.Equal([]string{"handler"}, response.Result().Header["X-Overridden"])
+}
+
+func (suite *ServerSuite) TestNewServerNoHeader() {
+	handler := http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(299)
+	})
+
+	server, err := NewServer(ServerConfig{}, handler)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(server)
+
+	response := httptest.NewRecorder()
+	server.Handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	suite.Equal(299, response.Code)
+	suite.Empty(response.Result().Header)
+}
+
+func (suite *ServerSuite) TestServerConfigNewServerShutdown() {
+	suite.Equal(
+		ServerShutdown{
+			DrainPeriod: 5 * time.Second,
+			Timeout:     10 * time.Second,
+		},
+		ServerConfig{
+			DrainPeriod:     5 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+		}.NewServerShutdown(),
+	)
+}
+
+func (suite *ServerSuite) TestServerConfigNewServerLifecycle() {
+	sc := ServerConfig{
+		TLS: &arrangetls.Config{
+			Certificates: arrangetls.ExternalCertificates{
+				{
+					CertificateFile: CertificateFile,
+					KeyFile:         KeyFile,
+				},
+			},
+		},
+	}
+
+	// without reloading, there is nothing to bind
+	lifecycle := new(hookLifecycle)
+	server, err := sc.NewServerLifecycle(lifecycle)
+	suite.Require().NoError(err)
+	suite.NotNil(server.TLSConfig)
+	suite.Empty(lifecycle.hooks)
+
+	sc.TLS.Reload = &arrangetls.ReloadConfig{Interval: time.Hour}
+	server, err = sc.NewServerLifecycle(lifecycle)
+	suite.Require().NoError(err)
+	suite.NotNil(server.TLSConfig)
+	suite.Require().Len(lifecycle.hooks, 1)
+	suite.NoError(lifecycle.hooks[0].OnStart(context.Background()))
+	suite.NoError(lifecycle.hooks[0].OnStop(context.Background()))
+
+	// NewServer loads the certificates without a watcher
+	server, err = sc.NewServer()
+	suite.Require().NoError(err)
+	suite.NotNil(server.TLSConfig)
+}
+
 func (suite *ServerSuite) TestProvideServer() {
 	app := fxtest.New(
 		suite.T(),
@@ -90,6 +183,81 @@ func (suite *ServerSuite) TestProvideServer() {
 	app.RequireStop()
 }
 
+func (suite *ServerSuite) TestProvideServerListenerConstructors() {
+	var (
+		address = make(chan net.Addr, 1)
+		server  *http.Server
+	)
+
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			fx.Annotate(
+				ServerConfig{
+					Address: "127.0.0.1:0",
+				},
+				arrange.Tags().Name("main.config").ResultTags(),
+			),
+			fx.Annotate(
+				http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+					response.WriteHeader(299)
+				}),
+				arrange.Tags().Name("main.handler").ResultTags(),
+				fx.As(new(http.Handler)),
+			),
+			fx.Annotate(
+				CaptureListenAddress(address),
+				arrange.Tags().Group("main.listener.constructors").ResultTags(),
+			),
+		),
+		ProvideServer("main"),
+		fx.Populate(
+			fx.Annotate(
+				&server,
+				arrange.Tags().Name("main").ParamTags(),
+			),
+		),
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+	suite.Require().NotNil(server)
+
+	var listenAddr net.Addr
+	select {
+	case listenAddr = <-address:
+	default:
+		suite.Require().Fail("No listen address was captured")
+	}
+
+	response, err := http.Get("http://" + listenAddr.String())
+	suite.Require().NoError(err)
+	response.Body.Close()
+	suite.Equal(299, response.StatusCode)
+}
+
+func (suite *ServerSuite) TestProvideServerBindError() {
+	existing, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer existing.Close()
+
+	app := fx.New(
+		fx.NopLogger,
+		fx.Supply(
+			fx.Annotate(
+				ServerConfig{
+					Address: existing.Addr().String(),
+				},
+				arrange.Tags().Name("main.config").ResultTags(),
+			),
+		),
+		ProvideServer("main"),
+	)
+
+	suite.Require().NoError(app.Err())
+	suite.Error(app.Start(context.Background()))
+}
+
 func TestServer(t *testing.T) {
 	suite.Run(t, new(ServerSuite))
 }
@@ -0,0 +1,180 @@
+package arrangehttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// SystemdListenFDsStart is the first file descriptor passed by systemd socket activation.
+	SystemdListenFDsStart = 3
+
+	// unknownFDName is the name systemd gives a socket without a FileDescriptorName.
+	unknownFDName = "unknown"
+)
+
+var (
+	// ErrNotSocketActivated indicates that a SystemdListenerFactory with no Fallback was used
+	// in a process that systemd did not start with socket activation.
+	ErrNotSocketActivated = errors.New("The process was not started with systemd socket activation")
+
+	// ErrListenerAdopted indicates that an inherited socket was requested after it had
+	// already been adopted.
+	ErrListenerAdopted = errors.New("The inherited socket has already been adopted")
+)
+
+// adopted tracks the inherited file descriptors that have been adopted.  Adopting a
+// descriptor closes it, so the same number may later refer to an unrelated file.
+var adopted struct {
+	lock sync.Mutex
+	fds  map[int]bool
+}
+
+// InheritedListenerError indicates that no inherited socket had the requested name.
+type InheritedListenerError struct {
+	// Name is the requested socket name.
+	Name string
+
+	// Available are the names of the sockets that were inherited.
+	Available []string
+}
+
+// Error satisfies the error interface.
+func (ile *InheritedListenerError) Error() string {
+	return "No inherited socket named " + strconv.Quote(ile.Name) +
+		" among [" + strings.Join(ile.Available, ", ") + "]"
+}
+
+// systemdSockets returns the names of the sockets passed to this process via
+// LISTEN_PID, LISTEN_FDS, and LISTEN_FDNAMES.  If the process was not socket
+// activated, this function returns false.
+func systemdSockets() (names []string, activated bool, err error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		// either unset, or intended for some other process
+		return nil, false, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return nil, false, errors.New("Invalid LISTEN_FDS: " + strconv.Quote(os.Getenv("LISTEN_FDS")))
+	}
+
+	if fdNames := os.Getenv("LISTEN_FDNAMES"); len(fdNames) > 0 {
+		names = strings.Split(fdNames, ":")
+	}
+
+	for len(names) < count {
+		names = append(names, unknownFDName)
+	}
+
+	return names[:count], true, nil
+}
+
+// SystemdListenerFactory is a ListenerFactory that adopts a listening socket passed by
+// systemd socket activation.  The socket is chosen by Name, which is matched against the
+// FileDescriptorName of the systemd socket unit.  By convention, this is the server's name.
+// The zero value of this type adopts the only inherited socket.
+//
+// Each inherited socket can be adopted once.  Subsequent attempts to adopt it return
+// ErrListenerAdopted.
+type SystemdListenerFactory struct {
+	// Name is the name of the inherited socket.  If unset, exactly one socket must have been passed.
+	Name string
+
+	// Fallback is the optional ListenerFactory used when the process was not socket activated.
+	// If unset, Listen returns ErrNotSocketActivated in that case.
+	Fallback ListenerFactory
+
+	// ListenerChain is the optional set of decorators applied to the inherited listener
+	// before any TLS listener.  It is not applied to a listener from the Fallback.
+	ListenerChain ListenerChain
+}
+
+// Listen adopts the inherited socket.  If the server has a TLS configuration, the returned
+// listener creates TLS connections.
+func (f SystemdListenerFactory) Listen(ctx context.Context, server *http.Server) (net.Listener, error) {
+	l, activated, err := f.inherit()
+	switch {
+	case err != nil:
+		return nil, err
+
+	case !activated && f.Fallback != nil:
+		return f.Fallback.Listen(ctx, server)
+
+	case !activated:
+		return nil, ErrNotSocketActivated
+	}
+
+	return decorateListener(l, f.ListenerChain, server), nil
+}
+
+// inherit adopts the inherited socket without decorating it.  If the process was not
+// socket activated, this method returns false.
+func (f SystemdListenerFactory) inherit() (net.Listener, bool, error) {
+	names, activated, err := systemdSockets()
+	if err != nil || !activated {
+		return nil, activated, err
+	}
+
+	index := -1
+	if len(f.Name) == 0 && len(names) == 1 {
+		index = 0
+	} else if len(f.Name) > 0 {
+		for i, name := range names {
+			if name == f.Name {
+				index = i
+				break
+			}
+		}
+	}
+
+	if index < 0 {
+		return nil, true, &InheritedListenerError{
+			Name:      f.Name,
+			Available: names,
+		}
+	}
+
+	l, err := adoptListener(SystemdListenFDsStart+index, names[index])
+	return l, true, err
+}
+
+// claimInherited takes ownership of an inherited file descriptor.  A descriptor can only
+// be claimed once, even if using it fails afterward.
+func claimInherited(fd int, name string) (*os.File, error) {
+	adopted.lock.Lock()
+	defer adopted.lock.Unlock()
+	if adopted.fds[fd] {
+		return nil, ErrListenerAdopted
+	} else if adopted.fds == nil {
+		adopted.fds = make(map[int]bool)
+	}
+
+	adopted.fds[fd] = true
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, errors.New("Invalid file descriptor for inherited socket " + strconv.Quote(name))
+	}
+
+	return f, nil
+}
+
+// adoptListener creates a net.Listener from an inherited file descriptor.  The original
+// descriptor is closed, since net.FileListener uses a duplicate.  A descriptor can only
+// be adopted once, even if adopting it failed.
+func adoptListener(fd int, name string) (net.Listener, error) {
+	f, err := claimInherited(fd, name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return net.FileListener(f)
+}
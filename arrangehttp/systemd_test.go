@@ -0,0 +1,213 @@
+//go:build unix
+
+package arrangehttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const systemdHelperName = "systemd"
+
+func init() {
+	testHelpers[systemdHelperName] = runSystemdHelper
+}
+
+// runSystemdHelper serves HTTP on an inherited socket, identified by the SOCKET_NAME
+// environment variable.  Each response is the socket name.
+func runSystemdHelper() int {
+	// systemd sets LISTEN_PID after forking, which a parent test cannot do
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	name := os.Getenv("SOCKET_NAME")
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			io.WriteString(response, name) //nolint:errcheck
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+
+	l, err := SystemdListenerFactory{Name: name}.Listen(context.Background(), server)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	server.Serve(l) //nolint:errcheck
+	return 0
+}
+
+// forgetAdopted allows a test to adopt a file descriptor number that an earlier
+// test adopted and closed.
+func forgetAdopted(fd int) {
+	adopted.lock.Lock()
+	defer adopted.lock.Unlock()
+	delete(adopted.fds, fd)
+}
+
+type SystemdSuite struct {
+	suite.Suite
+}
+
+func (suite *SystemdSuite) setActivated(fds, names string) {
+	suite.T().Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	suite.T().Setenv("LISTEN_FDS", fds)
+	suite.T().Setenv("LISTEN_FDNAMES", names)
+}
+
+func (suite *SystemdSuite) TestNotActivated() {
+	suite.T().Setenv("LISTEN_PID", "")
+	l, err := SystemdListenerFactory{}.Listen(context.Background(), &http.Server{})
+	suite.ErrorIs(err, ErrNotSocketActivated)
+	suite.Nil(l)
+
+	// intended for another process
+	suite.T().Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	suite.T().Setenv("LISTEN_FDS", "1")
+	l, err = SystemdListenerFactory{
+		Fallback: DefaultListenerFactory{},
+	}.Listen(context.Background(), &http.Server{Addr: "127.0.0.1:0"})
+
+	suite.Require().NoError(err)
+	suite.IsType((*net.TCPListener)(nil), l)
+	l.Close()
+}
+
+func (suite *SystemdSuite) TestInvalidFDs() {
+	suite.setActivated("bad", "")
+	_, err := SystemdListenerFactory{}.Listen(context.Background(), &http.Server{})
+	suite.Error(err)
+}
+
+func (suite *SystemdSuite) TestNoSuchName() {
+	suite.setActivated("2", "main")
+	_, err := SystemdListenerFactory{Name: "metrics"}.Listen(context.Background(), &http.Server{})
+
+	var ile *InheritedListenerError
+	suite.Require().ErrorAs(err, &ile)
+	suite.Equal("metrics", ile.Name)
+	suite.Equal([]string{"main", unknownFDName}, ile.Available)
+	suite.Contains(ile.Error(), "metrics")
+
+	// without a name, there must be exactly one socket
+	_, err = SystemdListenerFactory{}.Listen(context.Background(), &http.Server{})
+	suite.ErrorAs(err, &ile)
+}
+
+func (suite *SystemdSuite) TestAdoptOnce() {
+	original, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer original.Close()
+
+	f, err := original.(*net.TCPListener).File()
+	suite.Require().NoError(err)
+
+	// adopting takes ownership of the descriptor, so it must not belong to an *os.File
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	suite.Require().NoError(err)
+	defer forgetAdopted(fd)
+
+	l, err := adoptListener(fd, "main")
+	suite.Require().NoError(err)
+	defer l.Close()
+	suite.Equal(original.Addr().String(), l.Addr().String())
+
+	again, err := adoptListener(fd, "main")
+	suite.ErrorIs(err, ErrListenerAdopted)
+	suite.Nil(again)
+}
+
+func (suite *SystemdSuite) TestServerConfigFallback() {
+	suite.T().Setenv("LISTEN_PID", "")
+	sc := ServerConfig{
+		Address:          "127.0.0.1:0",
+		SocketActivation: "main",
+	}
+
+	l, err := sc.Listen(context.Background(), &http.Server{Addr: sc.Address})
+	suite.Require().NoError(err)
+	suite.IsType((*net.TCPListener)(nil), l)
+	l.Close()
+}
+
+func (suite *SystemdSuite) TestEndpoint() {
+	suite.T().Setenv("LISTEN_PID", "")
+	e := Endpoint{
+		Address:          "127.0.0.1:0",
+		SocketActivation: "metrics",
+	}
+
+	l, err := e.Listen(context.Background(), new(http.Server))
+	suite.Require().NoError(err)
+	suite.IsType((*net.TCPListener)(nil), l)
+	l.Close()
+
+	suite.setActivated("1", "main")
+	l, err = e.Listen(context.Background(), new(http.Server))
+
+	var ile *InheritedListenerError
+	suite.Require().ErrorAs(err, &ile)
+	suite.Equal("metrics", ile.Name)
+	suite.Nil(l)
+}
+
+func (suite *SystemdSuite) TestActivation() {
+	var (
+		files []*os.File
+		addrs []string
+	)
+
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		suite.Require().NoError(err)
+		defer l.Close()
+
+		f, err := l.(*net.TCPListener).File()
+		suite.Require().NoError(err)
+		defer f.Close()
+
+		files = append(files, f)
+		addrs = append(addrs, l.Addr().String())
+	}
+
+	cmd := exec.Command(os.Args[0]) //nolint:gosec
+	cmd.Env = append(os.Environ(),
+		testHelperEnv+"="+systemdHelperName,
+		"SOCKET_NAME=metrics",
+		"LISTEN_FDS=2",
+		"LISTEN_FDNAMES=main:metrics",
+	)
+
+	cmd.ExtraFiles = files
+	cmd.Stderr = os.Stderr
+	suite.Require().NoError(cmd.Start())
+	defer func() {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+	}()
+
+	// the child accepts connections on the listener the parent created
+	response, err := http.Get("http://" + addrs[1])
+	suite.Require().NoError(err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	suite.Require().NoError(err)
+	suite.Equal("metrics", string(body))
+}
+
+func TestSystemd(t *testing.T) {
+	suite.Run(t, new(SystemdSuite))
+}
@@ -0,0 +1,140 @@
+package arrangehttp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// staleSocketTimeout is how long to wait when probing an existing socket file.
+	staleSocketTimeout = time.Second
+)
+
+// isUnixNetwork tests if a network is a unix domain socket network.
+func isUnixNetwork(network string) bool {
+	return network == "unix" || network == "unixpacket"
+}
+
+// isAbstractSocket tests if a unix address is in the Linux abstract namespace,
+// in which case there is no socket file.
+func isAbstractSocket(address string) bool {
+	return strings.HasPrefix(address, "@")
+}
+
+// UnixSocket describes the socket file created when a server listens on a unix network.
+// The zero value leaves the socket file as the operating system creates it.
+//
+// Before listening, a socket file left at the same path by a process that exited without
+// removing it is deleted.  A socket file that is still accepting connections, or any other
+// kind of file, is never deleted.
+type UnixSocket struct {
+	// Mode is the permission bits of the socket file, e.g. 0660.  If unset, the permissions
+	// are determined by the process's umask.
+	Mode os.FileMode `json:"mode" yaml:"mode"`
+
+	// User is the owner of the socket file, either a user name or a numeric user id.
+	// If unset, the owner is not changed.
+	User string `json:"user" yaml:"user"`
+
+	// Group is the group of the socket file, either a group name or a numeric group id.
+	// If unset, the group is not changed.
+	Group string `json:"group" yaml:"group"`
+}
+
+// lookupID returns the numeric id for a user or group, which may already be numeric.
+// An empty name results in -1, which leaves the owner or group unchanged.
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if len(name) == 0 {
+		return -1, nil
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+func lookupUser(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+
+	return u.Uid, nil
+}
+
+func lookupGroup(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+
+	return g.Gid, nil
+}
+
+// removeStale deletes a socket file at path if nothing is accepting connections on it.
+func (us UnixSocket) removeStale(network, path string) error {
+	if isAbstractSocket(path) {
+		return nil
+	}
+
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		// let the subsequent listen report the problem
+		return err
+	}
+
+	c, err := net.DialTimeout(network, path, staleSocketTimeout)
+	if err == nil {
+		// the socket is in use, so the subsequent listen will fail
+		c.Close()
+		return nil
+	} else if errors.Is(err, syscall.ECONNREFUSED) {
+		return os.Remove(path)
+	}
+
+	return nil
+}
+
+// apply sets the permissions and ownership of the socket file at path.
+func (us UnixSocket) apply(path string) error {
+	if isAbstractSocket(path) {
+		return nil
+	}
+
+	if us.Mode != 0 {
+		if err := os.Chmod(path, us.Mode.Perm()); err != nil {
+			return err
+		}
+	}
+
+	uid, err := lookupID(us.User, lookupUser)
+	if err != nil {
+		return err
+	}
+
+	gid, err := lookupID(us.Group, lookupGroup)
+	if err != nil {
+		return err
+	}
+
+	if uid >= 0 || gid >= 0 {
+		return os.Chown(path, uid, gid)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+//go:build unix
+
+package arrangehttp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type UnixSocketSuite struct {
+	suite.Suite
+
+	path string
+}
+
+func (suite *UnixSocketSuite) SetupTest() {
+	// socket paths have a short maximum length, so avoid the long test temp directory
+	dir, err := os.MkdirTemp("", "arrange")
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { os.RemoveAll(dir) })
+	suite.path = filepath.Join(dir, "test.sock")
+}
+
+func (suite *UnixSocketSuite) listen(us UnixSocket) (net.Listener, error) {
+	return DefaultListenerFactory{
+		Network:    "unix",
+		UnixSocket: us,
+	}.Listen(context.Background(), &http.Server{Addr: suite.path})
+}
+
+func (suite *UnixSocketSuite) TestServe() {
+	sc := ServerConfig{
+		Network: "unix",
+		Address: suite.path,
+		UnixSocket: UnixSocket{
+			Mode: 0600,
+		},
+	}
+
+	server, err := sc.NewServer()
+	suite.Require().NoError(err)
+	server.Handler = http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		io.WriteString(response, "unix") //nolint:errcheck
+	})
+
+	l, err := sc.Listen(context.Background(), server)
+	suite.Require().NoError(err)
+	go server.Serve(l) //nolint:errcheck
+
+	fi, err := os.Stat(suite.path)
+	suite.Require().NoError(err)
+	suite.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return new(net.Dialer).DialContext(ctx, "unix", suite.path)
+			},
+		},
+	}
+
+	defer client.CloseIdleConnections()
+	response, err := client.Get("http://localhost/")
+	suite.Require().NoError(err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	suite.Require().NoError(err)
+	suite.Equal("unix", string(body))
+
+	suite.NoError(server.Close())
+	suite.NoFileExists(suite.path)
+}
+
+func (suite *UnixSocketSuite) TestRemoveStale() {
+	stale, err := net.Listen("unix", suite.path)
+	suite.Require().NoError(err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	suite.FileExists(suite.path)
+
+	l, err := suite.listen(UnixSocket{})
+	suite.Require().NoError(err)
+	l.Close()
+}
+
+func (suite *UnixSocketSuite) TestInUse() {
+	active, err := net.Listen("unix", suite.path)
+	suite.Require().NoError(err)
+	defer active.Close()
+
+	l, err := suite.listen(UnixSocket{})
+	suite.Error(err)
+	suite.Nil(l)
+	suite.FileExists(suite.path)
+}
+
+func (suite *UnixSocketSuite) TestNotASocket() {
+	suite.Require().NoError(os.WriteFile(suite.path, []byte("important"), 0600))
+
+	l, err := suite.listen(UnixSocket{})
+	suite.Error(err)
+	suite.Nil(l)
+
+	contents, err := os.ReadFile(suite.path)
+	suite.Require().NoError(err)
+	suite.Equal("important", string(contents))
+}
+
+func (suite *UnixSocketSuite) TestOwnership() {
+	current, err := user.Current()
+	suite.Require().NoError(err)
+
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		group = &user.Group{Gid: current.Gid, Name: current.Gid}
+	}
+
+	for _, us := range []UnixSocket{
+		{User: current.Uid, Group: current.Gid},
+		{User: current.Username, Group: group.Name},
+	} {
+		l, err := suite.listen(us)
+		suite.Require().NoError(err)
+
+		fi, err := os.Stat(suite.path)
+		suite.Require().NoError(err)
+		suite.NotZero(fi.Mode() & os.ModeSocket)
+		l.Close()
+	}
+}
+
+func (suite *UnixSocketSuite) TestOwnershipError() {
+	for _, us := range []UnixSocket{
+		{User: "no such user for arrange tests"},
+		{Group: "no such group for arrange tests"},
+	} {
+		l, err := suite.listen(us)
+		suite.Error(err)
+		suite.Nil(l)
+		suite.NoFileExists(suite.path)
+	}
+}
+
+func (suite *UnixSocketSuite) TestLookupID() {
+	id, err := lookupID("", lookupUser)
+	suite.NoError(err)
+	suite.Equal(-1, id)
+
+	id, err = lookupID("1234", lookupUser)
+	suite.NoError(err)
+	suite.Equal(1234, id)
+
+	current, err := user.Current()
+	suite.Require().NoError(err)
+	expected, err := strconv.Atoi(current.Uid)
+	suite.Require().NoError(err)
+
+	id, err = lookupID(current.Username, lookupUser)
+	suite.NoError(err)
+	suite.Equal(expected, id)
+}
+
+func TestUnixSocket(t *testing.T) {
+	suite.Run(t, new(UnixSocketSuite))
+}
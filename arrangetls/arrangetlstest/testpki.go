@@ -0,0 +1,411 @@
+// Package arrangetlstest provides a test public key infrastructure for exercising TLS
+// code.  Its helpers report errors through a testing.TB, so this package belongs only in tests.
+package arrangetlstest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/arrange/arrangetls"
+)
+
+// KeyType identifies the kind of key pair generated for a test certificate.
+type KeyType int
+
+const (
+	// KeyTypeECDSA is an ECDSA P-256 key.  This is the default, as it is fast to generate.
+	KeyTypeECDSA KeyType = iota
+
+	// KeyTypeRSA is a 2048-bit RSA key.
+	KeyTypeRSA
+
+	// KeyTypeEd25519 is an Ed25519 key.
+	KeyTypeEd25519
+)
+
+// String returns a human-readable name for this key type.
+func (kt KeyType) String() string {
+	switch kt {
+	case KeyTypeECDSA:
+		return "ECDSA"
+
+	case KeyTypeRSA:
+		return "RSA"
+
+	case KeyTypeEd25519:
+		return "Ed25519"
+
+	default:
+		return fmt.Sprintf("KeyType(%d)", int(kt))
+	}
+}
+
+// generateKey creates a new private key of this type.
+func (kt KeyType) generateKey() (crypto.Signer, error) {
+	switch kt {
+	case KeyTypeECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	case KeyTypeRSA:
+		return rsa.GenerateKey(rand.Reader, 2048)
+
+	case KeyTypeEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+
+	default:
+		return nil, fmt.Errorf("Unsupported key type: %s", kt)
+	}
+}
+
+// certificateConfig holds the state that TestCertificateOptions modify.
+type certificateConfig struct {
+	template *x509.Certificate
+	keyType  KeyType
+	err      error
+}
+
+// Option tailors a certificate issued by a PKI.
+type Option func(*certificateConfig)
+
+// WithKeyType sets the type of key pair generated for the certificate.
+func WithKeyType(kt KeyType) Option {
+	return func(tcc *certificateConfig) {
+		tcc.keyType = kt
+	}
+}
+
+// WithDNSNames adds DNS SANs to the certificate.
+func WithDNSNames(names ...string) Option {
+	return func(tcc *certificateConfig) {
+		tcc.template.DNSNames = append(tcc.template.DNSNames, names...)
+	}
+}
+
+// WithIPAddresses adds IP SANs to the certificate.  Each address must parse with net.ParseIP.
+func WithIPAddresses(addresses ...string) Option {
+	return func(tcc *certificateConfig) {
+		for _, a := range addresses {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				tcc.err = fmt.Errorf("Invalid IP address: %s", a)
+				return
+			}
+
+			tcc.template.IPAddresses = append(tcc.template.IPAddresses, ip)
+		}
+	}
+}
+
+// WithURIs adds URI SANs, such as SPIFFE IDs, to the certificate.
+func WithURIs(uris ...string) Option {
+	return func(tcc *certificateConfig) {
+		for _, u := range uris {
+			parsed, err := url.Parse(u)
+			if err != nil {
+				tcc.err = err
+				return
+			}
+
+			tcc.template.URIs = append(tcc.template.URIs, parsed)
+		}
+	}
+}
+
+// WithValidity sets the validity period of the certificate.
+func WithValidity(notBefore, notAfter time.Time) Option {
+	return func(tcc *certificateConfig) {
+		tcc.template.NotBefore = notBefore
+		tcc.template.NotAfter = notAfter
+	}
+}
+
+// Expired produces a certificate whose validity period ended a day ago.
+func Expired() Option {
+	now := time.Now()
+	return WithValidity(now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+}
+
+// NotYetValid produces a certificate whose validity period begins a day from now.
+func NotYetValid() Option {
+	now := time.Now()
+	return WithValidity(now.Add(24*time.Hour), now.Add(48*time.Hour))
+}
+
+// WithTemplate allows arbitrary changes to the x509 template before the certificate
+// is created.  Options are applied in the order given, so a WithTemplate only sees the
+// changes made by the options before it, and later options can override its changes.
+// Key usages appropriate to the certificate are added after all options have run.
+func WithTemplate(f func(*x509.Certificate)) Option {
+	return func(tcc *certificateConfig) {
+		f(tcc.template)
+	}
+}
+
+// PKI is a test public key infrastructure:  a root CA from which intermediates,
+// server leaves, and client leaves can be issued.  Every certificate's files are written
+// to a temporary directory that is removed when the test completes.
+//
+// Any error fails the test immediately, so none of the methods return errors.
+type PKI struct {
+	t      testing.TB
+	dir    string
+	serial int64
+	root   *Certificate
+}
+
+// NewPKI creates a PKI with a self-signed root CA named "Test Root CA".  The options
+// apply to the root.
+func NewPKI(t testing.TB, options ...Option) *PKI {
+	t.Helper()
+	pki := &PKI{
+		t:   t,
+		dir: t.TempDir(),
+	}
+
+	pki.root = pki.issue(nil, "Test Root CA", true, nil, options)
+	return pki
+}
+
+// Dir returns the temporary directory where this PKI's files are written.
+func (pki *PKI) Dir() string {
+	return pki.dir
+}
+
+// Root returns the root CA of this PKI.
+func (pki *PKI) Root() *Certificate {
+	return pki.root
+}
+
+// Pool returns a cert pool containing the root CA, suitable for tls.Config.RootCAs or ClientCAs.
+func (pki *PKI) Pool() *x509.CertPool {
+	return pki.root.Pool()
+}
+
+// issue creates a certificate signed by parent, or self-signed if parent is nil.
+func (pki *PKI) issue(parent *Certificate, commonName string, isCA bool, extKeyUsage []x509.ExtKeyUsage, options []Option) *Certificate {
+	pki.t.Helper()
+	pki.serial++
+	now := time.Now()
+	tcc := certificateConfig{
+		template: &x509.Certificate{
+			SerialNumber:          big.NewInt(pki.serial),
+			Subject:               pkix.Name{CommonName: commonName},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(24 * time.Hour),
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+			ExtKeyUsage:           extKeyUsage,
+		},
+	}
+
+	for _, o := range options {
+		o(&tcc)
+	}
+
+	if tcc.err != nil {
+		pki.t.Fatalf("Unable to configure test certificate %s: %s", commonName, tcc.err)
+	}
+
+	key, err := tcc.keyType.generateKey()
+	if err != nil {
+		pki.t.Fatalf("Unable to generate key for test certificate %s: %s", commonName, err)
+	}
+
+	template := tcc.template
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.KeyUsage |= x509.KeyUsageDigitalSignature
+		if _, ok := key.(*rsa.PrivateKey); ok {
+			template.KeyUsage |= x509.KeyUsageKeyEncipherment
+		}
+	}
+
+	signer, signerCert := key, template
+	if parent != nil {
+		signer, signerCert = parent.Key, parent.Certificate
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, key.Public(), signer)
+	if err == nil {
+		template, err = x509.ParseCertificate(der)
+	}
+
+	if err != nil {
+		pki.t.Fatalf("Unable to create test certificate %s: %s", commonName, err)
+	}
+
+	return &Certificate{
+		Certificate: template,
+		Key:         key,
+		Parent:      parent,
+		pki:         pki,
+		name:        fmt.Sprintf("%03d", pki.serial),
+	}
+}
+
+// Certificate is a certificate and key issued by a PKI.
+type Certificate struct {
+	// Certificate is the parsed x509 certificate.
+	Certificate *x509.Certificate
+
+	// Key is the certificate's private key.
+	Key crypto.Signer
+
+	// Parent is the CA that issued this certificate.  It is nil for the root.
+	Parent *Certificate
+
+	pki  *PKI
+	name string
+
+	certificateFile string
+	keyFile         string
+}
+
+// NewIntermediate issues an intermediate CA signed by this certificate.
+func (tc *Certificate) NewIntermediate(commonName string, options ...Option) *Certificate {
+	tc.pki.t.Helper()
+	return tc.pki.issue(tc, commonName, true, nil, options)
+}
+
+// NewServer issues a server leaf signed by this certificate.  The common name is
+// also used as a DNS SAN.  Use WithDNSNames or WithIPAddresses to add more SANs.
+func (tc *Certificate) NewServer(commonName string, options ...Option) *Certificate {
+	tc.pki.t.Helper()
+	return tc.pki.issue(
+		tc,
+		commonName,
+		false,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		append([]Option{WithDNSNames(commonName)}, options...),
+	)
+}
+
+// NewClient issues a client leaf signed by this certificate.
+func (tc *Certificate) NewClient(commonName string, options ...Option) *Certificate {
+	tc.pki.t.Helper()
+	return tc.pki.issue(
+		tc,
+		commonName,
+		false,
+		[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		options,
+	)
+}
+
+// Chain returns this certificate followed by each of its issuers, excluding the root.
+// The root itself is returned as a chain of one.  This is the chain a peer presents
+// during a handshake.
+func (tc *Certificate) Chain() []*x509.Certificate {
+	chain := []*x509.Certificate{tc.Certificate}
+	for p := tc.Parent; p != nil && p.Parent != nil; p = p.Parent {
+		chain = append(chain, p.Certificate)
+	}
+
+	return chain
+}
+
+// TLSCertificate returns the tls.Certificate for this certificate's Chain and Key.
+func (tc *Certificate) TLSCertificate() tls.Certificate {
+	cert := tls.Certificate{
+		PrivateKey: tc.Key,
+		Leaf:       tc.Certificate,
+	}
+
+	for _, c := range tc.Chain() {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return cert
+}
+
+// Pool returns a cert pool containing only this certificate.
+func (tc *Certificate) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(tc.Certificate)
+	return pool
+}
+
+// CertificatePEM returns the PEM encoding of this certificate's Chain.
+func (tc *Certificate) CertificatePEM() []byte {
+	var data []byte
+	for _, c := range tc.Chain() {
+		data = append(data, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: c.Raw,
+		})...)
+	}
+
+	return data
+}
+
+// KeyPEM returns the PKCS#8 PEM encoding of this certificate's private key.
+func (tc *Certificate) KeyPEM() []byte {
+	tc.pki.t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(tc.Key)
+	if err != nil {
+		tc.pki.t.Fatalf("Unable to marshal key for test certificate %s: %s", tc.Certificate.Subject.CommonName, err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})
+}
+
+// CertificateFile returns the name of a file containing the CertificatePEM.  The file is
+// written on first use.
+func (tc *Certificate) CertificateFile() string {
+	tc.pki.t.Helper()
+	if len(tc.certificateFile) == 0 {
+		tc.certificateFile = tc.writeFile("cert", tc.CertificatePEM())
+	}
+
+	return tc.certificateFile
+}
+
+// KeyFile returns the name of a file containing the KeyPEM.  The file is written on first use.
+func (tc *Certificate) KeyFile() string {
+	tc.pki.t.Helper()
+	if len(tc.keyFile) == 0 {
+		tc.keyFile = tc.writeFile("key", tc.KeyPEM())
+	}
+
+	return tc.keyFile
+}
+
+// ExternalCertificate returns an ExternalCertificate that loads this certificate from its files.
+func (tc *Certificate) ExternalCertificate() arrangetls.ExternalCertificate {
+	tc.pki.t.Helper()
+	return arrangetls.ExternalCertificate{
+		CertificateFile: tc.CertificateFile(),
+		KeyFile:         tc.KeyFile(),
+	}
+}
+
+func (tc *Certificate) writeFile(suffix string, data []byte) string {
+	tc.pki.t.Helper()
+	name := filepath.Join(tc.pki.dir, tc.name+"-"+suffix+".pem")
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		tc.pki.t.Fatalf("Unable to write %s: %s", name, err)
+	}
+
+	return name
+}
@@ -0,0 +1,161 @@
+package arrangetlstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PKISuite struct {
+	suite.Suite
+
+	pki          *PKI
+	intermediate *Certificate
+}
+
+func (suite *PKISuite) SetupTest() {
+	suite.pki = NewPKI(suite.T())
+	suite.intermediate = suite.pki.Root().NewIntermediate("Test Intermediate CA")
+}
+
+func (suite *PKISuite) verify(tc *Certificate, usage x509.ExtKeyUsage) error {
+	intermediates := x509.NewCertPool()
+	for _, c := range tc.Chain()[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err := tc.Certificate.Verify(x509.VerifyOptions{
+		Roots:         suite.pki.Pool(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+
+	return err
+}
+
+func (suite *PKISuite) TestRoot() {
+	root := suite.pki.Root()
+	suite.True(root.Certificate.IsCA)
+	suite.Nil(root.Parent)
+	suite.Len(root.Chain(), 1)
+	suite.NoError(suite.verify(root, x509.ExtKeyUsageAny))
+}
+
+func (suite *PKISuite) TestServer() {
+	server := suite.intermediate.NewServer(
+		"server.example.com",
+		WithDNSNames("*.example.net"),
+		WithIPAddresses("127.0.0.1", "::1"),
+	)
+
+	suite.Equal([]string{"server.example.com", "*.example.net"}, server.Certificate.DNSNames)
+	suite.Len(server.Certificate.IPAddresses, 2)
+	suite.Len(server.Chain(), 2)
+	suite.NoError(suite.verify(server, x509.ExtKeyUsageServerAuth))
+	suite.Error(suite.verify(server, x509.ExtKeyUsageClientAuth))
+	suite.NoError(server.Certificate.VerifyHostname("server.example.com"))
+	suite.NoError(server.Certificate.VerifyHostname("www.example.net"))
+	suite.NoError(server.Certificate.VerifyHostname("127.0.0.1"))
+}
+
+func (suite *PKISuite) TestClient() {
+	client := suite.intermediate.NewClient(
+		"client",
+		WithURIs("spiffe://example.org/ns/prod/sa/web"),
+	)
+
+	suite.Empty(client.Certificate.DNSNames)
+	suite.Equal("spiffe://example.org/ns/prod/sa/web", client.Certificate.URIs[0].String())
+	suite.NoError(suite.verify(client, x509.ExtKeyUsageClientAuth))
+	suite.Error(suite.verify(client, x509.ExtKeyUsageServerAuth))
+}
+
+func (suite *PKISuite) TestValidity() {
+	var invalid x509.CertificateInvalidError
+	suite.ErrorAs(suite.verify(suite.intermediate.NewServer("expired.example.com", Expired()), x509.ExtKeyUsageServerAuth), &invalid)
+	suite.Equal(x509.Expired, invalid.Reason)
+
+	suite.ErrorAs(suite.verify(suite.intermediate.NewServer("future.example.com", NotYetValid()), x509.ExtKeyUsageServerAuth), &invalid)
+	suite.Equal(x509.Expired, invalid.Reason)
+}
+
+func (suite *PKISuite) TestKeyTypes() {
+	testData := []struct {
+		keyType KeyType
+		check   func(any) bool
+	}{
+		{KeyTypeECDSA, func(k any) bool { _, ok := k.(*ecdsa.PrivateKey); return ok }},
+		{KeyTypeRSA, func(k any) bool { _, ok := k.(*rsa.PrivateKey); return ok }},
+		{KeyTypeEd25519, func(k any) bool { _, ok := k.(ed25519.PrivateKey); return ok }},
+	}
+
+	for _, record := range testData {
+		suite.Run(record.keyType.String(), func() {
+			server := suite.intermediate.NewServer("server.example.com", WithKeyType(record.keyType))
+			suite.True(record.check(server.Key))
+			suite.NoError(suite.verify(server, x509.ExtKeyUsageServerAuth))
+		})
+	}
+
+	suite.Equal("KeyType(99)", KeyType(99).String())
+}
+
+func (suite *PKISuite) TestFiles() {
+	server := suite.intermediate.NewServer("server.example.com")
+	ec := server.ExternalCertificate()
+	suite.Equal(server.CertificateFile(), ec.CertificateFile)
+	suite.Equal(server.KeyFile(), ec.KeyFile)
+	suite.FileExists(ec.CertificateFile)
+	suite.FileExists(ec.KeyFile)
+
+	data, err := os.ReadFile(ec.CertificateFile)
+	suite.Require().NoError(err)
+	suite.Equal(server.CertificatePEM(), data)
+
+	loaded, err := ec.Load()
+	suite.Require().NoError(err)
+	suite.Equal(server.TLSCertificate().Certificate, loaded.Certificate)
+}
+
+func (suite *PKISuite) TestHandshake() {
+	server := suite.intermediate.NewServer("server.example.com", WithKeyType(KeyTypeEd25519))
+	client := suite.intermediate.NewClient("client", WithKeyType(KeyTypeRSA))
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	tlsServer := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{server.TLSCertificate()},
+		ClientCAs:    suite.pki.Pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	})
+
+	tlsClient := tls.Client(clientConn, &tls.Config{
+		Certificates: []tls.Certificate{client.TLSCertificate()},
+		RootCAs:      suite.pki.Pool(),
+		ServerName:   "server.example.com",
+		MinVersion:   tls.VersionTLS13,
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- tlsServer.Handshake()
+	}()
+
+	suite.Require().NoError(tlsClient.Handshake())
+	suite.Require().NoError(<-serverErr)
+	suite.Equal("client", tlsServer.ConnectionState().PeerCertificates[0].Subject.CommonName)
+}
+
+func TestPKI(t *testing.T) {
+	suite.Run(t, new(PKISuite))
+}
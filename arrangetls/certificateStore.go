@@ -0,0 +1,253 @@
+package arrangetls
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultReloadInterval is the interval at which a CertificateStore checks its
+	// files when no interval is configured.
+	DefaultReloadInterval = time.Minute
+)
+
+var (
+	// ErrNoCertificates indicates that a CertificateStore was created without any certificates.
+	ErrNoCertificates = errors.New("At least one certificate is required")
+)
+
+// ReloadConfig configures the reloading of certificates when their files change.
+type ReloadConfig struct {
+	// Interval is how often the certificate and key files are checked for changes.
+	// If unset, DefaultReloadInterval is used.
+	Interval time.Duration
+}
+
+// fileState is the information used to detect that a file has changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// CertificateStore holds a set of certificates loaded from external files, and reloads them
+// when those files change.  The certificates are swapped atomically, so a CertificateStore
+// can safely back the GetCertificate and GetClientCertificate callbacks of a tls.Config.
+//
+// Files are polled for changes after Start is called.  Reload can also be called directly
+// to force a check.
+type CertificateStore struct {
+	certificates ExternalCertificates
+	interval     time.Duration
+	onError      func(error)
+
+	current atomic.Pointer[[]tls.Certificate]
+
+	reloadLock sync.Mutex
+	files      map[string]fileState
+
+	watchLock sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewCertificateStore loads the given certificates and returns a store that can reload them.
+// If interval is nonpositive, DefaultReloadInterval is used.  The onError callback receives
+// any error that occurs while reloading in the background.  If onError is nil, such errors
+// are written to the standard logger.
+//
+// The returned store is not yet watching its files.  Call Start to begin watching.
+func NewCertificateStore(certificates ExternalCertificates, interval time.Duration, onError func(error)) (*CertificateStore, error) {
+	if certificates.Len() == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	if onError == nil {
+		onError = func(err error) {
+			log.Printf("arrangetls: unable to reload certificates: %s", err)
+		}
+	}
+
+	cs := &CertificateStore{
+		certificates: append(ExternalCertificates{}, certificates...),
+		interval:     interval,
+		onError:      onError,
+	}
+
+	if _, err := cs.Reload(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// statFiles returns the current state of each file that the certificates are loaded from.
+// Inline material never changes, so any file it overrides is ignored.
+func (cs *CertificateStore) statFiles() (map[string]fileState, error) {
+	files := make(map[string]fileState, 2*cs.certificates.Len())
+	for i, ec := range cs.certificates {
+		for _, name := range ec.files() {
+			if len(name) == 0 {
+				continue
+			}
+
+			state, err := statFile(name)
+			if err != nil {
+				return nil, &EntryError{
+					Index:  i,
+					Source: ec.source(),
+					Err:    err,
+				}
+			}
+
+			files[name] = state
+		}
+	}
+
+	return files, nil
+}
+
+// filesChanged tests if any file differs from a previous state.
+func filesChanged(previous, current map[string]fileState) bool {
+	if len(current) != len(previous) {
+		return true
+	}
+
+	for name, state := range current {
+		if p, ok := previous[name]; !ok || !p.modTime.Equal(state.modTime) || p.size != state.size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// statFile returns the current state of a file.
+func statFile(name string) (fileState, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return fileState{}, err
+	}
+
+	return fileState{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+	}, nil
+}
+
+// Reload checks the certificate and key files, and reloads all certificates if any file has
+// changed.  This method returns true if the certificates were reloaded.  If an error occurs,
+// the currently loaded certificates are retained.
+func (cs *CertificateStore) Reload() (bool, error) {
+	cs.reloadLock.Lock()
+	defer cs.reloadLock.Unlock()
+
+	files, err := cs.statFiles()
+	if err != nil || !filesChanged(cs.files, files) {
+		return false, err
+	}
+
+	certs, err := cs.certificates.AppendTo(nil)
+	if err != nil {
+		return false, err
+	}
+
+	cs.current.Store(&certs)
+	cs.files = files
+	return true, nil
+}
+
+// Certificates returns the currently loaded certificates.  The returned slice must not be modified.
+func (cs *CertificateStore) Certificates() []tls.Certificate {
+	return *cs.current.Load()
+}
+
+// GetCertificate may be used as the tls.Config.GetCertificate callback for servers.  The first
+// certificate supported by the client is returned.  If none are supported, the first certificate
+// is returned and the handshake is left to fail normally.
+func (cs *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := cs.Certificates()
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+
+	return &certs[0], nil
+}
+
+// GetClientCertificate may be used as the tls.Config.GetClientCertificate callback for clients.
+// The first certificate supported by the server is returned.  If none are supported, an empty
+// certificate is returned, which results in no certificate being sent.
+func (cs *CertificateStore) GetClientCertificate(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	certs := cs.Certificates()
+	for i := range certs {
+		if cri.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+
+	return new(tls.Certificate), nil
+}
+
+// SetTo installs this store's callbacks into the given tls.Config.  Any statically configured
+// certificates are removed, as they would otherwise take precedence for clients.
+func (cs *CertificateStore) SetTo(tc *tls.Config) {
+	if tc != nil {
+		tc.Certificates = nil
+		tc.GetCertificate = cs.GetCertificate
+		tc.GetClientCertificate = cs.GetClientCertificate
+	}
+}
+
+// Start begins watching the certificate and key files in a separate goroutine.
+// This method is idempotent.
+func (cs *CertificateStore) Start() {
+	cs.watchLock.Lock()
+	defer cs.watchLock.Unlock()
+
+	if cs.stop == nil {
+		cs.stop = make(chan struct{})
+		cs.done = make(chan struct{})
+		go cs.watch(cs.stop, cs.done)
+	}
+}
+
+// Stop halts watching, waiting for the watch goroutine to exit.  This method is idempotent.
+func (cs *CertificateStore) Stop() {
+	cs.watchLock.Lock()
+	defer cs.watchLock.Unlock()
+
+	if cs.stop != nil {
+		close(cs.stop)
+		<-cs.done
+		cs.stop = nil
+		cs.done = nil
+	}
+}
+
+func (cs *CertificateStore) watch(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(cs.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			if _, err := cs.Reload(); err != nil {
+				cs.onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package arrangetls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type CertificateStoreSuite struct {
+	suite.Suite
+
+	certificateFile string
+	keyFile         string
+}
+
+// writeCertificate generates a self-signed certificate with the given serial number
+// and writes it over this suite's certificate and key files.
+func (suite *CertificateStoreSuite) writeCertificate(serialNumber int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: "test"},
+		DNSNames:     []string{"test.net"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	suite.Require().NoError(err)
+
+	certificateFile, keyFile, err := CreateTestServerFiles(&tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	})
+
+	suite.Require().NoError(err)
+
+	// ensure the modification time changes, even on coarse-grained filesystems
+	modTime := time.Now().Add(time.Duration(serialNumber) * time.Second)
+	suite.Require().NoError(os.Chtimes(certificateFile, modTime, modTime))
+	suite.Require().NoError(os.Chtimes(keyFile, modTime, modTime))
+	suite.Require().NoError(os.Rename(certificateFile, suite.certificateFile))
+	suite.Require().NoError(os.Rename(keyFile, suite.keyFile))
+}
+
+func (suite *CertificateStoreSuite) certificates() ExternalCertificates {
+	return ExternalCertificates{
+		{
+			CertificateFile: suite.certificateFile,
+			KeyFile:         suite.keyFile,
+		},
+	}
+}
+
+// serialNumber returns the serial number of the leaf certificate.
+func (suite *CertificateStoreSuite) serialNumber(cert *tls.Certificate) int64 {
+	suite.Require().NotNil(cert)
+	suite.Require().NotEmpty(cert.Certificate)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	suite.Require().NoError(err)
+	return leaf.SerialNumber.Int64()
+}
+
+func (suite *CertificateStoreSuite) SetupTest() {
+	dir := suite.T().TempDir()
+	suite.certificateFile = filepath.Join(dir, "cert.pem")
+	suite.keyFile = filepath.Join(dir, "key.pem")
+	suite.writeCertificate(1)
+}
+
+func (suite *CertificateStoreSuite) TestNoCertificates() {
+	cs, err := NewCertificateStore(nil, 0, nil)
+	suite.ErrorIs(err, ErrNoCertificates)
+	suite.Nil(cs)
+}
+
+func (suite *CertificateStoreSuite) TestMissingFile() {
+	cs, err := NewCertificateStore(
+		ExternalCertificates{{CertificateFile: "missing", KeyFile: "missing"}},
+		0,
+		nil,
+	)
+
+	suite.Error(err)
+	suite.Nil(cs)
+}
+
+func (suite *CertificateStoreSuite) TestReload() {
+	cs, err := NewCertificateStore(suite.certificates(), 0, nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(cs.Certificates(), 1)
+	suite.Equal(int64(1), suite.serialNumber(&cs.Certificates()[0]))
+
+	reloaded, err := cs.Reload()
+	suite.NoError(err)
+	suite.False(reloaded)
+
+	suite.writeCertificate(2)
+	reloaded, err = cs.Reload()
+	suite.NoError(err)
+	suite.True(reloaded)
+	suite.Equal(int64(2), suite.serialNumber(&cs.Certificates()[0]))
+}
+
+func (suite *CertificateStoreSuite) TestReloadInline() {
+	certPEM, err := os.ReadFile(suite.certificateFile)
+	suite.Require().NoError(err)
+
+	certificates := suite.certificates()
+	certificates[0].CertificatePEM = string(certPEM)
+	certificates[0].CertificateFile = "ignored"
+
+	cs, err := NewCertificateStore(certificates, 0, nil)
+	suite.Require().NoError(err)
+
+	reloaded, err := cs.Reload()
+	suite.NoError(err)
+	suite.False(reloaded)
+}
+
+func (suite *CertificateStoreSuite) TestReloadError() {
+	cs, err := NewCertificateStore(suite.certificates(), 0, nil)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(os.WriteFile(suite.keyFile, []byte("this is not a key"), 0600))
+	later := time.Now().Add(time.Hour)
+	suite.Require().NoError(os.Chtimes(suite.keyFile, later, later))
+
+	reloaded, err := cs.Reload()
+	suite.Error(err)
+	suite.False(reloaded)
+
+	// the original certificate should be retained
+	suite.Equal(int64(1), suite.serialNumber(&cs.Certificates()[0]))
+}
+
+func (suite *CertificateStoreSuite) TestWatch() {
+	var (
+		errLock sync.Mutex
+		errs    []error
+	)
+
+	cs, err := NewCertificateStore(suite.certificates(), 10*time.Millisecond, func(err error) {
+		errLock.Lock()
+		errs = append(errs, err)
+		errLock.Unlock()
+	})
+
+	suite.Require().NoError(err)
+	cs.Start()
+	cs.Start() // idempotent
+	defer cs.Stop()
+
+	suite.writeCertificate(2)
+	suite.Eventually(
+		func() bool {
+			cert, err := cs.GetCertificate(&tls.ClientHelloInfo{})
+			return err == nil && suite.serialNumber(cert) == 2
+		},
+		2*time.Second,
+		10*time.Millisecond,
+	)
+
+	suite.Require().NoError(os.Remove(suite.keyFile))
+	suite.Eventually(
+		func() bool {
+			errLock.Lock()
+			defer errLock.Unlock()
+			return len(errs) > 0
+		},
+		2*time.Second,
+		10*time.Millisecond,
+	)
+
+	cs.Stop()
+	cs.Stop() // idempotent
+}
+
+func (suite *CertificateStoreSuite) TestGetClientCertificate() {
+	cs, err := NewCertificateStore(suite.certificates(), 0, nil)
+	suite.Require().NoError(err)
+
+	cert, err := cs.GetClientCertificate(&tls.CertificateRequestInfo{
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		Version:          tls.VersionTLS13,
+	})
+
+	suite.Require().NoError(err)
+	suite.Equal(int64(1), suite.serialNumber(cert))
+
+	cert, err = cs.GetClientCertificate(&tls.CertificateRequestInfo{
+		SignatureSchemes: []tls.SignatureScheme{tls.PSSWithSHA256},
+		Version:          tls.VersionTLS13,
+	})
+
+	suite.Require().NoError(err)
+	suite.Empty(cert.Certificate)
+}
+
+func (suite *CertificateStoreSuite) TestConfigReload() {
+	c := Config{
+		Certificates: suite.certificates(),
+		Reload:       &ReloadConfig{Interval: 10 * time.Millisecond},
+	}
+
+	tc, cs, err := c.NewWithStore(nil)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(tc)
+	suite.Require().NotNil(cs)
+	suite.Empty(tc.Certificates)
+	suite.NotNil(tc.GetCertificate)
+	suite.NotNil(tc.GetClientCertificate)
+
+	cs.Start()
+	defer cs.Stop()
+
+	suite.writeCertificate(2)
+	suite.Eventually(
+		func() bool {
+			cert, err := tc.GetCertificate(&tls.ClientHelloInfo{})
+			return err == nil && suite.serialNumber(cert) == 2
+		},
+		2*time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func (suite *CertificateStoreSuite) TestConfigNoReload() {
+	tc, cs, err := (&Config{Certificates: suite.certificates()}).NewWithStore(nil)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(tc)
+	suite.Nil(cs)
+	suite.Len(tc.Certificates, 1)
+	suite.NotNil(tc.GetCertificate)
+}
+
+func (suite *CertificateStoreSuite) TestProvideConfig() {
+	var (
+		tc      *tls.Config
+		errs    = make(chan error, 10)
+		onError = func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+	)
+
+	app := fxtest.New(
+		suite.T(),
+		fx.Supply(
+			fx.Annotate(
+				&Config{
+					Certificates: suite.certificates(),
+					Reload:       &ReloadConfig{Interval: 10 * time.Millisecond},
+				},
+				arrange.Tags().Name("server.config").ResultTags(),
+			),
+			fx.Annotate(
+				onError,
+				arrange.Tags().Name("server.errors").ResultTags(),
+			),
+		),
+		ProvideConfig("server"),
+		fx.Populate(
+			fx.Annotate(
+				&tc,
+				arrange.Tags().Name("server").ParamTags(),
+			),
+		),
+	)
+
+	app.RequireStart()
+	suite.Require().NotNil(tc)
+	suite.Require().NoError(os.Remove(suite.keyFile))
+
+	select {
+	case err := <-errs:
+		suite.True(errors.Is(err, os.ErrNotExist))
+	case <-time.After(2 * time.Second):
+		suite.Fail("No reload error was reported")
+	}
+
+	app.RequireStop()
+}
+
+func (suite *CertificateStoreSuite) TestProvideConfigMissing() {
+	var tc *tls.Config
+	app := fxtest.New(
+		suite.T(),
+		ProvideConfig("server"),
+		fx.Populate(
+			fx.Annotate(
+				&tc,
+				arrange.Tags().Name("server").ParamTags(),
+			),
+		),
+	)
+
+	app.RequireStart()
+	app.RequireStop()
+	suite.Nil(tc)
+}
+
+func (suite *CertificateStoreSuite) TestProvideConfigNoName() {
+	app := fx.New(fx.NopLogger, ProvideConfig(""))
+	suite.ErrorIs(app.Err(), ErrConfigNameRequired)
+}
+
+func TestCertificateStore(t *testing.T) {
+	suite.Run(t, new(CertificateStoreSuite))
+}
+
+func TestBindCertificateStoreStops(t *testing.T) {
+	// verifies that the lifecycle hook leaves no running watcher behind
+	var (
+		lifecycle = fxtest.NewLifecycle(t)
+		cs        = &CertificateStore{interval: time.Millisecond, onError: func(error) {}}
+	)
+
+	empty := []tls.Certificate{{}}
+	cs.current.Store(&empty)
+	BindCertificateStore(cs, lifecycle)
+	lifecycle.RequireStart()
+	lifecycle.RequireStop()
+
+	if cs.stop != nil {
+		t.Error("the watcher was not stopped")
+	}
+
+}
@@ -0,0 +1,111 @@
+package arrangetls
+
+import (
+	"crypto/x509"
+	"strconv"
+	"strings"
+)
+
+// peerChains returns the verified chains that begin with the peer certificate.  When a
+// PeerVerifier sees only the leaf, this is every verified chain.
+func peerChains(peerCert *x509.Certificate, verifiedChains [][]*x509.Certificate) [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	for _, chain := range verifiedChains {
+		if len(chain) > 0 && chain[0].Equal(peerCert) {
+			chains = append(chains, chain)
+		}
+	}
+
+	return chains
+}
+
+// noVerifiedChains is the error returned by chain-level verifiers when crypto/tls did not
+// verify any chain for the peer certificate, e.g. when ClientAuth is RequireAnyClientCert.
+func noVerifiedChains(peerCert *x509.Certificate) error {
+	return &PeerVerifyError{
+		Certificate: peerCert,
+		Reason:      "No verified chains",
+	}
+}
+
+// VerifyIssuer returns a PeerVerifier that requires the peer certificate to have been issued
+// by a CA with one of the given subject common names.  Matching is case sensitive.
+//
+// The issuing certificate from at least one verified chain must match.  A peer certificate
+// without any verified chains is rejected.
+func VerifyIssuer(commonNames ...string) PeerVerifier {
+	set := newSet(commonNames)
+	return func(peerCert *x509.Certificate, verifiedChains [][]*x509.Certificate) error {
+		chains := peerChains(peerCert, verifiedChains)
+		if len(chains) == 0 {
+			return noVerifiedChains(peerCert)
+		}
+
+		for _, chain := range chains {
+			issuer := chain[0]
+			if len(chain) > 1 {
+				issuer = chain[1]
+			}
+
+			if set[issuer.Subject.CommonName] {
+				return nil
+			}
+		}
+
+		return &PeerVerifyError{
+			Certificate: peerCert,
+			Reason:      "Issuer is not one of " + strings.Join(commonNames, ", "),
+		}
+	}
+}
+
+// VerifyChainContains returns a PeerVerifier that requires at least one verified chain to
+// include one of the given certificates.  This is typically used to pin an intermediate CA.
+// A peer certificate without any verified chains is rejected.
+func VerifyChainContains(certs ...*x509.Certificate) PeerVerifier {
+	certs = append([]*x509.Certificate{}, certs...)
+	return func(peerCert *x509.Certificate, verifiedChains [][]*x509.Certificate) error {
+		chains := peerChains(peerCert, verifiedChains)
+		if len(chains) == 0 {
+			return noVerifiedChains(peerCert)
+		}
+
+		for _, chain := range chains {
+			for _, cert := range chain {
+				for _, c := range certs {
+					if cert.Equal(c) {
+						return nil
+					}
+				}
+			}
+		}
+
+		return &PeerVerifyError{
+			Certificate: peerCert,
+			Reason:      "No verified chain contains a required certificate",
+		}
+	}
+}
+
+// VerifyMaxChainLength returns a PeerVerifier that requires at least one verified chain
+// to have no more than n certificates, counting both the peer certificate and the root.
+// A peer certificate without any verified chains is rejected.
+func VerifyMaxChainLength(n int) PeerVerifier {
+	return func(peerCert *x509.Certificate, verifiedChains [][]*x509.Certificate) error {
+		chains := peerChains(peerCert, verifiedChains)
+		if len(chains) == 0 {
+			return noVerifiedChains(peerCert)
+		}
+
+		for _, chain := range chains {
+			if len(chain) <= n {
+				return nil
+			}
+		}
+
+		return &PeerVerifyError{
+			Certificate: peerCert,
+			Reason:      "No verified chain has at most " + strconv.Itoa(n) + " certificates",
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package arrangetls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChainSuite struct {
+	suite.Suite
+
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	leaf         *x509.Certificate
+}
+
+// issue creates a certificate from template, signed by the given parent.  If parent is nil,
+// the certificate is self-signed.
+func (suite *ChainSuite) issue(template, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	suite.Require().NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	suite.Require().NoError(err)
+	return cert, key
+}
+
+func (suite *ChainSuite) SetupSuite() {
+	root, rootKey := suite.issue(
+		&x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "Test Root"},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		},
+		nil, nil,
+	)
+
+	intermediate, intermediateKey := suite.issue(
+		&x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "Test Intermediate"},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		},
+		root, rootKey,
+	)
+
+	suite.root = root
+	suite.intermediate = intermediate
+	suite.leaf, _ = suite.issue(
+		&x509.Certificate{
+			SerialNumber: big.NewInt(3),
+			Subject:      pkix.Name{CommonName: "client.example.com"},
+			DNSNames:     []string{"client.example.com"},
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+		intermediate, intermediateKey,
+	)
+}
+
+// rawCerts is what a client sends when it presents its full chain.
+func (suite *ChainSuite) rawCerts() [][]byte {
+	return [][]byte{suite.leaf.Raw, suite.intermediate.Raw}
+}
+
+func (suite *ChainSuite) chains() [][]*x509.Certificate {
+	return [][]*x509.Certificate{{suite.leaf, suite.intermediate, suite.root}}
+}
+
+func (suite *ChainSuite) assertPeerVerifyError(err error, reason string) {
+	var pve *PeerVerifyError
+	suite.Require().ErrorAs(err, &pve)
+	suite.Equal(suite.leaf, pve.Certificate)
+	suite.Equal(reason, pve.Reason)
+}
+
+func (suite *ChainSuite) TestLeafOnly() {
+	pvs := NewPeerVerifiers(
+		PeerVerifyConfig{DNSSuffixes: []string{"example.com"}}.Verifier(),
+	)
+
+	suite.NoError(pvs.VerifyPeerCertificate(suite.rawCerts(), suite.chains()))
+	suite.NoError(pvs.VerifyPeerCertificate(suite.rawCerts(), nil))
+	suite.NoError(pvs.VerifyPeerCertificate(nil, nil))
+
+	// the intermediate has no matching name
+	suite.Error(pvs.VerifyAllPeerCertificates(suite.rawCerts(), suite.chains()))
+}
+
+func (suite *ChainSuite) TestVerifyAllPeerCertificates() {
+	var seen []string
+	pvs := NewPeerVerifiers(func(peerCert *x509.Certificate, _ [][]*x509.Certificate) error {
+		seen = append(seen, peerCert.Subject.CommonName)
+		return nil
+	})
+
+	suite.NoError(pvs.VerifyAllPeerCertificates(suite.rawCerts(), suite.chains()))
+	suite.Equal([]string{"client.example.com", "Test Intermediate"}, seen)
+
+	seen = nil
+	suite.NoError(pvs.VerifyPeerCertificate(suite.rawCerts(), suite.chains()))
+	suite.Equal([]string{"client.example.com"}, seen)
+
+	suite.Error(pvs.VerifyAllPeerCertificates([][]byte{{1, 2, 3}}, nil))
+	suite.NoError(PeerVerifiers{}.VerifyAllPeerCertificates([][]byte{{1, 2, 3}}, nil))
+}
+
+func (suite *ChainSuite) TestVerifyIssuer() {
+	suite.NoError(VerifyIssuer("Test Intermediate")(suite.leaf, suite.chains()))
+	suite.NoError(VerifyIssuer("Other", "Test Intermediate")(suite.leaf, suite.chains()))
+	suite.assertPeerVerifyError(
+		VerifyIssuer("Test Root")(suite.leaf, suite.chains()),
+		"Issuer is not one of Test Root",
+	)
+
+	// chains that do not begin with the peer cert are ignored
+	suite.assertPeerVerifyError(
+		VerifyIssuer("Test Intermediate")(suite.leaf, [][]*x509.Certificate{{suite.intermediate, suite.root}}),
+		"No verified chains",
+	)
+
+	// the issuer named by the peer cert itself is never trusted
+	suite.assertPeerVerifyError(
+		VerifyIssuer("Test Intermediate")(suite.leaf, nil),
+		"No verified chains",
+	)
+}
+
+func (suite *ChainSuite) TestVerifyChainContains() {
+	suite.NoError(VerifyChainContains(suite.intermediate)(suite.leaf, suite.chains()))
+	suite.NoError(VerifyChainContains(suite.leaf, suite.root)(suite.leaf, suite.chains()))
+	suite.assertPeerVerifyError(
+		VerifyChainContains(suite.intermediate)(suite.leaf, [][]*x509.Certificate{{suite.leaf, suite.root}}),
+		"No verified chain contains a required certificate",
+	)
+
+	suite.assertPeerVerifyError(
+		VerifyChainContains(suite.intermediate)(suite.leaf, nil),
+		"No verified chains",
+	)
+}
+
+func (suite *ChainSuite) TestVerifyMaxChainLength() {
+	suite.NoError(VerifyMaxChainLength(3)(suite.leaf, suite.chains()))
+	suite.NoError(VerifyMaxChainLength(2)(
+		suite.leaf,
+		[][]*x509.Certificate{{suite.leaf, suite.intermediate, suite.root}, {suite.leaf, suite.intermediate}},
+	))
+
+	suite.assertPeerVerifyError(
+		VerifyMaxChainLength(2)(suite.leaf, suite.chains()),
+		"No verified chain has at most 2 certificates",
+	)
+
+	suite.assertPeerVerifyError(
+		VerifyMaxChainLength(3)(suite.leaf, nil),
+		"No verified chains",
+	)
+}
+
+func (suite *ChainSuite) TestPeerVerifyConfig() {
+	v, err := PeerVerifyConfig{
+		DNSSuffixes:       []string{"example.com"},
+		IssuerCommonNames: []string{"Test Intermediate"},
+		MaxChainLength:    3,
+	}.NewVerifier()
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(v)
+	suite.NoError(v(suite.leaf, suite.chains()))
+
+	// the chain checks apply even when an identity check matches
+	v, err = PeerVerifyConfig{
+		DNSSuffixes:    []string{"example.com"},
+		MaxChainLength: 2,
+	}.NewVerifier()
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(v)
+	suite.assertPeerVerifyError(v(suite.leaf, suite.chains()), "No verified chain has at most 2 certificates")
+
+	v, err = PeerVerifyConfig{
+		IssuerCommonNames: []string{"Test Root"},
+	}.NewVerifier()
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(v)
+	suite.assertPeerVerifyError(v(suite.leaf, suite.chains()), "Issuer is not one of Test Root")
+}
+
+func (suite *ChainSuite) TestConfig() {
+	c := Config{
+		Certificates: ExternalCertificates{
+			{
+				CertificateFile: CertificateFile,
+				KeyFile:         KeyFile,
+			},
+		},
+		PeerVerify: &PeerVerifyConfig{
+			DNSSuffixes: []string{"example.com"},
+		},
+	}
+
+	tc, err := c.New()
+	suite.Require().NoError(err)
+	suite.Require().NotNil(tc.VerifyPeerCertificate)
+	suite.NoError(tc.VerifyPeerCertificate(suite.rawCerts(), suite.chains()))
+
+	c.PeerVerify.AllCertificates = true
+	tc, err = c.New()
+	suite.Require().NoError(err)
+	suite.Require().NotNil(tc.VerifyPeerCertificate)
+	suite.Error(tc.VerifyPeerCertificate(suite.rawCerts(), suite.chains()))
+}
+
+func TestChain(t *testing.T) {
+	suite.Run(t, new(ChainSuite))
+}
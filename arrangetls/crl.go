@@ -0,0 +1,243 @@
+package arrangetls
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrNoCRLs indicates that a CRLStore was created without any files.
+	ErrNoCRLs = errors.New("At least one CRL file is required")
+
+	// ErrNoCRLBlocks indicates that a PEM CRL file contained no X509 CRL blocks.
+	ErrNoCRLBlocks = errors.New("No X509 CRL PEM blocks found")
+)
+
+// revocationList is a parsed CRL together with an index of its revoked serial numbers.
+type revocationList struct {
+	list    *x509.RevocationList
+	revoked map[string]bool
+}
+
+// newRevocationList indexes a parsed CRL.
+func newRevocationList(list *x509.RevocationList) revocationList {
+	rl := revocationList{
+		list:    list,
+		revoked: make(map[string]bool, len(list.RevokedCertificates)), //nolint:staticcheck // RevokedCertificateEntries requires go 1.21
+	}
+
+	for _, rc := range list.RevokedCertificates { //nolint:staticcheck // RevokedCertificateEntries requires go 1.21
+		rl.revoked[rc.SerialNumber.String()] = true
+	}
+
+	return rl
+}
+
+// loadRevocationLists parses a CRL file, which can be either DER or a sequence of PEM blocks.
+func loadRevocationLists(name string) ([]revocationList, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Contains(data, []byte(pemPrefix)) {
+		list, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return []revocationList{newRevocationList(list)}, nil
+	}
+
+	var lists []revocationList
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "X509 CRL" {
+			continue
+		}
+
+		list, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, newRevocationList(list))
+	}
+
+	if len(lists) == 0 {
+		return nil, ErrNoCRLBlocks
+	}
+
+	return lists, nil
+}
+
+// CRLStore holds certificate revocation lists loaded from local files, and reloads them
+// when those files change.  The files are checked at most once per interval, during
+// verification, so a CRLStore requires no background goroutine.
+//
+// A CRL applies to a certificate only if the CRL's issuer matches the certificate's issuer.
+// When the issuing certificate is known from a verified chain, the CRL's signature must also
+// have been made by that issuer.
+type CRLStore struct {
+	files    []string
+	interval time.Duration
+	onError  func(error)
+	now      func() time.Time
+
+	current atomic.Pointer[[]revocationList]
+
+	reloadLock sync.Mutex
+	lastCheck  time.Time
+	states     map[string]fileState
+}
+
+// NewCRLStore loads the given CRL files and returns a store that can reload them.  If interval
+// is nonpositive, DefaultReloadInterval is used.  The onError callback receives any error that
+// occurs while reloading during verification.  If onError is nil, such errors are written to the
+// standard logger.
+func NewCRLStore(files []string, interval time.Duration, onError func(error)) (*CRLStore, error) {
+	if len(files) == 0 {
+		return nil, ErrNoCRLs
+	}
+
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	if onError == nil {
+		onError = func(err error) {
+			log.Printf("arrangetls: unable to reload CRLs: %s", err)
+		}
+	}
+
+	cs := &CRLStore{
+		files:    append([]string{}, files...),
+		interval: interval,
+		onError:  onError,
+		now:      time.Now,
+	}
+
+	if _, err := cs.Reload(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// reload does the work of reloading.  The reloadLock must be held.
+func (cs *CRLStore) reload() (bool, error) {
+	cs.lastCheck = cs.now()
+	states := make(map[string]fileState, len(cs.files))
+	for i, name := range cs.files {
+		state, err := statFile(name)
+		if err != nil {
+			return false, &EntryError{Index: i, Source: name, Err: err}
+		}
+
+		states[name] = state
+	}
+
+	if !filesChanged(cs.states, states) {
+		return false, nil
+	}
+
+	var lists []revocationList
+	for i, name := range cs.files {
+		loaded, err := loadRevocationLists(name)
+		if err != nil {
+			return false, &EntryError{Index: i, Source: name, Err: err}
+		}
+
+		lists = append(lists, loaded...)
+	}
+
+	cs.current.Store(&lists)
+	cs.states = states
+	return true, nil
+}
+
+// Reload checks the CRL files, and reloads all of them if any file has changed.  This method
+// returns true if the CRLs were reloaded.  If an error occurs, the currently loaded CRLs
+// are retained.
+func (cs *CRLStore) Reload() (bool, error) {
+	cs.reloadLock.Lock()
+	defer cs.reloadLock.Unlock()
+	return cs.reload()
+}
+
+// checkReload reloads the CRL files if the interval has elapsed since the last check.
+// If another goroutine is already reloading, this method does nothing.
+func (cs *CRLStore) checkReload() {
+	if !cs.reloadLock.TryLock() {
+		return
+	}
+
+	defer cs.reloadLock.Unlock()
+	if cs.now().Sub(cs.lastCheck) >= cs.interval {
+		if _, err := cs.reload(); err != nil {
+			cs.onError(err)
+		}
+	}
+}
+
+// check verifies that cert has not been revoked.  The issuer is optional.  If supplied,
+// only CRLs signed by the issuer are considered.
+func (cs *CRLStore) check(cert, issuer *x509.Certificate) error {
+	for _, rl := range *cs.current.Load() {
+		if !bytes.Equal(rl.list.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+
+		if issuer != nil && rl.list.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+
+		if rl.revoked[cert.SerialNumber.String()] {
+			return &PeerVerifyError{
+				Certificate:  cert,
+				SerialNumber: cert.SerialNumber,
+				Reason:       "Certificate has been revoked",
+			}
+		}
+	}
+
+	return nil
+}
+
+// Verify is a PeerVerifier that rejects revoked certificates.  The peer certificate and
+// every certificate above it in each verified chain are checked.  If the peer certificate
+// does not appear in any verified chain, it is checked against the CRLs of its issuer by
+// name alone.
+func (cs *CRLStore) Verify(peerCert *x509.Certificate, verifiedChains [][]*x509.Certificate) error {
+	cs.checkReload()
+
+	found := false
+	for _, chain := range verifiedChains {
+		for i, cert := range chain {
+			if !cert.Equal(peerCert) {
+				continue
+			}
+
+			found = true
+			for j := i; j < len(chain)-1; j++ {
+				if err := cs.check(chain[j], chain[j+1]); err != nil {
+					return err
+				}
+			}
+
+			break
+		}
+	}
+
+	if !found {
+		return cs.check(peerCert, nil)
+	}
+
+	return nil
+}
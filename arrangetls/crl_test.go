@@ -0,0 +1,368 @@
+package arrangetls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CRLSuite struct {
+	suite.Suite
+
+	ca    *x509.Certificate
+	caKey crypto.Signer
+
+	// otherCA has the same subject as ca, but a different key
+	otherCA    *x509.Certificate
+	otherCAKey crypto.Signer
+
+	good    *x509.Certificate
+	revoked *x509.Certificate
+
+	crlFile string
+}
+
+func (suite *CRLSuite) caTemplate() *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+}
+
+// newLeaf issues a certificate with the given serial number from the suite's CA.
+func (suite *CRLSuite) newLeaf(serialNumber int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+
+	der, err := x509.CreateCertificate(
+		rand.Reader,
+		&x509.Certificate{
+			SerialNumber: big.NewInt(serialNumber),
+			Subject:      pkix.Name{CommonName: "client"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+		suite.ca,
+		&key.PublicKey,
+		suite.caKey,
+	)
+
+	suite.Require().NoError(err)
+	leaf, err := x509.ParseCertificate(der)
+	suite.Require().NoError(err)
+	return leaf
+}
+
+// newCRL creates a DER-encoded CRL revoking the given serial numbers.
+func (suite *CRLSuite) newCRL(issuer *x509.Certificate, key crypto.Signer, number int64, serialNumbers ...*big.Int) []byte {
+	template := &x509.RevocationList{
+		Number:     big.NewInt(number),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+
+	for _, sn := range serialNumbers {
+		template.RevokedCertificates = append(template.RevokedCertificates, pkix.RevokedCertificate{ //nolint:staticcheck
+			SerialNumber:   sn,
+			RevocationTime: time.Now(),
+		})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, issuer, key)
+	suite.Require().NoError(err)
+	return der
+}
+
+// writeCRL writes a PEM-encoded CRL to the suite's CRL file, ensuring that its state changes.
+func (suite *CRLSuite) writeCRL(number int64, der ...[]byte) {
+	var data []byte
+	for _, d := range der {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: d})...)
+	}
+
+	suite.Require().NoError(os.WriteFile(suite.crlFile, data, 0600))
+	modTime := time.Now().Add(time.Duration(number) * time.Second)
+	suite.Require().NoError(os.Chtimes(suite.crlFile, modTime, modTime))
+}
+
+func (suite *CRLSuite) SetupSuite() {
+	// use the standard test certificate generation for the CA
+	caCert, err := CreateTestCertificate(suite.caTemplate())
+	suite.Require().NoError(err)
+	suite.ca, err = x509.ParseCertificate(caCert.Certificate[0])
+	suite.Require().NoError(err)
+	suite.caKey = caCert.PrivateKey.(crypto.Signer)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	otherDER, err := x509.CreateCertificate(rand.Reader, suite.caTemplate(), suite.caTemplate(), &otherKey.PublicKey, otherKey)
+	suite.Require().NoError(err)
+	suite.otherCA, err = x509.ParseCertificate(otherDER)
+	suite.Require().NoError(err)
+	suite.otherCAKey = otherKey
+
+	suite.good = suite.newLeaf(100)
+	suite.revoked = suite.newLeaf(200)
+}
+
+func (suite *CRLSuite) SetupTest() {
+	suite.crlFile = filepath.Join(suite.T().TempDir(), "crl.pem")
+	suite.writeCRL(1, suite.newCRL(suite.ca, suite.caKey, 1, suite.revoked.SerialNumber))
+}
+
+func (suite *CRLSuite) chains(leaf *x509.Certificate) [][]*x509.Certificate {
+	return [][]*x509.Certificate{{leaf, suite.ca}}
+}
+
+func (suite *CRLSuite) assertRevoked(err error, cert *x509.Certificate) {
+	var pve *PeerVerifyError
+	suite.Require().ErrorAs(err, &pve)
+	suite.Equal(cert, pve.Certificate)
+	suite.Equal(cert.SerialNumber, pve.SerialNumber)
+}
+
+func (suite *CRLSuite) TestNoFiles() {
+	cs, err := NewCRLStore(nil, 0, nil)
+	suite.ErrorIs(err, ErrNoCRLs)
+	suite.Nil(cs)
+}
+
+func (suite *CRLSuite) TestLoadErrors() {
+	invalid := filepath.Join(suite.T().TempDir(), "invalid.pem")
+	suite.Require().NoError(os.WriteFile(invalid, []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"), 0600))
+
+	garbage := filepath.Join(suite.T().TempDir(), "garbage.der")
+	suite.Require().NoError(os.WriteFile(garbage, []byte("garbage"), 0600))
+
+	for _, name := range []string{"missing", invalid, garbage} {
+		var ee *EntryError
+		cs, err := NewCRLStore([]string{suite.crlFile, name}, 0, nil)
+		suite.Nil(cs)
+		suite.Require().ErrorAs(err, &ee)
+		suite.Equal(1, ee.Index)
+		suite.Equal(name, ee.Source)
+	}
+}
+
+func (suite *CRLSuite) TestVerify() {
+	cs, err := NewCRLStore([]string{suite.crlFile}, 0, nil)
+	suite.Require().NoError(err)
+
+	suite.NoError(cs.Verify(suite.good, suite.chains(suite.good)))
+	suite.assertRevoked(cs.Verify(suite.revoked, suite.chains(suite.revoked)), suite.revoked)
+
+	// without verified chains, the issuer name alone is used
+	suite.NoError(cs.Verify(suite.good, nil))
+	suite.assertRevoked(cs.Verify(suite.revoked, nil), suite.revoked)
+
+	// the CA itself is not revoked
+	suite.NoError(cs.Verify(suite.ca, suite.chains(suite.good)))
+}
+
+func (suite *CRLSuite) TestVerifyDER() {
+	der := filepath.Join(suite.T().TempDir(), "crl.der")
+	suite.Require().NoError(os.WriteFile(der, suite.newCRL(suite.ca, suite.caKey, 1, suite.revoked.SerialNumber), 0600))
+
+	cs, err := NewCRLStore([]string{der}, 0, nil)
+	suite.Require().NoError(err)
+	suite.NoError(cs.Verify(suite.good, suite.chains(suite.good)))
+	suite.assertRevoked(cs.Verify(suite.revoked, suite.chains(suite.revoked)), suite.revoked)
+}
+
+func (suite *CRLSuite) TestVerifyWrongSigner() {
+	// a CRL with the right issuer name but signed by a different key does not apply
+	suite.writeCRL(2, suite.newCRL(suite.otherCA, suite.otherCAKey, 1, suite.good.SerialNumber))
+
+	cs, err := NewCRLStore([]string{suite.crlFile}, 0, nil)
+	suite.Require().NoError(err)
+	suite.NoError(cs.Verify(suite.good, suite.chains(suite.good)))
+}
+
+func (suite *CRLSuite) TestVerifyMultipleBlocks() {
+	suite.writeCRL(
+		2,
+		suite.newCRL(suite.otherCA, suite.otherCAKey, 1),
+		suite.newCRL(suite.ca, suite.caKey, 2, suite.revoked.SerialNumber),
+	)
+
+	cs, err := NewCRLStore([]string{suite.crlFile}, 0, nil)
+	suite.Require().NoError(err)
+	suite.assertRevoked(cs.Verify(suite.revoked, suite.chains(suite.revoked)), suite.revoked)
+}
+
+func (suite *CRLSuite) TestReload() {
+	var (
+		now  = time.Now()
+		errs []error
+	)
+
+	cs, err := NewCRLStore([]string{suite.crlFile}, time.Minute, func(err error) {
+		errs = append(errs, err)
+	})
+
+	suite.Require().NoError(err)
+	cs.now = func() time.Time { return now }
+
+	reloaded, err := cs.Reload()
+	suite.NoError(err)
+	suite.False(reloaded)
+
+	// revoke the good certificate, but not yet time to check
+	suite.writeCRL(2, suite.newCRL(suite.ca, suite.caKey, 2, suite.revoked.SerialNumber, suite.good.SerialNumber))
+	suite.NoError(cs.Verify(suite.good, suite.chains(suite.good)))
+
+	now = now.Add(time.Minute)
+	suite.assertRevoked(cs.Verify(suite.good, suite.chains(suite.good)), suite.good)
+
+	// a reload error retains the current CRLs
+	suite.Require().NoError(os.Remove(suite.crlFile))
+	now = now.Add(time.Minute)
+	suite.assertRevoked(cs.Verify(suite.good, suite.chains(suite.good)), suite.good)
+	suite.Len(errs, 1)
+}
+
+func (suite *CRLSuite) TestPeerVerifyConfig() {
+	pvc := PeerVerifyConfig{
+		CRLFiles: []string{suite.crlFile},
+	}
+
+	v, err := pvc.NewVerifier()
+	suite.Require().NoError(err)
+	suite.Require().NotNil(v)
+	suite.NoError(v(suite.good, suite.chains(suite.good)))
+	suite.assertRevoked(v(suite.revoked, suite.chains(suite.revoked)), suite.revoked)
+
+	// the CRL check applies along with the name checks
+	pvc.CommonNames = []string{"client"}
+	v = pvc.Verifier()
+	suite.Require().NotNil(v)
+	suite.NoError(v(suite.good, suite.chains(suite.good)))
+	suite.assertRevoked(v(suite.revoked, suite.chains(suite.revoked)), suite.revoked)
+
+	pvc.CommonNames = []string{"someone else"}
+	v = pvc.Verifier()
+	suite.Require().NotNil(v)
+	suite.Error(v(suite.good, suite.chains(suite.good)))
+}
+
+func (suite *CRLSuite) TestPeerVerifyConfigMissingFile() {
+	pvc := PeerVerifyConfig{
+		CRLFiles: []string{"missing"},
+	}
+
+	v, err := pvc.NewVerifier()
+	suite.Error(err)
+	suite.Nil(v)
+
+	// Verifier fails closed
+	v = pvc.Verifier()
+	suite.Require().NotNil(v)
+	suite.Error(v(suite.good, suite.chains(suite.good)))
+}
+
+func (suite *CRLSuite) TestConfig() {
+	c := Config{
+		PeerVerify: &PeerVerifyConfig{
+			CRLFiles: []string{suite.crlFile},
+		},
+	}
+
+	tc, err := c.New()
+	suite.Require().NoError(err)
+	suite.Require().NotNil(tc)
+	suite.Require().NotNil(tc.VerifyPeerCertificate)
+	suite.NoError(tc.VerifyPeerCertificate([][]byte{suite.good.Raw}, suite.chains(suite.good)))
+	suite.assertRevoked(tc.VerifyPeerCertificate([][]byte{suite.revoked.Raw}, suite.chains(suite.revoked)), suite.revoked)
+
+	c.PeerVerify.CRLFiles = []string{"missing"}
+	tc, err = c.New()
+	suite.Nil(tc)
+
+	var ee *EntryError
+	suite.Require().ErrorAs(err, &ee)
+	suite.Equal("PeerVerify.CRLFiles", ee.Field)
+}
+
+// TestHandshake verifies that a revoked client certificate is rejected during an actual handshake.
+func (suite *CRLSuite) TestHandshake() {
+	serverCert, err := CreateTestCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "server"},
+		DNSNames:     []string{"server.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	})
+
+	suite.Require().NoError(err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(suite.ca)
+
+	serverConfig, err := (&Config{
+		PeerVerify: &PeerVerifyConfig{CRLFiles: []string{suite.crlFile}},
+	}).New()
+
+	suite.Require().NoError(err)
+	serverConfig.Certificates = []tls.Certificate{*serverCert}
+	serverConfig.ClientCAs = clientCAs
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	handshake := func(leaf *x509.Certificate) error {
+		// reissue the leaf with a key we hold
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		suite.Require().NoError(err)
+		template := *leaf
+		der, err := x509.CreateCertificate(rand.Reader, &template, suite.ca, &key.PublicKey, suite.caKey)
+		suite.Require().NoError(err)
+
+		clientConn, serverConn := net.Pipe()
+		defer clientConn.Close()
+		defer serverConn.Close()
+
+		client := tls.Client(clientConn, &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // only the client certificate matters here
+			Certificates:       []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+			MinVersion:         tls.VersionTLS13,
+		})
+
+		server := tls.Server(serverConn, serverConfig)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.Handshake()
+			server.Close()
+		}()
+
+		_ = client.Handshake()
+		_, _ = client.Read(make([]byte, 1))
+		return <-errs
+	}
+
+	suite.NoError(handshake(suite.good))
+
+	var pve *PeerVerifyError
+	suite.Require().ErrorAs(handshake(suite.revoked), &pve)
+	suite.Equal(suite.revoked.SerialNumber, pve.SerialNumber)
+}
+
+func TestCRL(t *testing.T) {
+	suite.Run(t, new(CRLSuite))
+}
@@ -10,7 +10,8 @@ import (
 )
 
 // CreateTestCertificate creates a self-signed x509 ceritificate for use in testing
-// TLS code.  A 1024-bit RSA key pair is used, and otherwise all defaults are taken.
+// TLS code.  A 4096-bit RSA key pair is used, and otherwise all defaults are taken.
+// arrangetlstest.NewPKI is faster and can issue certificate chains.
 func CreateTestCertificate(template *x509.Certificate) (*tls.Certificate, error) {
 	var (
 		key      *rsa.PrivateKey
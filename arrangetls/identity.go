@@ -0,0 +1,318 @@
+package arrangetls
+
+import (
+	"crypto/x509"
+	"net"
+	"path"
+	"strings"
+)
+
+// MatchMode determines how the identity checks of a PeerVerifyConfig are combined.
+type MatchMode int
+
+const (
+	// MatchAny requires that at least one configured identity check matches.
+	// This is the default.
+	MatchAny MatchMode = iota
+
+	// MatchAll requires that every configured identity check matches.
+	MatchAll
+)
+
+// ParseMatchMode parses the name of a MatchMode.  The recognized names, which are case
+// insensitive, are "any" and "all".  The empty string is parsed as MatchAny.
+func ParseMatchMode(name string) (MatchMode, error) {
+	switch strings.ToLower(name) {
+	case "", "any":
+		return MatchAny, nil
+
+	case "all":
+		return MatchAll, nil
+
+	default:
+		return MatchAny, &UnrecognizedNameError{Kind: "match mode", Name: name}
+	}
+}
+
+// identityMatcher is a single identity check against a peer certificate.
+type identityMatcher struct {
+	// description is used in error messages, e.g. "DNS name"
+	description string
+
+	match func(*x509.Certificate) bool
+}
+
+// identityMatchers is the compiled set of identity checks from a PeerVerifyConfig.
+type identityMatchers struct {
+	mode     MatchMode
+	matchers []identityMatcher
+}
+
+// verify is the PeerVerifier strategy for identity checks.
+func (im identityMatchers) verify(peerCert *x509.Certificate, _ [][]*x509.Certificate) error {
+	var unmatched []string
+	for _, m := range im.matchers {
+		matched := m.match(peerCert)
+		switch {
+		case matched && im.mode == MatchAny:
+			return nil
+
+		case !matched && im.mode == MatchAll:
+			return &PeerVerifyError{
+				Certificate: peerCert,
+				Reason:      "No " + m.description + " matched",
+			}
+
+		case !matched:
+			unmatched = append(unmatched, m.description)
+		}
+	}
+
+	if im.mode == MatchAll {
+		return nil
+	}
+
+	return &PeerVerifyError{
+		Certificate: peerCert,
+		Reason:      "No " + strings.Join(unmatched, " or ") + " matched",
+	}
+}
+
+// newDNSSuffixMatcher matches DNS names or the common name by suffix, case insensitively.
+func newDNSSuffixMatcher(suffixes []string) identityMatcher {
+	lower := make([]string, len(suffixes))
+	for i, suffix := range suffixes {
+		lower[i] = strings.ToLower(suffix)
+	}
+
+	return identityMatcher{
+		description: "DNS name",
+		match: func(peerCert *x509.Certificate) bool {
+			for _, suffix := range lower {
+				for _, dnsName := range peerCert.DNSNames {
+					if strings.HasSuffix(strings.ToLower(dnsName), suffix) {
+						return true
+					}
+				}
+
+				// Allow the common name to be suffixed by a DNS suffix
+				if strings.HasSuffix(strings.ToLower(peerCert.Subject.CommonName), suffix) {
+					return true
+				}
+			}
+
+			return false
+		},
+	}
+}
+
+// containsAny tests if any of the values is in the set.
+func containsAny(set map[string]bool, values ...string) bool {
+	for _, v := range values {
+		if set[v] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newSet creates a set from the given values.
+func newSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
+
+// newCommonNameMatcher matches the subject common name exactly.
+func newCommonNameMatcher(commonNames []string) identityMatcher {
+	set := newSet(commonNames)
+	return identityMatcher{
+		description: "common name",
+		match: func(peerCert *x509.Certificate) bool {
+			return set[peerCert.Subject.CommonName]
+		},
+	}
+}
+
+// newOrganizationMatcher matches any subject organization exactly.
+func newOrganizationMatcher(organizations []string) identityMatcher {
+	set := newSet(organizations)
+	return identityMatcher{
+		description: "organization",
+		match: func(peerCert *x509.Certificate) bool {
+			return containsAny(set, peerCert.Subject.Organization...)
+		},
+	}
+}
+
+// newOrganizationalUnitMatcher matches any subject organizational unit exactly.
+func newOrganizationalUnitMatcher(units []string) identityMatcher {
+	set := newSet(units)
+	return identityMatcher{
+		description: "organizational unit",
+		match: func(peerCert *x509.Certificate) bool {
+			return containsAny(set, peerCert.Subject.OrganizationalUnit...)
+		},
+	}
+}
+
+// hasURIPrefix tests if uri begins with the given prefix on a path segment boundary, so
+// that "spiffe://example.org/ns/a" matches "spiffe://example.org/ns/a/sa/web" but not
+// "spiffe://example.org/ns/admin".
+func hasURIPrefix(uri, prefix string) bool {
+	switch {
+	case !strings.HasPrefix(uri, prefix):
+		return false
+
+	case len(uri) == len(prefix) || strings.HasSuffix(prefix, "/"):
+		return true
+
+	default:
+		return uri[len(prefix)] == '/'
+	}
+}
+
+// newURIMatcher matches URI SANs against prefixes and glob patterns.  Prefixes only match
+// whole path segments.  Patterns use the syntax of path.Match, so a '*' does not match a '/'.
+func newURIMatcher(prefixes, patterns []string) (identityMatcher, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return identityMatcher{}, &UnrecognizedNameError{Kind: "URI pattern", Name: pattern}
+		}
+	}
+
+	prefixes = append([]string{}, prefixes...)
+	patterns = append([]string{}, patterns...)
+	return identityMatcher{
+		description: "URI",
+		match: func(peerCert *x509.Certificate) bool {
+			for _, u := range peerCert.URIs {
+				uri := u.String()
+				for _, prefix := range prefixes {
+					if hasURIPrefix(uri, prefix) {
+						return true
+					}
+				}
+
+				for _, pattern := range patterns {
+					if matched, _ := path.Match(pattern, uri); matched {
+						return true
+					}
+				}
+			}
+
+			return false
+		},
+	}, nil
+}
+
+// newSPIFFEMatcher matches any SPIFFE ID URI SAN in the given trust domain.
+// The trust domain may be given either as a bare name or as a spiffe:// URI.
+func newSPIFFEMatcher(trustDomain string) identityMatcher {
+	trustDomain = strings.TrimSuffix(strings.TrimPrefix(trustDomain, "spiffe://"), "/")
+	return identityMatcher{
+		description: "SPIFFE ID",
+		match: func(peerCert *x509.Certificate) bool {
+			for _, u := range peerCert.URIs {
+				if strings.EqualFold(u.Scheme, "spiffe") && strings.EqualFold(u.Host, trustDomain) {
+					return true
+				}
+			}
+
+			return false
+		},
+	}
+}
+
+// newIPMatcher matches IP SANs against CIDR ranges.  A bare IP address is treated as
+// a range containing only that address.
+func newIPMatcher(ranges []string) (identityMatcher, error) {
+	networks := make([]*net.IPNet, 0, len(ranges))
+	for _, r := range ranges {
+		if _, network, err := net.ParseCIDR(r); err == nil {
+			networks = append(networks, network)
+		} else if ip := net.ParseIP(r); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		} else {
+			return identityMatcher{}, &UnrecognizedNameError{Kind: "IP range", Name: r}
+		}
+	}
+
+	return identityMatcher{
+		description: "IP address",
+		match: func(peerCert *x509.Certificate) bool {
+			for _, ip := range peerCert.IPAddresses {
+				for _, network := range networks {
+					if network.Contains(ip) {
+						return true
+					}
+				}
+			}
+
+			return false
+		},
+	}, nil
+}
+
+// identityVerifier produces the PeerVerifier for the identity checks, or nil if no
+// identity checks are configured.
+func (pvc PeerVerifyConfig) identityVerifier() (PeerVerifier, error) {
+	mode, err := ParseMatchMode(pvc.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	im := identityMatchers{mode: mode}
+	if len(pvc.DNSSuffixes) > 0 {
+		im.matchers = append(im.matchers, newDNSSuffixMatcher(pvc.DNSSuffixes))
+	}
+
+	if len(pvc.CommonNames) > 0 {
+		im.matchers = append(im.matchers, newCommonNameMatcher(pvc.CommonNames))
+	}
+
+	if len(pvc.URIPrefixes) > 0 || len(pvc.URIPatterns) > 0 {
+		m, err := newURIMatcher(pvc.URIPrefixes, pvc.URIPatterns)
+		if err != nil {
+			return nil, err
+		}
+
+		im.matchers = append(im.matchers, m)
+	}
+
+	if len(pvc.SPIFFETrustDomain) > 0 {
+		im.matchers = append(im.matchers, newSPIFFEMatcher(pvc.SPIFFETrustDomain))
+	}
+
+	if len(pvc.IPRanges) > 0 {
+		m, err := newIPMatcher(pvc.IPRanges)
+		if err != nil {
+			return nil, err
+		}
+
+		im.matchers = append(im.matchers, m)
+	}
+
+	if len(pvc.Organizations) > 0 {
+		im.matchers = append(im.matchers, newOrganizationMatcher(pvc.Organizations))
+	}
+
+	if len(pvc.OrganizationalUnits) > 0 {
+		im.matchers = append(im.matchers, newOrganizationalUnitMatcher(pvc.OrganizationalUnits))
+	}
+
+	if len(im.matchers) == 0 {
+		return nil, nil
+	}
+
+	return im.verify, nil
+}
@@ -0,0 +1,215 @@
+package arrangetls
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseURL(t *testing.T, v string) *url.URL {
+	u, err := url.Parse(v)
+	require.NoError(t, err)
+	return u
+}
+
+func TestParseMatchMode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected MatchMode
+	}{
+		{"", MatchAny},
+		{"any", MatchAny},
+		{"ANY", MatchAny},
+		{"all", MatchAll},
+		{"All", MatchAll},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert := assert.New(t)
+			mode, err := ParseMatchMode(testCase.name)
+			assert.NoError(err)
+			assert.Equal(testCase.expected, mode)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			une    *UnrecognizedNameError
+			_, err = ParseMatchMode("some")
+		)
+
+		assert.ErrorAs(err, &une)
+	})
+}
+
+func testPeerVerifyConfigIdentities(t *testing.T) {
+	peerCert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "web",
+			Organization:       []string{"Example Corp"},
+			OrganizationalUnit: []string{"Devices", "Sensors"},
+		},
+		DNSNames:    []string{"web.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("fd00::1")},
+		URIs:        []*url.URL{mustParseURL(t, "spiffe://example.org/ns/prod/sa/web")},
+	}
+
+	testCases := []struct {
+		name     string
+		config   PeerVerifyConfig
+		expected bool
+	}{
+		{"URIPrefix", PeerVerifyConfig{URIPrefixes: []string{"spiffe://example.org/ns/prod/"}}, true},
+		{"URIPrefixMismatch", PeerVerifyConfig{URIPrefixes: []string{"spiffe://example.org/ns/dev/"}}, false},
+		{"URIPrefixSegment", PeerVerifyConfig{URIPrefixes: []string{"spiffe://example.org/ns/prod"}}, true},
+		{"URIPrefixExact", PeerVerifyConfig{URIPrefixes: []string{"spiffe://example.org/ns/prod/sa/web"}}, true},
+		{"URIPrefixPartialSegment", PeerVerifyConfig{URIPrefixes: []string{"spiffe://example.org/ns/pro", "spiffe://example.org/ns/prod/sa/we"}}, false},
+		{"URIPattern", PeerVerifyConfig{URIPatterns: []string{"spiffe://example.org/ns/*/sa/web"}}, true},
+		{"URIPatternNoSlash", PeerVerifyConfig{URIPatterns: []string{"spiffe://example.org/*"}}, false},
+		{"SPIFFE", PeerVerifyConfig{SPIFFETrustDomain: "example.org"}, true},
+		{"SPIFFEURI", PeerVerifyConfig{SPIFFETrustDomain: "spiffe://Example.org"}, true},
+		{"SPIFFEMismatch", PeerVerifyConfig{SPIFFETrustDomain: "example.net"}, false},
+		{"IPv4Range", PeerVerifyConfig{IPRanges: []string{"192.168.0.0/16", "10.0.0.0/8"}}, true},
+		{"IPv6Range", PeerVerifyConfig{IPRanges: []string{"fd00::/8"}}, true},
+		{"SingleIP", PeerVerifyConfig{IPRanges: []string{"10.1.2.3"}}, true},
+		{"IPMismatch", PeerVerifyConfig{IPRanges: []string{"10.1.2.4", "172.16.0.0/12"}}, false},
+		{"Organization", PeerVerifyConfig{Organizations: []string{"Other", "Example Corp"}}, true},
+		{"OrganizationMismatch", PeerVerifyConfig{Organizations: []string{"example corp"}}, false},
+		{"OrganizationalUnit", PeerVerifyConfig{OrganizationalUnits: []string{"Sensors"}}, true},
+		{"OrganizationalUnitMismatch", PeerVerifyConfig{OrganizationalUnits: []string{"Servers"}}, false},
+		{
+			"AnyOneMatches",
+			PeerVerifyConfig{
+				CommonNames:   []string{"nope"},
+				Organizations: []string{"Example Corp"},
+			},
+			true,
+		},
+		{
+			"AllMatch",
+			PeerVerifyConfig{
+				DNSSuffixes:         []string{"example.com"},
+				CommonNames:         []string{"web"},
+				SPIFFETrustDomain:   "example.org",
+				IPRanges:            []string{"10.0.0.0/8"},
+				Organizations:       []string{"Example Corp"},
+				OrganizationalUnits: []string{"Devices"},
+				Match:               "all",
+			},
+			true,
+		},
+		{
+			"AllOneMismatch",
+			PeerVerifyConfig{
+				CommonNames:   []string{"nope"},
+				Organizations: []string{"Example Corp"},
+				Match:         "all",
+			},
+			false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			verifier, err := testCase.config.NewVerifier()
+			require.NoError(err)
+			require.NotNil(verifier)
+
+			err = verifier(peerCert, nil)
+			if testCase.expected {
+				assert.NoError(err)
+			} else {
+				var pve *PeerVerifyError
+				require.ErrorAs(err, &pve)
+				assert.Equal(peerCert, pve.Certificate)
+				assert.Nil(pve.SerialNumber)
+			}
+		})
+	}
+}
+
+func testPeerVerifyConfigReasons(t *testing.T) {
+	var (
+		peerCert = &x509.Certificate{
+			Subject: pkix.Name{CommonName: "web"},
+		}
+
+		testCases = []struct {
+			config   PeerVerifyConfig
+			expected string
+		}{
+			{
+				config:   PeerVerifyConfig{DNSSuffixes: []string{"example.com"}, CommonNames: []string{"nope"}},
+				expected: "No DNS name or common name matched",
+			},
+			{
+				config:   PeerVerifyConfig{CommonNames: []string{"web"}, IPRanges: []string{"10.0.0.0/8"}, Match: "all"},
+				expected: "No IP address matched",
+			},
+		}
+	)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expected, func(t *testing.T) {
+			verifier := testCase.config.Verifier()
+			require.NotNil(t, verifier)
+			assert.EqualError(t, verifier(peerCert, nil), testCase.expected)
+		})
+	}
+}
+
+func testPeerVerifyConfigInvalid(t *testing.T) {
+	testCases := []struct {
+		config PeerVerifyConfig
+		name   string
+	}{
+		{PeerVerifyConfig{URIPatterns: []string{"spiffe://[bad"}}, "spiffe://[bad"},
+		{PeerVerifyConfig{IPRanges: []string{"10.0.0.0/33"}}, "10.0.0.0/33"},
+		{PeerVerifyConfig{IPRanges: []string{"not an ip"}}, "not an ip"},
+		{PeerVerifyConfig{CommonNames: []string{"web"}, Match: "some"}, "some"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				une     *UnrecognizedNameError
+			)
+
+			verifier, err := testCase.config.NewVerifier()
+			require.ErrorAs(err, &une)
+			assert.Equal(testCase.name, une.Name)
+			assert.Nil(verifier)
+
+			// Verifier fails closed
+			verifier = testCase.config.Verifier()
+			require.NotNil(verifier)
+			assert.ErrorAs(verifier(new(x509.Certificate), nil), &une)
+
+			tc, err := (&Config{PeerVerify: &testCase.config}).New()
+			assert.ErrorAs(err, &une)
+			assert.Nil(tc)
+		})
+	}
+}
+
+func TestPeerVerifyConfigIdentity(t *testing.T) {
+	t.Run("Identities", testPeerVerifyConfigIdentities)
+	t.Run("Reasons", testPeerVerifyConfigReasons)
+	t.Run("Invalid", testPeerVerifyConfigInvalid)
+}
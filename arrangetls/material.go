@@ -0,0 +1,194 @@
+package arrangetls
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidMaterial indicates that inline certificate material was neither
+	// a PEM block nor a base64 string.
+	ErrInvalidMaterial = errors.New("Inline material must be either PEM or base64")
+)
+
+const (
+	// pemPrefix is the prefix that identifies inline PEM blocks
+	pemPrefix = "-----BEGIN"
+
+	// derSequence is the first byte of a DER-encoded certificate
+	derSequence = 0x30
+)
+
+// EntryError indicates which entry of a configuration field, such as Certificates
+// or RootCAs, could not be loaded.
+type EntryError struct {
+	// Field is the name of the Config field, e.g. "ClientCAs".  This will be
+	// unset if the entry did not come from a Config.
+	Field string
+
+	// Index is the position of the failed entry.
+	Index int
+
+	// Source describes where the entry's material came from, e.g. a file name.
+	// Inline material is never included in this field.
+	Source string
+
+	// Err is the error that occurred while loading the entry.
+	Err error
+}
+
+// Error satisfies the error interface.  The message identifies the entry along
+// with the underlying error.
+func (ee *EntryError) Error() string {
+	var o strings.Builder
+	if len(ee.Field) > 0 {
+		o.WriteString(ee.Field)
+	} else {
+		o.WriteString("entry")
+	}
+
+	o.WriteRune('[')
+	o.WriteString(strconv.Itoa(ee.Index))
+	o.WriteRune(']')
+	if len(ee.Source) > 0 {
+		o.WriteString(" (")
+		o.WriteString(ee.Source)
+		o.WriteRune(')')
+	}
+
+	o.WriteString(": ")
+	o.WriteString(ee.Err.Error())
+	return o.String()
+}
+
+// Unwrap returns the underlying error.
+func (ee *EntryError) Unwrap() error {
+	return ee.Err
+}
+
+// withField sets the Config field name on err if it is an EntryError.
+// The error is returned as is.
+func withField(field string, err error) error {
+	var ee *EntryError
+	if errors.As(err, &ee) {
+		ee.Field = field
+	}
+
+	return err
+}
+
+// isPEM tests if inline material is a PEM block.
+func isPEM(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), pemPrefix)
+}
+
+// decodeMaterial decodes inline material, which can be either PEM or a base64
+// string.  Whitespace, including line breaks, is permitted in base64 strings.
+func decodeMaterial(value string) ([]byte, error) {
+	if isPEM(value) {
+		return []byte(value), nil
+	}
+
+	encoded := strings.Join(strings.Fields(value), "")
+	if len(encoded) > 0 {
+		if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			return decoded, nil
+		} else if decoded, err := base64.RawStdEncoding.DecodeString(encoded); err == nil {
+			return decoded, nil
+		}
+	}
+
+	return nil, ErrInvalidMaterial
+}
+
+// materialSource describes where material comes from, for use in error messages.
+// Inline material takes precedence over a file.
+func materialSource(inline, file string) string {
+	switch {
+	case len(inline) > 0 && isPEM(inline):
+		return "inline PEM"
+
+	case len(inline) > 0:
+		return "inline base64"
+
+	default:
+		return file
+	}
+}
+
+// materialFile returns the file that material is loaded from, which will be
+// empty if the material is inline.
+func materialFile(inline, file string) string {
+	if len(inline) > 0 {
+		return ""
+	}
+
+	return file
+}
+
+// loadMaterial returns either the decoded inline material or the contents of the
+// given file.  The inline material takes precedence.
+func loadMaterial(inline, file string) ([]byte, error) {
+	switch {
+	case len(inline) > 0:
+		return decodeMaterial(inline)
+
+	case len(file) > 0:
+		return os.ReadFile(file)
+
+	default:
+		return nil, ErrTLSCertificateRequired
+	}
+}
+
+// appendCerts adds certificates to a pool.  The data can be PEM, which can contain
+// a bundle of certificates, or raw DER.
+func appendCerts(pool *x509.CertPool, data []byte) error {
+	if bytes.Contains(data, []byte(pemPrefix)) {
+		if !pool.AppendCertsFromPEM(data) {
+			return ErrUnableToAddClientCACertificate
+		}
+
+		return nil
+	}
+
+	certs, err := x509.ParseCertificates(data)
+	if err != nil || len(certs) == 0 {
+		return ErrUnableToAddClientCACertificate
+	}
+
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+
+	return nil
+}
+
+// looksLikeCerts tests if decoded data is either PEM or a DER sequence.
+func looksLikeCerts(data []byte) bool {
+	return bytes.Contains(data, []byte(pemPrefix)) || (len(data) > 0 && data[0] == derSequence)
+}
+
+// loadPoolEntry loads a single ExternalCertPool entry, returning the certificate data
+// and a description of its source.  An entry that can be read as a file is always read
+// from that file.  Otherwise, only base64 that decodes to something that looks like
+// certificates is treated as inline, so that a mistyped file name reports the file error.
+func loadPoolEntry(entry string) ([]byte, string, error) {
+	if isPEM(entry) {
+		return []byte(entry), "inline PEM", nil
+	}
+
+	data, err := os.ReadFile(entry)
+	if err != nil {
+		if decoded, decodeErr := decodeMaterial(entry); decodeErr == nil && looksLikeCerts(decoded) {
+			return decoded, "inline base64", nil
+		}
+	}
+
+	return data, entry, err
+}
@@ -0,0 +1,300 @@
+package arrangetls
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readMaterial reads the test certificate and key files.
+func readMaterial(t *testing.T) (certPEM, keyPEM string) {
+	require := require.New(t)
+
+	data, err := os.ReadFile(CertificateFile)
+	require.NoError(err)
+	certPEM = string(data)
+
+	data, err = os.ReadFile(KeyFile)
+	require.NoError(err)
+	keyPEM = string(data)
+
+	return
+}
+
+func TestEntryError(t *testing.T) {
+	testCases := []struct {
+		err      EntryError
+		expected string
+	}{
+		{
+			err:      EntryError{Index: 1, Err: errors.New("expected")},
+			expected: "entry[1]: expected",
+		},
+		{
+			err:      EntryError{Field: "RootCAs", Index: 2, Source: "ca.pem", Err: errors.New("expected")},
+			expected: "RootCAs[2] (ca.pem): expected",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expected, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(testCase.expected, testCase.err.Error())
+			assert.Equal(testCase.err.Err, testCase.err.Unwrap())
+		})
+	}
+}
+
+func testExternalCertificateInline(t *testing.T) {
+	var (
+		certPEM, keyPEM = readMaterial(t)
+		certBase64      = base64.StdEncoding.EncodeToString([]byte(certPEM))
+		keyBase64       = base64.StdEncoding.EncodeToString([]byte(keyPEM))
+	)
+
+	testCases := map[string]ExternalCertificate{
+		"PEM":    {CertificatePEM: certPEM, KeyPEM: keyPEM},
+		"Base64": {CertificatePEM: certBase64, KeyPEM: keyBase64},
+		"Mixed":  {CertificateFile: CertificateFile, KeyPEM: keyBase64},
+		"InlineWins": {
+			CertificateFile: "missing",
+			KeyFile:         "missing",
+			CertificatePEM:  certPEM,
+			KeyPEM:          keyPEM,
+		},
+	}
+
+	for name, ec := range testCases {
+		ec := ec
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			cert, err := ec.Load()
+			assert.NoError(err)
+			assert.NotEmpty(cert.Certificate)
+		})
+	}
+}
+
+func testExternalCertificateInvalidInline(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		_, keyPEM = readMaterial(t)
+		ec        = ExternalCertificate{CertificatePEM: "this is not valid!", KeyPEM: keyPEM}
+		cert, err = ec.Load()
+	)
+
+	assert.ErrorIs(err, ErrInvalidMaterial)
+	assert.Empty(cert.Certificate)
+}
+
+func testExternalCertificatesEntryError(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		ecs     = ExternalCertificates{
+			{CertificateFile: CertificateFile, KeyFile: KeyFile},
+			{CertificateFile: CertificateFile, KeyFile: "missing"},
+		}
+
+		ee *EntryError
+	)
+
+	loaded, err := ecs.AppendTo(nil)
+	assert.Len(loaded, 1)
+	require.ErrorAs(err, &ee)
+	assert.Equal(1, ee.Index)
+	assert.Equal(CertificateFile+", missing", ee.Source)
+	assert.ErrorIs(err, fs.ErrNotExist)
+}
+
+func TestExternalCertificateMaterial(t *testing.T) {
+	t.Run("Inline", testExternalCertificateInline)
+	t.Run("InvalidInline", testExternalCertificateInvalidInline)
+	t.Run("EntryError", testExternalCertificatesEntryError)
+}
+
+func testExternalCertPoolInline(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		require    = require.New(t)
+		certPEM, _ = readMaterial(t)
+		block, _   = pem.Decode([]byte(certPEM))
+	)
+
+	require.NotNil(block)
+	ecp := ExternalCertPool{
+		CertificateFile,
+		certPEM,
+		base64.StdEncoding.EncodeToString([]byte(certPEM)),
+		base64.StdEncoding.EncodeToString(block.Bytes),
+	}
+
+	count, err := ecp.AppendTo(x509.NewCertPool())
+	assert.NoError(err)
+	assert.Equal(len(ecp), count)
+}
+
+func testExternalCertPoolEntryErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		entry          string
+		expectedSource string
+		expectedErr    error
+	}{
+		{
+			name:           "MissingFile",
+			entry:          "missing",
+			expectedSource: "missing",
+			expectedErr:    fs.ErrNotExist,
+		},
+		{
+			name:           "InvalidPEM",
+			entry:          "-----BEGIN CERTIFICATE-----\nbogus\n-----END CERTIFICATE-----\n",
+			expectedSource: "inline PEM",
+			expectedErr:    ErrUnableToAddClientCACertificate,
+		},
+		{
+			name:           "InvalidDER",
+			entry:          base64.StdEncoding.EncodeToString([]byte{derSequence, 1, 2, 3}),
+			expectedSource: "inline base64",
+			expectedErr:    ErrUnableToAddClientCACertificate,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				ecp     = ExternalCertPool{CertificateFile, testCase.entry}
+				ee      *EntryError
+			)
+
+			count, err := ecp.AppendTo(x509.NewCertPool())
+			assert.Equal(1, count)
+			require.ErrorAs(err, &ee)
+			assert.Equal(1, ee.Index)
+			assert.Equal(testCase.expectedSource, ee.Source)
+			assert.ErrorIs(err, testCase.expectedErr)
+		})
+	}
+}
+
+func testExternalCertPoolBase64FileName(t *testing.T) {
+	var (
+		assert     = assert.New(t)
+		require    = require.New(t)
+		certPEM, _ = readMaterial(t)
+
+		// this file name is also valid base64 that decodes to something that looks like DER
+		fileName = "MIIBcert"
+	)
+
+	wd, err := os.Getwd()
+	require.NoError(err)
+	require.NoError(os.Chdir(t.TempDir()))
+	defer os.Chdir(wd) //nolint:errcheck
+
+	decoded, err := decodeMaterial(fileName)
+	require.NoError(err)
+	require.True(looksLikeCerts(decoded))
+	require.NoError(os.WriteFile(fileName, []byte(certPEM), 0600))
+
+	data, source, err := loadPoolEntry(fileName)
+	require.NoError(err)
+	assert.Equal(fileName, source)
+	assert.Equal(certPEM, string(data))
+
+	count, err := ExternalCertPool{fileName}.AppendTo(x509.NewCertPool())
+	assert.NoError(err)
+	assert.Equal(1, count)
+}
+
+func TestExternalCertPoolMaterial(t *testing.T) {
+	t.Run("Inline", testExternalCertPoolInline)
+	t.Run("Base64FileName", testExternalCertPoolBase64FileName)
+	t.Run("EntryErrors", testExternalCertPoolEntryErrors)
+}
+
+func testConfigInlineMaterial(t *testing.T) {
+	var (
+		assert          = assert.New(t)
+		require         = require.New(t)
+		certPEM, keyPEM = readMaterial(t)
+
+		c = Config{
+			Certificates: ExternalCertificates{
+				{CertificateFile: CertificateFile, KeyFile: KeyFile},
+				{CertificatePEM: certPEM, KeyPEM: keyPEM},
+			},
+			RootCAs:   ExternalCertPool{certPEM},
+			ClientCAs: ExternalCertPool{CertificateFile, base64.StdEncoding.EncodeToString([]byte(certPEM))},
+		}
+	)
+
+	tc, err := c.New()
+	require.NoError(err)
+	require.NotNil(tc)
+	assert.Len(tc.Certificates, 2)
+	assert.NotNil(tc.RootCAs)
+	assert.NotNil(tc.ClientCAs)
+}
+
+func testConfigEntryErrors(t *testing.T) {
+	testCases := []struct {
+		cfg           Config
+		expectedField string
+	}{
+		{
+			cfg: Config{
+				Certificates: ExternalCertificates{{CertificateFile: "missing", KeyFile: KeyFile}},
+			},
+			expectedField: "Certificates",
+		},
+		{
+			cfg: Config{
+				Certificates: ExternalCertificates{{CertificateFile: "missing", KeyFile: KeyFile}},
+				Reload:       &ReloadConfig{},
+			},
+			expectedField: "Certificates",
+		},
+		{
+			cfg:           Config{RootCAs: ExternalCertPool{"missing"}},
+			expectedField: "RootCAs",
+		},
+		{
+			cfg:           Config{ClientCAs: ExternalCertPool{"missing"}},
+			expectedField: "ClientCAs",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.expectedField, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				ee      *EntryError
+			)
+
+			tc, err := testCase.cfg.New()
+			assert.Nil(tc)
+			require.ErrorAs(err, &ee)
+			assert.Equal(testCase.expectedField, ee.Field)
+			assert.Contains(err.Error(), testCase.expectedField+"[0] (missing")
+		})
+	}
+}
+
+func TestConfigMaterial(t *testing.T) {
+	t.Run("Inline", testConfigInlineMaterial)
+	t.Run("EntryErrors", testConfigEntryErrors)
+}
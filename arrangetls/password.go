@@ -0,0 +1,57 @@
+package arrangetls
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrPasswordEnvNotSet indicates that a PasswordSource refers to an environment
+	// variable that is not set.
+	ErrPasswordEnvNotSet = errors.New("Password environment variable is not set")
+)
+
+// PasswordSource describes where a password comes from.  At most one field should be set.
+// If more than one is set, Value takes precedence, followed by Env, followed by File.
+// The zero value is an empty password.
+type PasswordSource struct {
+	// Value is a literal password.
+	Value string
+
+	// Env is the name of an environment variable that holds the password.
+	Env string
+
+	// File is the name of a file that holds the password.  Any trailing line
+	// breaks are removed.
+	File string
+}
+
+// Load returns the password from this source.
+func (ps PasswordSource) Load() (string, error) {
+	switch {
+	case len(ps.Value) > 0:
+		return ps.Value, nil
+
+	case len(ps.Env) > 0:
+		if password, ok := os.LookupEnv(ps.Env); ok {
+			return password, nil
+		}
+
+		return "", &causeError{
+			err:   ErrPasswordEnvNotSet,
+			cause: errors.New(ps.Env),
+		}
+
+	case len(ps.File) > 0:
+		data, err := os.ReadFile(ps.File)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,353 @@
+package arrangetls
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"  //nolint:gosec // 3DES is required to read legacy keys
+	"crypto/sha1" //nolint:gosec // SHA-1 is required to read legacy keys
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	// ErrIncorrectPassword indicates that an encrypted private key or PKCS#12 bundle
+	// could not be decrypted with the configured password.
+	ErrIncorrectPassword = errors.New("Incorrect password")
+
+	// ErrMalformedPrivateKey indicates that an encrypted PKCS#8 private key could not be parsed.
+	ErrMalformedPrivateKey = errors.New("Malformed encrypted private key")
+
+	// ErrUnsupportedEncryption indicates that an encrypted private key or PKCS#12 bundle
+	// uses an encryption or integrity scheme that is not supported.
+	ErrUnsupportedEncryption = errors.New("Unsupported encryption algorithm")
+)
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// causeError associates a sentinel error with the underlying cause.  errors.Is
+// matches the sentinel, while the cause is available via errors.Unwrap.
+type causeError struct {
+	err   error
+	cause error
+}
+
+func (ce *causeError) Error() string {
+	return ce.err.Error() + ": " + ce.cause.Error()
+}
+
+func (ce *causeError) Is(target error) bool {
+	return target == ce.err //nolint:errorlint // sentinel comparison
+}
+
+func (ce *causeError) Unwrap() error {
+	return ce.cause
+}
+
+// malformed associates err with the given sentinel, unless err already indicates
+// an incorrect password or unsupported algorithm.
+func malformed(sentinel, err error) error {
+	if err == nil || errors.Is(err, ErrIncorrectPassword) || errors.Is(err, ErrUnsupportedEncryption) || errors.Is(err, sentinel) {
+		return err
+	}
+
+	return &causeError{err: sentinel, cause: err}
+}
+
+// unsupported produces an error for an unsupported algorithm.
+func unsupported(algorithm asn1.ObjectIdentifier) error {
+	return &causeError{
+		err:   ErrUnsupportedEncryption,
+		cause: errors.New(algorithm.String()),
+	}
+}
+
+// hmacHashes maps the PBES2 pseudorandom functions onto hashes
+var hmacHashes = map[string]func() hash.Hash{
+	oidHMACWithSHA1.String():   sha1.New,
+	oidHMACWithSHA224.String(): sha256.New224,
+	oidHMACWithSHA256.String(): sha256.New,
+	oidHMACWithSHA384.String(): sha512.New384,
+	oidHMACWithSHA512.String(): sha512.New,
+}
+
+// pbes2Params is the ASN.1 structure of the PBES2 parameters defined in RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is the ASN.1 structure of the PBKDF2 parameters defined in RFC 8018.
+// Only the specified salt is supported.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// pbeParams is the ASN.1 structure of the PKCS#12 password-based encryption parameters.
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// pkcs12Key derives key material using the PKCS#12 key derivation function defined
+// in RFC 7292, Appendix B.  The id selects the purpose of the material:  1 for
+// encryption keys and 2 for IVs.  The password must already be encoded with bmpPassword.
+func pkcs12Key(h func() hash.Hash, id byte, password, salt []byte, iterations, size int) []byte {
+	var (
+		hh = h()
+		u  = hh.Size()
+		v  = hh.BlockSize()
+	)
+
+	// fill repeats b to a multiple of the block size
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+
+		filled := make([]byte, v*((len(b)+v-1)/v))
+		for i := range filled {
+			filled[i] = b[i%len(b)]
+		}
+
+		return filled
+	}
+
+	var (
+		d   = make([]byte, v)
+		in  = append(fill(salt), fill(password)...)
+		out = make([]byte, 0, size+u)
+		b   = make([]byte, v)
+	)
+
+	for i := range d {
+		d[i] = id
+	}
+
+	for {
+		hh.Reset()
+		hh.Write(d)
+		hh.Write(in)
+		a := hh.Sum(nil)
+		for n := 1; n < iterations; n++ {
+			hh.Reset()
+			hh.Write(a)
+			a = hh.Sum(a[:0])
+		}
+
+		out = append(out, a...)
+		if len(out) >= size {
+			return out[:size]
+		}
+
+		// each block of the input is incremented by b + 1
+		for i := range b {
+			b[i] = a[i%u]
+		}
+
+		for j := 0; j < len(in); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(in[j+k]) + int(b[k]) + carry
+				in[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+}
+
+// bmpPassword encodes a password as a null-terminated BMPString, as required by
+// the PKCS#12 key derivation function.
+func bmpPassword(password string) []byte {
+	encoded := utf16.Encode([]rune(password))
+	bmp := make([]byte, 0, 2*len(encoded)+2)
+	for _, c := range encoded {
+		bmp = append(bmp, byte(c>>8), byte(c))
+	}
+
+	return append(bmp, 0, 0)
+}
+
+// unmarshalParameters unmarshals the parameters of an algorithm, rejecting trailing data.
+func unmarshalParameters(algorithm pkix.AlgorithmIdentifier, v any) error {
+	rest, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, v)
+	if err == nil && len(rest) > 0 {
+		err = errors.New("trailing data after algorithm parameters")
+	}
+
+	return err
+}
+
+// pbes2Cipher creates the block cipher and IV for the PBES2 scheme.  PBES2 uses
+// the password as is.
+func pbes2Cipher(algorithm pkix.AlgorithmIdentifier, password string) (cipher.Block, []byte, error) {
+	var params pbes2Params
+	if err := unmarshalParameters(algorithm, &params); err != nil {
+		return nil, nil, err
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, unsupported(params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if err := unmarshalParameters(params.KeyDerivationFunc, &kdf); err != nil {
+		return nil, nil, err
+	}
+
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = hmacHashes[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, nil, unsupported(kdf.PRF.Algorithm)
+		}
+	}
+
+	var (
+		keyLen    int
+		newCipher func([]byte) (cipher.Block, error)
+		scheme    = params.EncryptionScheme.Algorithm
+	)
+
+	switch {
+	case scheme.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+
+	case scheme.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+
+	case scheme.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+
+	default:
+		return nil, nil, unsupported(scheme)
+	}
+
+	var iv []byte
+	if err := unmarshalParameters(params.EncryptionScheme, &iv); err != nil {
+		return nil, nil, err
+	}
+
+	block, err := newCipher(
+		pbkdf2.Key([]byte(password), kdf.Salt, kdf.IterationCount, keyLen, prf),
+	)
+
+	if err == nil && len(iv) != block.BlockSize() {
+		err = errors.New("invalid IV length")
+	}
+
+	return block, iv, err
+}
+
+// pbeCipher creates the block cipher and IV for a password-based encryption algorithm.  PBES2
+// is supported, as is the legacy pbeWithSHAAnd3-KeyTripleDES-CBC scheme from PKCS#12.
+func pbeCipher(algorithm pkix.AlgorithmIdentifier, password string) (cipher.Block, []byte, error) {
+	switch {
+	case algorithm.Algorithm.Equal(oidPBES2):
+		return pbes2Cipher(algorithm, password)
+
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+		var params pbeParams
+		if err := unmarshalParameters(algorithm, &params); err != nil {
+			return nil, nil, err
+		}
+
+		bmp := bmpPassword(password)
+		block, err := des.NewTripleDESCipher(
+			pkcs12Key(sha1.New, 1, bmp, params.Salt, params.Iterations, 24),
+		)
+
+		return block, pkcs12Key(sha1.New, 2, bmp, params.Salt, params.Iterations, des.BlockSize), err
+
+	default:
+		return nil, nil, unsupported(algorithm.Algorithm)
+	}
+}
+
+// pbeDecrypt decrypts data using a password-based encryption algorithm.  Invalid
+// padding is reported as ErrIncorrectPassword.
+func pbeDecrypt(algorithm pkix.AlgorithmIdentifier, password string, data []byte) ([]byte, error) {
+	block, iv, err := pbeCipher(algorithm, password)
+	if err != nil {
+		return nil, err
+	}
+
+	size := block.BlockSize()
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, errors.New("encrypted data is not a multiple of the block size")
+	}
+
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > size {
+		return nil, ErrIncorrectPassword
+	}
+
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, ErrIncorrectPassword
+		}
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// encryptedPrivateKeyInfo is the ASN.1 structure of an encrypted PKCS#8 private key.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// decryptPKCS8 decrypts a DER-encoded, encrypted PKCS#8 private key.  The returned
+// bytes are the unencrypted, DER-encoded PKCS#8 private key.
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+	var epki encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &epki); err != nil {
+		return nil, malformed(ErrMalformedPrivateKey, err)
+	} else if len(rest) > 0 {
+		return nil, malformed(ErrMalformedPrivateKey, errors.New("trailing data after private key"))
+	}
+
+	decrypted, err := pbeDecrypt(epki.Algorithm, password, epki.EncryptedData)
+	if err != nil {
+		return nil, malformed(ErrMalformedPrivateKey, err)
+	}
+
+	// the padding can be valid by chance, so verify that the decrypted key parses
+	if _, err := x509.ParsePKCS8PrivateKey(decrypted); err != nil {
+		return nil, ErrIncorrectPassword
+	}
+
+	return decrypted, nil
+}
@@ -0,0 +1,133 @@
+package arrangetls
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	// ErrMalformedBundle indicates that a PKCS#12 bundle could not be parsed.
+	ErrMalformedBundle = errors.New("Malformed PKCS#12 bundle")
+)
+
+// bundleError translates an error from the pkcs12 package into this package's errors.
+func bundleError(err error) error {
+	var nie pkcs12.NotImplementedError
+	switch {
+	case errors.Is(err, pkcs12.ErrIncorrectPassword), errors.Is(err, pkcs12.ErrDecryption):
+		return &causeError{err: ErrIncorrectPassword, cause: err}
+
+	case errors.As(err, &nie):
+		return &causeError{err: ErrUnsupportedEncryption, cause: err}
+
+	default:
+		return malformed(ErrMalformedBundle, err)
+	}
+}
+
+// pfxMAC is just enough of the ASN.1 structure of a PKCS#12 bundle to tell whether it has a MAC.
+type pfxMAC struct {
+	Version  int
+	AuthSafe asn1.RawValue
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+// hasMAC tests if a bundle has a MAC.  A bundle that cannot be parsed is reported as
+// having one, so that decoding reports the actual problem.
+func hasMAC(der []byte) bool {
+	var pfx pfxMAC
+	if _, err := asn1.Unmarshal(der, &pfx); err != nil {
+		return true
+	}
+
+	return len(pfx.MacData.FullBytes) > 0
+}
+
+// decodePKCS12 decodes a DER-encoded PKCS#12 bundle, which must contain exactly one
+// private key and its certificate.  Any other certificates in the bundle are returned
+// as the rest of the chain, ordered from the leaf toward the root where possible.
+//
+// Only password integrity mode is supported.  A bundle without a MAC can only be decoded
+// with an empty password, so with any other password it is reported as ErrUnsupportedEncryption.
+// Incorrect passwords are reported as ErrIncorrectPassword, and structural problems as
+// ErrMalformedBundle.
+func decodePKCS12(der []byte, password string) (tls.Certificate, error) {
+	if len(password) > 0 && !hasMAC(der) {
+		return tls.Certificate{}, &causeError{
+			err:   ErrUnsupportedEncryption,
+			cause: errors.New("a password was supplied for a bundle without a MAC"),
+		}
+	}
+
+	key, cert, caCerts, err := pkcs12.DecodeChain(der, password)
+	if err != nil {
+		return tls.Certificate{}, bundleError(err)
+	}
+
+	return bundleCertificate(key, append([]*x509.Certificate{cert}, caCerts...))
+}
+
+// bundleCertificate assembles a tls.Certificate from a private key and the certificates
+// from a bundle.  The leaf is the certificate that matches the private key.
+func bundleCertificate(key crypto.PrivateKey, certs []*x509.Certificate) (tls.Certificate, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, malformed(ErrMalformedBundle, errors.New("unsupported private key type"))
+	}
+
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return tls.Certificate{}, malformed(ErrMalformedBundle, errors.New("unsupported public key type"))
+	}
+
+	var leaf *x509.Certificate
+	remaining := make([]*x509.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		if leaf == nil && public.Equal(cert.PublicKey) {
+			leaf = cert
+		} else {
+			remaining = append(remaining, cert)
+		}
+	}
+
+	if leaf == nil {
+		return tls.Certificate{}, malformed(ErrMalformedBundle, errors.New("no certificate matches the private key"))
+	}
+
+	tc := tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+
+	// walk the chain from the leaf toward the root, then add anything left over
+	for current := leaf; len(remaining) > 0; {
+		next := -1
+		for i, cert := range remaining {
+			if bytes.Equal(current.RawIssuer, cert.RawSubject) {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			break
+		}
+
+		current = remaining[next]
+		tc.Certificate = append(tc.Certificate, current.Raw)
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+
+	for _, cert := range remaining {
+		tc.Certificate = append(tc.Certificate, cert.Raw)
+	}
+
+	return tc, nil
+}
@@ -0,0 +1,151 @@
+package arrangetls
+
+import (
+	"crypto/tls"
+	"strconv"
+	"strings"
+)
+
+// UnrecognizedNameError indicates that a configured name, such as a cipher suite
+// or curve, is not recognized.
+type UnrecognizedNameError struct {
+	// Kind describes what sort of name this is, e.g. "cipher suite".
+	Kind string
+
+	// Name is the configured name that could not be recognized.
+	Name string
+}
+
+// Error satisfies the error interface.
+func (une *UnrecognizedNameError) Error() string {
+	return "Unrecognized " + une.Kind + ": " + strconv.Quote(une.Name)
+}
+
+// ParseCipherSuite parses the standard name of a cipher suite, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+// Matching is case insensitive.  Only the suites returned by tls.CipherSuites are recognized, so
+// insecure suites cannot be configured.
+//
+// Note that cipher suites only apply to TLS versions less than 1.3.
+func ParseCipherSuite(name string) (uint16, error) {
+	for _, cs := range tls.CipherSuites() {
+		if strings.EqualFold(cs.Name, name) {
+			return cs.ID, nil
+		}
+	}
+
+	return 0, &UnrecognizedNameError{Kind: "cipher suite", Name: name}
+}
+
+// ParseCurve parses the name of an elliptic curve.  The recognized names, which are
+// case insensitive, are "X25519", "P-256", "P-384", and "P-521".  The forms "P256" and
+// "CurveP256" are also accepted for the NIST curves.
+func ParseCurve(name string) (tls.CurveID, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "CURVE") {
+	case "X25519":
+		return tls.X25519, nil
+
+	case "P256", "P-256":
+		return tls.CurveP256, nil
+
+	case "P384", "P-384":
+		return tls.CurveP384, nil
+
+	case "P521", "P-521":
+		return tls.CurveP521, nil
+
+	default:
+		return 0, &UnrecognizedNameError{Kind: "curve", Name: name}
+	}
+}
+
+// ParseClientAuth parses the name of a client authentication policy.  The recognized
+// names, which are case insensitive, are:
+//
+//	"none" => tls.NoClientCert
+//	"request" => tls.RequestClientCert
+//	"require-any" => tls.RequireAnyClientCert
+//	"verify-if-given" => tls.VerifyClientCertIfGiven
+//	"require-and-verify" => tls.RequireAndVerifyClientCert
+func ParseClientAuth(name string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return tls.NoClientCert, nil
+
+	case "request":
+		return tls.RequestClientCert, nil
+
+	case "require-any":
+		return tls.RequireAnyClientCert, nil
+
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+
+	case "require-and-verify":
+		return tls.RequireAndVerifyClientCert, nil
+
+	default:
+		return tls.NoClientCert, &UnrecognizedNameError{Kind: "client auth", Name: name}
+	}
+}
+
+// cipherSuites returns the cipher suites to use for TLS versions less than 1.3.
+// If no cipher suites are configured, strongCipherSuites is used.
+func (c *Config) cipherSuites() ([]uint16, error) {
+	if len(c.CipherSuites) == 0 {
+		return strongCipherSuites, nil
+	}
+
+	ids := make([]uint16, 0, len(c.CipherSuites))
+	for _, name := range c.CipherSuites {
+		id, err := ParseCipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// curvePreferences returns the configured curves, or nil to use the crypto/tls defaults.
+func (c *Config) curvePreferences() ([]tls.CurveID, error) {
+	if len(c.CurvePreferences) == 0 {
+		return nil, nil
+	}
+
+	curves := make([]tls.CurveID, 0, len(c.CurvePreferences))
+	for _, name := range c.CurvePreferences {
+		curve, err := ParseCurve(name)
+		if err != nil {
+			return nil, err
+		}
+
+		curves = append(curves, curve)
+	}
+
+	return curves, nil
+}
+
+// policy configures the cipher suites, curves, and client auth policy.  This method
+// must be called after the certificate pools have been set on the tls.Config, as the
+// default client auth depends upon whether ClientCAs were configured.
+func (c *Config) policy(tc *tls.Config) (err error) {
+	if tc.CipherSuites, err = c.cipherSuites(); err != nil {
+		return
+	}
+
+	if tc.CurvePreferences, err = c.curvePreferences(); err != nil {
+		return
+	}
+
+	switch {
+	case len(c.ClientAuth) > 0:
+		tc.ClientAuth, err = ParseClientAuth(c.ClientAuth)
+
+	case tc.ClientCAs != nil:
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return
+}
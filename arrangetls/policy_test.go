@@ -0,0 +1,193 @@
+package arrangetls
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCipherSuite(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		for _, cs := range tls.CipherSuites() {
+			t.Run(cs.Name, func(t *testing.T) {
+				assert := assert.New(t)
+
+				id, err := ParseCipherSuite(cs.Name)
+				assert.NoError(err)
+				assert.Equal(cs.ID, id)
+			})
+		}
+	})
+
+	t.Run("CaseInsensitive", func(t *testing.T) {
+		assert := assert.New(t)
+
+		id, err := ParseCipherSuite("tls_ecdhe_rsa_with_chacha20_poly1305_sha256")
+		assert.NoError(err)
+		assert.Equal(tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, id)
+	})
+
+	for _, name := range []string{"", "unknown", tls.CipherSuiteName(tls.TLS_RSA_WITH_RC4_128_SHA)} {
+		t.Run("Invalid/"+name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+				une    *UnrecognizedNameError
+				_, err = ParseCipherSuite(name)
+			)
+
+			assert.ErrorAs(err, &une)
+			assert.Equal(name, une.Name)
+			assert.Contains(err.Error(), "cipher suite")
+		})
+	}
+}
+
+func TestParseCurve(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected tls.CurveID
+	}{
+		{"X25519", tls.X25519},
+		{"x25519", tls.X25519},
+		{"P-256", tls.CurveP256},
+		{"p256", tls.CurveP256},
+		{"CurveP256", tls.CurveP256},
+		{"P-384", tls.CurveP384},
+		{"CurveP384", tls.CurveP384},
+		{"P-521", tls.CurveP521},
+		{"P521", tls.CurveP521},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			curve, err := ParseCurve(testCase.name)
+			assert.NoError(err)
+			assert.Equal(testCase.expected, curve)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			une    *UnrecognizedNameError
+			_, err = ParseCurve("P-192")
+		)
+
+		assert.ErrorAs(err, &une)
+		assert.Equal("P-192", une.Name)
+	})
+}
+
+func TestParseClientAuth(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected tls.ClientAuthType
+	}{
+		{"none", tls.NoClientCert},
+		{"request", tls.RequestClientCert},
+		{"require-any", tls.RequireAnyClientCert},
+		{"verify-if-given", tls.VerifyClientCertIfGiven},
+		{"require-and-verify", tls.RequireAndVerifyClientCert},
+		{"Require-And-Verify", tls.RequireAndVerifyClientCert},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			clientAuth, err := ParseClientAuth(testCase.name)
+			assert.NoError(err)
+			assert.Equal(testCase.expected, clientAuth)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			une    *UnrecognizedNameError
+			_, err = ParseClientAuth("always")
+		)
+
+		assert.ErrorAs(err, &une)
+		assert.Equal("always", une.Name)
+	})
+}
+
+func testConfigPolicyDefaults(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		tc, err = new(Config).New()
+	)
+
+	require.NoError(err)
+	require.NotNil(tc)
+	assert.Equal(strongCipherSuites, tc.CipherSuites)
+	assert.Nil(tc.CurvePreferences)
+	assert.Equal(tls.NoClientCert, tc.ClientAuth)
+}
+
+func testConfigPolicyCustom(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		c       = Config{
+			CipherSuites: []string{
+				"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+				"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			},
+			CurvePreferences: []string{"X25519", "P-256"},
+			ClientAuth:       "verify-if-given",
+			ClientCAs:        ExternalCertPool{CertificateFile},
+		}
+	)
+
+	tc, err := c.New()
+	require.NoError(err)
+	require.NotNil(tc)
+
+	assert.Equal(
+		[]uint16{
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		tc.CipherSuites,
+	)
+
+	assert.Equal([]tls.CurveID{tls.X25519, tls.CurveP256}, tc.CurvePreferences)
+	assert.NotNil(tc.ClientCAs)
+	assert.Equal(tls.VerifyClientCertIfGiven, tc.ClientAuth)
+}
+
+func testConfigPolicyInvalid(t *testing.T) {
+	testCases := []Config{
+		{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "unknown"}},
+		{CurvePreferences: []string{"unknown"}},
+		{ClientAuth: "unknown"},
+	}
+
+	for _, c := range testCases {
+		c := c
+		t.Run("", func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				une     *UnrecognizedNameError
+				tc, err = c.New()
+			)
+
+			assert.ErrorAs(err, &une)
+			assert.Equal("unknown", une.Name)
+			assert.Nil(tc)
+		})
+	}
+}
+
+func TestConfigPolicy(t *testing.T) {
+	t.Run("Defaults", testConfigPolicyDefaults)
+	t.Run("Custom", testConfigPolicyCustom)
+	t.Run("Invalid", testConfigPolicyInvalid)
+}
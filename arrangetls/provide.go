@@ -0,0 +1,58 @@
+package arrangetls
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"github.com/xmidt-org/arrange"
+	"go.uber.org/fx"
+)
+
+var (
+	// ErrConfigNameRequired indicates that ProvideConfig was called with an empty name.
+	ErrConfigNameRequired = errors.New("A TLS configuration name is required")
+)
+
+// BindCertificateStore binds a CertificateStore to the enclosing application's lifecycle.
+// The store starts watching its files when the application starts, and stops when the
+// application stops.
+func BindCertificateStore(cs *CertificateStore, lifecycle fx.Lifecycle) {
+	lifecycle.Append(
+		fx.StartStopHook(cs.Start, cs.Stop),
+	)
+}
+
+// ProvideConfig provides a *tls.Config built from a Config.  The name parameter is used
+// as both the name of the *tls.Config component and a prefix for its dependencies:
+//
+//   - *Config is an optional dependency with the name name+".config"
+//   - func(error) is an optional dependency with the name name+".errors", which receives certificate reload errors and any *SelfSignedNotice
+//   - []PeerVerifier is an optional value group dependency with the name name+".verifiers"
+//
+// If the Config is missing or nil, the provided *tls.Config will be nil.  If the Config enables
+// Reload, the CertificateStore backing the certificates is bound to the application's lifecycle
+// via BindCertificateStore.
+func ProvideConfig(name string) fx.Option {
+	if len(name) == 0 {
+		return fx.Error(ErrConfigNameRequired)
+	}
+
+	return fx.Provide(
+		fx.Annotate(
+			func(c *Config, onError func(error), extra []PeerVerifier, lifecycle fx.Lifecycle) (*tls.Config, error) {
+				tc, cs, err := c.NewWithStore(onError, extra...)
+				if cs != nil {
+					BindCertificateStore(cs, lifecycle)
+				}
+
+				return tc, err
+			},
+			arrange.Tags().
+				OptionalName(name+".config").
+				OptionalName(name+".errors").
+				Group(name+".verifiers").
+				ParamTags(),
+			arrange.Tags().Name(name).ResultTags(),
+		),
+	)
+}
@@ -0,0 +1,265 @@
+package arrangetls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSelfSignedValidity is the validity period of a self-signed certificate
+	// when SelfSignedConfig.ValidFor is unset.
+	DefaultSelfSignedValidity = 90 * 24 * time.Hour
+
+	// DefaultSelfSignedHost is the host used for a self-signed certificate when
+	// no hosts are configured.
+	DefaultSelfSignedHost = "localhost"
+
+	// SelfSignedCertificateFile is the name of the certificate file written to SelfSignedConfig.CacheDir.
+	SelfSignedCertificateFile = "selfsigned-cert.pem"
+
+	// SelfSignedKeyFile is the name of the key file written to SelfSignedConfig.CacheDir.
+	SelfSignedKeyFile = "selfsigned-key.pem"
+)
+
+// SelfSignedNotice reports that a self-signed certificate is in use, along with the fingerprint
+// a developer needs in order to trust it.  It is not a failure:  it is sent to the onError callback
+// passed to Config.NewWithStore, so that it can be logged wherever the application logs.
+type SelfSignedNotice struct {
+	// Hosts are the DNS names and IP addresses the certificate is valid for.
+	Hosts []string
+
+	// Fingerprint is the SHA-256 fingerprint of the certificate.  See Fingerprint.
+	Fingerprint string
+}
+
+// Error describes the self-signed certificate.
+func (ssn *SelfSignedNotice) Error() string {
+	return "using self-signed certificate for " + strings.Join(ssn.Hosts, ", ") +
+		" with SHA-256 fingerprint " + ssn.Fingerprint
+}
+
+// SelfSignedConfig describes a self-signed certificate generated at startup.  This is intended
+// for development servers that have no real certificates.  It is never appropriate for production.
+type SelfSignedConfig struct {
+	// Hosts are the DNS names or IP addresses, in addition to Config.ServerName, that the
+	// certificate is valid for.  If neither is set, DefaultSelfSignedHost is used.
+	Hosts []string
+
+	// ValidFor is how long the certificate is valid.  If unset, DefaultSelfSignedValidity is used.
+	ValidFor time.Duration
+
+	// CacheDir is the optional directory where the certificate and key are persisted, so that
+	// a browser that trusts the certificate will continue to trust it across restarts.  A cached
+	// certificate is reused as long as it is unexpired and valid for all the hosts.  Otherwise,
+	// a new certificate is generated and written over it.
+	CacheDir string
+}
+
+// hosts returns the hosts the certificate must be valid for.
+func (ssc SelfSignedConfig) hosts(serverName string) []string {
+	var hosts []string
+	if len(serverName) > 0 {
+		hosts = append(hosts, serverName)
+	}
+
+	for _, h := range ssc.Hosts {
+		if len(h) > 0 {
+			hosts = append(hosts, h)
+		}
+	}
+
+	if len(hosts) == 0 {
+		hosts = append(hosts, DefaultSelfSignedHost)
+	}
+
+	return hosts
+}
+
+// Certificate returns the self-signed certificate for the given server name, which may be empty.
+// If CacheDir is set, the cached certificate is used when it is still suitable.  Otherwise, a
+// new certificate is generated and, if CacheDir is set, written to the cache.
+func (ssc SelfSignedConfig) Certificate(serverName string) (tls.Certificate, error) {
+	hosts := ssc.hosts(serverName)
+	if len(ssc.CacheDir) > 0 {
+		if cert, ok := ssc.loadCached(hosts); ok {
+			return cert, nil
+		}
+	}
+
+	certPEM, keyPEM, err := ssc.generate(hosts)
+	if err == nil && len(ssc.CacheDir) > 0 {
+		err = ssc.writeCache(certPEM, keyPEM)
+	}
+
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return parseKeyPair(certPEM, keyPEM)
+}
+
+// loadCached returns the cached certificate if it exists, is unexpired, and is valid for each host.
+func (ssc SelfSignedConfig) loadCached(hosts []string) (tls.Certificate, bool) {
+	cert, err := tls.LoadX509KeyPair(
+		filepath.Join(ssc.CacheDir, SelfSignedCertificateFile),
+		filepath.Join(ssc.CacheDir, SelfSignedKeyFile),
+	)
+
+	if err == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	if err != nil || !time.Now().Before(cert.Leaf.NotAfter) {
+		return tls.Certificate{}, false
+	}
+
+	for _, h := range hosts {
+		if cert.Leaf.VerifyHostname(h) != nil {
+			return tls.Certificate{}, false
+		}
+	}
+
+	return cert, true
+}
+
+// generate creates a new ECDSA P-256 key and a self-signed certificate for the hosts.
+func (ssc SelfSignedConfig) generate(hosts []string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validFor := ssc.ValidFor
+	if validFor <= 0 {
+		validFor = DefaultSelfSignedValidity
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   hosts[0],
+			Organization: []string{"arrange self-signed development certificate"},
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+// writeCache persists the certificate and key to CacheDir, creating it if necessary.
+func (ssc SelfSignedConfig) writeCache(certPEM, keyPEM []byte) error {
+	err := os.MkdirAll(ssc.CacheDir, 0700)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(ssc.CacheDir, SelfSignedKeyFile), keyPEM, 0600)
+	}
+
+	if err == nil {
+		err = os.WriteFile(filepath.Join(ssc.CacheDir, SelfSignedCertificateFile), certPEM, 0600)
+	}
+
+	return err
+}
+
+// parseKeyPair is tls.X509KeyPair with the Leaf populated.
+func parseKeyPair(certPEM, keyPEM []byte) (tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	return cert, err
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate as colon-separated,
+// uppercase hex, the form that browsers display.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	encoded := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	var o strings.Builder
+	for i := 0; i < len(encoded); i += 2 {
+		if i > 0 {
+			o.WriteRune(':')
+		}
+
+		o.WriteString(encoded[i : i+2])
+	}
+
+	return o.String()
+}
+
+// selfSigned sets a self-signed certificate on the tls.Config when SelfSigned is configured
+// and no Certificates are.  A SelfSignedNotice is sent to onError or, if onError is nil,
+// written to the standard logger.
+func (c *Config) selfSigned(tc *tls.Config, onError func(error)) (bool, error) {
+	if c.SelfSigned == nil || c.Certificates.Len() > 0 {
+		return false, nil
+	}
+
+	cert, err := c.SelfSigned.Certificate(c.ServerName)
+	if err != nil {
+		return false, err
+	}
+
+	notice := &SelfSignedNotice{
+		Hosts:       append([]string{}, cert.Leaf.DNSNames...),
+		Fingerprint: Fingerprint(cert.Leaf),
+	}
+
+	for _, ip := range cert.Leaf.IPAddresses {
+		notice.Hosts = append(notice.Hosts, ip.String())
+	}
+
+	if onError != nil {
+		onError(notice)
+	} else {
+		log.Printf("arrangetls: %s", notice)
+	}
+
+	tc.Certificates = []tls.Certificate{cert}
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package arrangetls
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SelfSignedSuite struct {
+	suite.Suite
+}
+
+func (suite *SelfSignedSuite) TestDefaultHost() {
+	cert, err := SelfSignedConfig{}.Certificate("")
+	suite.Require().NoError(err)
+	suite.Require().NotNil(cert.Leaf)
+	suite.Equal([]string{DefaultSelfSignedHost}, cert.Leaf.DNSNames)
+	suite.WithinDuration(time.Now().Add(DefaultSelfSignedValidity), cert.Leaf.NotAfter, time.Minute)
+}
+
+func (suite *SelfSignedSuite) TestHosts() {
+	cert, err := SelfSignedConfig{
+		Hosts:    []string{"localhost", "127.0.0.1", "::1"},
+		ValidFor: time.Hour,
+	}.Certificate("dev.example.com")
+
+	suite.Require().NoError(err)
+	suite.Equal("dev.example.com", cert.Leaf.Subject.CommonName)
+	suite.Equal([]string{"dev.example.com", "localhost"}, cert.Leaf.DNSNames)
+	suite.Len(cert.Leaf.IPAddresses, 2)
+	suite.WithinDuration(time.Now().Add(time.Hour), cert.Leaf.NotAfter, time.Minute)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	for _, host := range []string{"dev.example.com", "localhost", "127.0.0.1", "::1"} {
+		_, err := cert.Leaf.Verify(x509.VerifyOptions{
+			DNSName: host,
+			Roots:   pool,
+		})
+
+		suite.NoError(err, host)
+	}
+}
+
+func (suite *SelfSignedSuite) TestCache() {
+	ssc := SelfSignedConfig{
+		CacheDir: filepath.Join(suite.T().TempDir(), "cache"),
+	}
+
+	first, err := ssc.Certificate("localhost")
+	suite.Require().NoError(err)
+	suite.FileExists(filepath.Join(ssc.CacheDir, SelfSignedCertificateFile))
+	suite.FileExists(filepath.Join(ssc.CacheDir, SelfSignedKeyFile))
+
+	second, err := ssc.Certificate("localhost")
+	suite.Require().NoError(err)
+	suite.Equal(Fingerprint(first.Leaf), Fingerprint(second.Leaf))
+
+	// a new host requires a new certificate
+	ssc.Hosts = []string{"other.example.com"}
+	third, err := ssc.Certificate("localhost")
+	suite.Require().NoError(err)
+	suite.NotEqual(Fingerprint(first.Leaf), Fingerprint(third.Leaf))
+	suite.NoError(third.Leaf.VerifyHostname("other.example.com"))
+
+	// a corrupt cache is replaced
+	suite.Require().NoError(os.WriteFile(filepath.Join(ssc.CacheDir, SelfSignedCertificateFile), []byte("garbage"), 0600))
+	fourth, err := ssc.Certificate("localhost")
+	suite.Require().NoError(err)
+	suite.NotEqual(Fingerprint(third.Leaf), Fingerprint(fourth.Leaf))
+}
+
+func (suite *SelfSignedSuite) TestCacheError() {
+	file := filepath.Join(suite.T().TempDir(), "file")
+	suite.Require().NoError(os.WriteFile(file, nil, 0600))
+
+	_, err := SelfSignedConfig{CacheDir: file}.Certificate("")
+	suite.Error(err)
+
+	tc, err := (&Config{SelfSigned: &SelfSignedConfig{CacheDir: file}}).New()
+	suite.Error(err)
+	suite.Nil(tc)
+}
+
+func (suite *SelfSignedSuite) TestFingerprint() {
+	fp := Fingerprint(&x509.Certificate{Raw: []byte("test")})
+	suite.Equal("9F:86:D0:81:88:4C:7D:65:9A:2F:EA:A0:C5:5A:D0:15:A3:BF:4F:1B:2B:0B:82:2C:D1:5D:6C:15:B0:F0:0A:08", fp)
+}
+
+func (suite *SelfSignedSuite) TestConfig() {
+	tc, err := (&Config{
+		ServerName: "dev.example.com",
+		SelfSigned: &SelfSignedConfig{},
+	}).New()
+
+	suite.Require().NoError(err)
+	suite.Require().Len(tc.Certificates, 1)
+	suite.Equal([]string{"dev.example.com"}, tc.Certificates[0].Leaf.DNSNames)
+}
+
+func (suite *SelfSignedSuite) TestConfigNotice() {
+	var notices []error
+	tc, cs, err := (&Config{
+		ServerName: "dev.example.com",
+		SelfSigned: &SelfSignedConfig{
+			Hosts: []string{"127.0.0.1"},
+		},
+	}).NewWithStore(func(err error) { notices = append(notices, err) })
+
+	suite.Require().NoError(err)
+	suite.Nil(cs)
+	suite.Require().Len(tc.Certificates, 1)
+	suite.Require().Len(notices, 1)
+
+	var ssn *SelfSignedNotice
+	suite.Require().ErrorAs(notices[0], &ssn)
+	suite.Equal([]string{"dev.example.com", "127.0.0.1"}, ssn.Hosts)
+	suite.Equal(Fingerprint(tc.Certificates[0].Leaf), ssn.Fingerprint)
+	suite.Contains(ssn.Error(), ssn.Fingerprint)
+}
+
+func (suite *SelfSignedSuite) TestConfigWithCertificates() {
+	tc, err := (&Config{
+		Certificates: ExternalCertificates{
+			{
+				CertificateFile: CertificateFile,
+				KeyFile:         KeyFile,
+			},
+		},
+		SelfSigned: &SelfSignedConfig{},
+	}).New()
+
+	suite.Require().NoError(err)
+	suite.Require().Len(tc.Certificates, 1)
+	leaf, err := x509.ParseCertificate(tc.Certificates[0].Certificate[0])
+	suite.Require().NoError(err)
+	suite.Equal("test", leaf.Subject.CommonName)
+}
+
+func TestSelfSigned(t *testing.T) {
+	suite.Run(t, new(SelfSignedSuite))
+}
@@ -0,0 +1,183 @@
+package arrangetls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidHost indicates that an ExternalCertificate host is not a valid hostname
+	// or wildcard.  A wildcard must be of the form "*.example.com".
+	ErrInvalidHost = errors.New("A host must be either a hostname or a wildcard of the form *.example.com")
+
+	// ErrInvalidDefaultCertificate indicates that SNIConfig.Default is not the index of
+	// a configured certificate.
+	ErrInvalidDefaultCertificate = errors.New("The default certificate must be the index of a configured certificate")
+)
+
+// ServerNameError indicates that no certificate matched the server name sent by a client.
+// This error is only returned when SNIConfig.Strict is set.
+type ServerNameError struct {
+	// ServerName is the server name the client sent.
+	ServerName string
+}
+
+// Error satisfies the error interface.
+func (sne *ServerNameError) Error() string {
+	return "No certificate matches server name " + strconv.Quote(sne.ServerName)
+}
+
+// SNIConfig controls how a server chooses among its certificates using the server
+// name indication (SNI) sent by a client.  Each certificate matches either its configured
+// ExternalCertificate.Hosts or, if none are configured, the DNS names in the certificate.
+// Exact matches take precedence over wildcard matches.  When several certificates match
+// equally, the first one the client supports is used.
+type SNIConfig struct {
+	// Default is the index of the certificate used when a client sends no server name, or when
+	// the server name matches no certificate and Strict is not set.  If unset, the first
+	// certificate is the default.
+	Default int
+
+	// Strict causes the handshake to fail when a client sends a server name that matches no
+	// certificate.  The Default certificate is still used for clients that send no server name.
+	Strict bool
+}
+
+// sniSelector implements tls.Config.GetCertificate using SNI.
+type sniSelector struct {
+	// hosts are the normalized, configured hosts for each certificate.  A nil entry
+	// means that the certificate's own DNS names are used.
+	hosts        [][]string
+	certificates func() []tls.Certificate
+	defaultIndex int
+	strict       bool
+}
+
+// normalizeHost lowercases a host and removes any trailing dot.  An invalid host results in an error.
+func normalizeHost(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	wildcard := strings.HasPrefix(host, "*.")
+	if len(host) == 0 || strings.Contains(strings.TrimPrefix(host, "*."), "*") || (wildcard && len(host) < 3) {
+		return "", ErrInvalidHost
+	}
+
+	return host, nil
+}
+
+// newSNISelector creates the GetCertificate strategy for a set of external certificates.  The
+// certificates function returns the currently loaded certificates, in the same order as ecs.
+func newSNISelector(ecs ExternalCertificates, certificates func() []tls.Certificate, sni *SNIConfig) (*sniSelector, error) {
+	s := &sniSelector{
+		hosts:        make([][]string, ecs.Len()),
+		certificates: certificates,
+	}
+
+	if sni != nil {
+		s.defaultIndex = sni.Default
+		s.strict = sni.Strict
+	}
+
+	if s.defaultIndex < 0 || s.defaultIndex >= ecs.Len() {
+		return nil, ErrInvalidDefaultCertificate
+	}
+
+	for i, ec := range ecs {
+		for _, host := range ec.Hosts {
+			normalized, err := normalizeHost(host)
+			if err != nil {
+				return nil, &EntryError{
+					Index:  i,
+					Source: host,
+					Err:    err,
+				}
+			}
+
+			s.hosts[i] = append(s.hosts[i], normalized)
+		}
+	}
+
+	return s, nil
+}
+
+// certificateHosts returns the hosts that a certificate matches.
+func (s *sniSelector) certificateHosts(i int, cert *tls.Certificate) []string {
+	if s.hosts[i] != nil {
+		return s.hosts[i]
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil && len(cert.Certificate) > 0 {
+		leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	if leaf == nil {
+		return nil
+	}
+
+	return leaf.DNSNames
+}
+
+// matchWildcard tests if a name matches a wildcard host, which matches exactly one label.
+func matchWildcard(host, name string) bool {
+	if !strings.HasPrefix(host, "*.") {
+		return false
+	}
+
+	i := strings.IndexByte(name, '.')
+	return i > 0 && strings.EqualFold(host[1:], name[i:])
+}
+
+// match returns the best certificate whose hosts satisfy the given predicate, or nil if none do.
+func (s *sniSelector) match(hello *tls.ClientHelloInfo, certs []tls.Certificate, matches func(host string) bool) *tls.Certificate {
+	var first *tls.Certificate
+	for i := range certs {
+		for _, host := range s.certificateHosts(i, &certs[i]) {
+			if !matches(host) {
+				continue
+			}
+
+			if hello.SupportsCertificate(&certs[i]) == nil {
+				return &certs[i]
+			} else if first == nil {
+				first = &certs[i]
+			}
+
+			break
+		}
+	}
+
+	return first
+}
+
+// GetCertificate may be used as the tls.Config.GetCertificate callback.
+func (s *sniSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := s.certificates()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if len(name) == 0 {
+		return &certs[s.defaultIndex], nil
+	}
+
+	cert := s.match(hello, certs, func(host string) bool {
+		return strings.EqualFold(host, name)
+	})
+
+	if cert == nil {
+		cert = s.match(hello, certs, func(host string) bool {
+			return matchWildcard(host, name)
+		})
+	}
+
+	switch {
+	case cert != nil:
+		return cert, nil
+
+	case s.strict:
+		return nil, &ServerNameError{ServerName: hello.ServerName}
+
+	default:
+		return &certs[s.defaultIndex], nil
+	}
+}
@@ -0,0 +1,225 @@
+package arrangetls_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xmidt-org/arrange/arrangetls"
+	"github.com/xmidt-org/arrange/arrangetls/arrangetlstest"
+)
+
+type SNISuite struct {
+	suite.Suite
+
+	pki *arrangetlstest.PKI
+
+	api      *arrangetlstest.Certificate
+	wildcard *arrangetlstest.Certificate
+	fallback *arrangetlstest.Certificate
+}
+
+func (suite *SNISuite) SetupTest() {
+	suite.pki = arrangetlstest.NewPKI(suite.T())
+	suite.api = suite.pki.Root().NewServer("api.example.com")
+	suite.wildcard = suite.pki.Root().NewServer("wildcard", arrangetlstest.WithDNSNames("*.example.com"))
+	suite.fallback = suite.pki.Root().NewServer("fallback.example.net")
+}
+
+func (suite *SNISuite) newConfig(sni *arrangetls.SNIConfig, certs ...arrangetls.ExternalCertificate) *tls.Config {
+	tc, err := (&arrangetls.Config{
+		Certificates: certs,
+		SNI:          sni,
+	}).New()
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(tc.GetCertificate)
+	return tc
+}
+
+// commonName returns the subject common name of the certificate chosen for a server name.
+func (suite *SNISuite) commonName(tc *tls.Config, serverName string) string {
+	cert, err := tc.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:        serverName,
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256, tls.Ed25519},
+	})
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(cert.Leaf)
+	return cert.Leaf.Subject.CommonName
+}
+
+func (suite *SNISuite) TestCertificateNames() {
+	tc := suite.newConfig(
+		nil,
+		suite.fallback.ExternalCertificate(),
+		suite.wildcard.ExternalCertificate(),
+		suite.api.ExternalCertificate(),
+	)
+
+	suite.Equal("api.example.com", suite.commonName(tc, "api.example.com"))
+	suite.Equal("api.example.com", suite.commonName(tc, "API.Example.COM."))
+	suite.Equal("wildcard", suite.commonName(tc, "www.example.com"))
+	suite.Equal("fallback.example.net", suite.commonName(tc, "fallback.example.net"))
+	suite.Equal("fallback.example.net", suite.commonName(tc, "a.b.example.com"))
+	suite.Equal("fallback.example.net", suite.commonName(tc, "unknown.org"))
+	suite.Equal("fallback.example.net", suite.commonName(tc, ""))
+}
+
+func (suite *SNISuite) TestHosts() {
+	api := suite.api.ExternalCertificate()
+	api.Hosts = []string{"*.api.example.com", "API.example.org."}
+
+	tc := suite.newConfig(
+		&arrangetls.SNIConfig{Default: 1},
+		api,
+		suite.fallback.ExternalCertificate(),
+	)
+
+	suite.Equal("api.example.com", suite.commonName(tc, "v1.api.example.com"))
+	suite.Equal("api.example.com", suite.commonName(tc, "api.example.org"))
+
+	// configured hosts replace the certificate's own names
+	suite.Equal("fallback.example.net", suite.commonName(tc, "api.example.com"))
+	suite.Equal("fallback.example.net", suite.commonName(tc, ""))
+
+	// crypto/tls uses the first static certificate when a client sends no server name
+	suite.Require().Len(tc.Certificates, 2)
+	suite.Equal("fallback.example.net", tc.Certificates[0].Leaf.Subject.CommonName)
+}
+
+func (suite *SNISuite) TestClientSupport() {
+	rsa := suite.pki.Root().NewServer("rsa", arrangetlstest.WithDNSNames("dual.example.com"), arrangetlstest.WithKeyType(arrangetlstest.KeyTypeRSA))
+	ecdsa := suite.pki.Root().NewServer("ecdsa", arrangetlstest.WithDNSNames("dual.example.com"))
+	tc := suite.newConfig(nil, rsa.ExternalCertificate(), ecdsa.ExternalCertificate())
+
+	cert, err := tc.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:        "dual.example.com",
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+	})
+
+	suite.Require().NoError(err)
+	suite.Equal("ecdsa", cert.Leaf.Subject.CommonName)
+
+	// when the client supports none, the first match is used
+	cert, err = tc.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:        "dual.example.com",
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.Ed25519},
+	})
+
+	suite.Require().NoError(err)
+	suite.Equal("rsa", cert.Leaf.Subject.CommonName)
+}
+
+func (suite *SNISuite) TestStrict() {
+	tc := suite.newConfig(
+		&arrangetls.SNIConfig{Strict: true},
+		suite.fallback.ExternalCertificate(),
+		suite.api.ExternalCertificate(),
+	)
+
+	suite.Equal("api.example.com", suite.commonName(tc, "api.example.com"))
+	suite.Equal("fallback.example.net", suite.commonName(tc, ""))
+
+	cert, err := tc.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.org"})
+	suite.Nil(cert)
+
+	var sne *arrangetls.ServerNameError
+	suite.Require().ErrorAs(err, &sne)
+	suite.Equal("unknown.org", sne.ServerName)
+	suite.Contains(sne.Error(), "unknown.org")
+}
+
+func (suite *SNISuite) TestReload() {
+	tc, cs, err := (&arrangetls.Config{
+		Certificates: arrangetls.ExternalCertificates{
+			suite.fallback.ExternalCertificate(),
+			suite.api.ExternalCertificate(),
+		},
+		Reload: &arrangetls.ReloadConfig{Interval: time.Hour},
+	}).NewWithStore(nil)
+
+	suite.Require().NoError(err)
+	suite.Require().NotNil(cs)
+	suite.Empty(tc.Certificates)
+	suite.Equal("api.example.com", suite.commonName(tc, "api.example.com"))
+	suite.Equal("fallback.example.net", suite.commonName(tc, "unknown.org"))
+}
+
+func (suite *SNISuite) TestInvalidDefault() {
+	for _, index := range []int{-1, 1} {
+		_, err := (&arrangetls.Config{
+			Certificates: arrangetls.ExternalCertificates{suite.api.ExternalCertificate()},
+			SNI:          &arrangetls.SNIConfig{Default: index},
+		}).New()
+
+		suite.ErrorIs(err, arrangetls.ErrInvalidDefaultCertificate)
+	}
+}
+
+func (suite *SNISuite) TestInvalidHost() {
+	for _, host := range []string{"", "*", "*.", "www.*.example.com", "*.*.example.com"} {
+		api := suite.api.ExternalCertificate()
+		api.Hosts = []string{host}
+
+		_, err := (&arrangetls.Config{
+			Certificates: arrangetls.ExternalCertificates{suite.fallback.ExternalCertificate(), api},
+		}).New()
+
+		var ee *arrangetls.EntryError
+		suite.Require().ErrorAs(err, &ee, host)
+		suite.Equal("Certificates", ee.Field)
+		suite.Equal(1, ee.Index)
+		suite.ErrorIs(err, arrangetls.ErrInvalidHost)
+	}
+}
+
+func (suite *SNISuite) TestHandshake() {
+	serverConfig := suite.newConfig(
+		&arrangetls.SNIConfig{Strict: true},
+		suite.fallback.ExternalCertificate(),
+		suite.wildcard.ExternalCertificate(),
+	)
+
+	handshake := func(serverName string) (string, error) {
+		clientConn, serverConn := net.Pipe()
+		server := tls.Server(serverConn, serverConfig)
+		client := tls.Client(clientConn, &tls.Config{
+			RootCAs:    suite.pki.Pool(),
+			ServerName: serverName,
+			MinVersion: tls.VersionTLS13,
+		})
+
+		defer client.Close()
+		defer server.Close()
+
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- server.Handshake()
+		}()
+
+		err := client.Handshake()
+		<-serverErr
+		if err != nil {
+			return "", err
+		}
+
+		return client.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	commonName, err := handshake("www.example.com")
+	suite.NoError(err)
+	suite.Equal("wildcard", commonName)
+
+	_, err = handshake("unknown.org")
+	suite.Error(err)
+}
+
+func TestSNI(t *testing.T) {
+	suite.Run(t, new(SNISuite))
+}
@@ -0,0 +1,38 @@
+#!/bin/sh
+# Regenerates the PKCS#8 and PKCS#12 test fixtures.  Requires OpenSSL 3.
+# The password for every encrypted fixture is "secret".
+set -e
+cd "$(dirname "$0")"
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+openssl ecparam -name prime256v1 -genkey -noout -out "$work/root.key"
+openssl req -x509 -new -key "$work/root.key" -subj "/CN=Test Root" -days 36500 -out "$work/root.pem"
+
+openssl ecparam -name prime256v1 -genkey -noout -out "$work/intermediate.key"
+openssl req -new -key "$work/intermediate.key" -subj "/CN=Test Intermediate" -out "$work/intermediate.csr"
+printf "basicConstraints=critical,CA:TRUE\nkeyUsage=critical,keyCertSign,cRLSign\n" > "$work/ca.ext"
+openssl x509 -req -in "$work/intermediate.csr" -CA "$work/root.pem" -CAkey "$work/root.key" \
+	-CAcreateserial -days 36500 -extfile "$work/ca.ext" -out "$work/intermediate.pem"
+
+openssl ecparam -name prime256v1 -genkey -noout -out "$work/leaf.key"
+openssl req -new -key "$work/leaf.key" -subj "/CN=test.net" -out "$work/leaf.csr"
+printf "subjectAltName=DNS:test.net\n" > "$work/leaf.ext"
+openssl x509 -req -in "$work/leaf.csr" -CA "$work/intermediate.pem" -CAkey "$work/intermediate.key" \
+	-CAcreateserial -days 36500 -extfile "$work/leaf.ext" -out leaf.pem
+
+cat "$work/intermediate.pem" "$work/root.pem" > "$work/chain.pem"
+printf "secret\n" > password.txt
+
+openssl pkcs8 -topk8 -in "$work/leaf.key" -v2 aes-256-cbc -v2prf hmacWithSHA256 -passout pass:secret -out key-pbes2-aes.pem
+openssl pkcs8 -topk8 -in "$work/leaf.key" -v2 des3 -passout pass:secret -out key-pbes2-des3.pem
+openssl pkcs8 -topk8 -in "$work/leaf.key" -v1 PBE-SHA1-3DES -passout pass:secret -out key-pbe-3des.pem
+
+openssl pkcs12 -export -inkey "$work/leaf.key" -in leaf.pem -certfile "$work/chain.pem" \
+	-passout pass:secret -out bundle.p12
+openssl pkcs12 -export -inkey "$work/leaf.key" -in leaf.pem -certfile "$work/chain.pem" \
+	-keypbe PBE-SHA1-3DES -certpbe PBE-SHA1-3DES -macalg sha1 -passout pass:secret -out bundle-3des.p12
+openssl pkcs12 -export -inkey "$work/leaf.key" -in leaf.pem -certfile "$work/chain.pem" \
+	-nomac -passout pass:secret -out bundle-nomac.p12
+openssl pkcs12 -export -inkey "$work/leaf.key" -in leaf.pem -certfile "$work/chain.pem" \
+	-legacy -passout pass:secret -out bundle-rc2.p12
@@ -3,9 +3,11 @@ package arrangetls
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"math/big"
 	"os"
-	"strings"
+	"time"
 )
 
 var (
@@ -23,6 +25,10 @@ var (
 type PeerVerifyError struct {
 	Certificate *x509.Certificate
 	Reason      string
+
+	// SerialNumber is the serial number of a revoked certificate.  This field is
+	// nil unless the certificate failed verification because it was revoked.
+	SerialNumber *big.Int
 }
 
 // Error satisfies the error interface.  It returns the Reason text.
@@ -69,10 +75,40 @@ func (pvs PeerVerifiers) Extend(more PeerVerifiers) PeerVerifiers {
 	return pvs.Append(more.v...)
 }
 
+// verify runs each PeerVerifier in sequence against a single certificate.  Any error
+// short-circuits subsequent checks.
+func (pvs PeerVerifiers) verify(peerCert *x509.Certificate, verifiedChains [][]*x509.Certificate) error {
+	for _, pv := range pvs.v {
+		if err := pv(peerCert, verifiedChains); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // VerifyPeerCertificate may be used as the closure for crypto/tls.Config.VerifyPeerCertificate.
-// Parsing is done once, then each PeerVerifier is invoked in sequence.  Any error short-circuits
-// subsequent checks.
+// Only the peer's leaf certificate, which is the first certificate it sends, is verified.  Each
+// PeerVerifier also receives the verified chains, so that chain-level checks such as VerifyIssuer
+// can examine the intermediates.  Any error short-circuits subsequent checks.
 func (pvs PeerVerifiers) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(pvs.v) == 0 || len(rawCerts) == 0 {
+		return nil
+	}
+
+	peerCert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+
+	return pvs.verify(peerCert, verifiedChains)
+}
+
+// VerifyAllPeerCertificates is like VerifyPeerCertificate, except that every certificate the
+// peer sends, intermediates included, is run through each PeerVerifier.  Parsing is done once
+// for each certificate.  Chain-level verifiers such as VerifyMaxChainLength will reject the
+// intermediates, since no verified chain begins with them.
+func (pvs PeerVerifiers) VerifyAllPeerCertificates(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 	if len(pvs.v) == 0 {
 		return nil
 	}
@@ -83,10 +119,8 @@ func (pvs PeerVerifiers) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains
 			return err
 		}
 
-		for _, pv := range pvs.v {
-			if err := pv(peerCert, verifiedChains); err != nil {
-				return err
-			}
+		if err := pvs.verify(peerCert, verifiedChains); err != nil {
+			return err
 		}
 	}
 
@@ -106,7 +140,8 @@ func (pvs PeerVerifiers) SetTo(tc *tls.Config) {
 }
 
 // PeerVerifyConfig allows common checks against a client-side certificate to be configured externally.
-// Any constraint that matches will result in a valid peer cert.
+// By default, any identity check that matches will result in a valid peer cert.  Set Match to "all"
+// to require that every configured identity check matches.
 type PeerVerifyConfig struct {
 	// DNSSuffixes enumerates any DNS suffixes that are checked.  A DNSName field of at least (1) peer cert
 	// must have one of these suffixes.  If this field is not supplied, no DNS suffix checking is performed.
@@ -122,56 +157,121 @@ type PeerVerifyConfig struct {
 	// If any common name matches, that is sufficient for the peer cert to be valid.  No further
 	// checking is done in that case.
 	CommonNames []string
+
+	// URIPrefixes lists prefixes checked against the URI SANs of a peer cert, e.g. "spiffe://example.org/ns/prod".
+	// A prefix only matches whole path segments, so "spiffe://example.org/ns/a" does not match
+	// "spiffe://example.org/ns/admin".
+	URIPrefixes []string
+
+	// URIPatterns lists glob patterns checked against the URI SANs of a peer cert.  The syntax is
+	// the same as path.Match, so "spiffe://example.org/ns/*/sa/web" matches any namespace.
+	URIPatterns []string
+
+	// SPIFFETrustDomain is the SPIFFE trust domain, e.g. "example.org", that a peer cert's
+	// SPIFFE ID must belong to.
+	SPIFFETrustDomain string
+
+	// IPRanges lists CIDR ranges, or single IP addresses, checked against the IP SANs of a peer cert.
+	IPRanges []string
+
+	// Organizations lists the subject organizations, any of which a peer cert must have.
+	// Matching is case sensitive.
+	Organizations []string
+
+	// OrganizationalUnits lists the subject organizational units, any of which a peer cert must have.
+	// Matching is case sensitive.
+	OrganizationalUnits []string
+
+	// Match determines how the identity checks are combined.  It may be either "any", the default,
+	// or "all".  See ParseMatchMode.
+	Match string
+
+	// CRLFiles lists local certificate revocation list files, each either DER or a sequence of
+	// PEM blocks.  If supplied, a peer cert is rejected if it or any certificate above it in a
+	// verified chain has been revoked.  Unlike the identity checks, this check always applies.
+	CRLFiles []string
+
+	// CRLReloadInterval is how often the CRLFiles are checked for changes.  If unset,
+	// DefaultReloadInterval is used.
+	CRLReloadInterval time.Duration
+
+	// IssuerCommonNames lists the subject common names, one of which the CA that issued a peer
+	// cert must have.  Like CRLFiles, this check always applies, so a peer cert without a verified
+	// chain is rejected.  See VerifyIssuer.
+	IssuerCommonNames []string
+
+	// MaxChainLength is the maximum number of certificates, including the peer cert and the root,
+	// that a verified chain may have.  If unset, chains of any length are allowed.  Like CRLFiles,
+	// this check always applies.  See VerifyMaxChainLength.
+	MaxChainLength int
+
+	// AllCertificates, if true, runs these checks against every certificate the peer sends rather
+	// than just the leaf.  This was the behavior of earlier versions.  Enabling it causes a DNS suffix
+	// or common name check to fail when the peer presents an intermediate that does not match.
+	AllCertificates bool
 }
 
 // Verifier produces a PeerVerifier strategy from these options.
 // If nothing is configured, this method returns nil.
+//
+// If this configuration is invalid or the CRLFiles cannot be loaded, the returned PeerVerifier
+// rejects every certificate with that error.  Use NewVerifier to handle the error directly.
 func (pvc PeerVerifyConfig) Verifier() PeerVerifier {
-	if len(pvc.DNSSuffixes) > 0 || len(pvc.CommonNames) > 0 {
-		// make a safe clone to host our closure
-		var clone PeerVerifyConfig
-		if len(pvc.DNSSuffixes) > 0 {
-			clone.DNSSuffixes = make([]string, len(pvc.DNSSuffixes))
-			for i, suffix := range pvc.DNSSuffixes {
-				clone.DNSSuffixes[i] = strings.ToLower(suffix)
-			}
-		}
-
-		if len(pvc.CommonNames) > 0 {
-			clone.CommonNames = append(clone.CommonNames, pvc.CommonNames...)
+	v, err := pvc.NewVerifier()
+	if err != nil {
+		return func(*x509.Certificate, [][]*x509.Certificate) error {
+			return err
 		}
-
-		return clone.verify
 	}
 
-	return nil
+	return v
 }
 
-// verify is the PeerVerifier strategy that uses this configuration.
-// This is typically invoked against a clone of the unmarshaled struct.
-func (pvc PeerVerifyConfig) verify(peerCert *x509.Certificate, _ [][]*x509.Certificate) error {
-	for _, suffix := range pvc.DNSSuffixes {
-		for _, dnsName := range peerCert.DNSNames {
-			if strings.HasSuffix(strings.ToLower(dnsName), suffix) {
-				return nil
-			}
-		}
+// NewVerifier is like Verifier, except that any configuration error or error loading the
+// CRLFiles is returned.
+// Errors that occur while reloading the CRLFiles are written to the standard logger.
+func (pvc PeerVerifyConfig) NewVerifier() (PeerVerifier, error) {
+	return pvc.newVerifier(nil)
+}
 
-		// Allow the common name to be suffixed by a DNS suffix
-		if strings.HasSuffix(strings.ToLower(peerCert.Subject.CommonName), suffix) {
-			return nil
-		}
+// newVerifier creates the PeerVerifier, sending CRL reload errors to onError.
+func (pvc PeerVerifyConfig) newVerifier(onError func(error)) (PeerVerifier, error) {
+	names, err := pvc.identityVerifier()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, commonName := range pvc.CommonNames {
-		if commonName == peerCert.Subject.CommonName {
-			return nil
+	var pvs PeerVerifiers
+	if len(pvc.CRLFiles) > 0 {
+		crls, err := NewCRLStore(pvc.CRLFiles, pvc.CRLReloadInterval, onError)
+		if err != nil {
+			return nil, err
 		}
+
+		pvs = pvs.Append(crls.Verify)
+	}
+
+	if len(pvc.IssuerCommonNames) > 0 {
+		pvs = pvs.Append(VerifyIssuer(pvc.IssuerCommonNames...))
 	}
 
-	return &PeerVerifyError{
-		Certificate: peerCert,
-		Reason:      "No DNS name or common name matched",
+	if pvc.MaxChainLength > 0 {
+		pvs = pvs.Append(VerifyMaxChainLength(pvc.MaxChainLength))
+	}
+
+	if names != nil {
+		pvs = pvs.Append(names)
+	}
+
+	switch len(pvs.v) {
+	case 0:
+		return nil, nil
+
+	case 1:
+		return pvs.v[0], nil
+
+	default:
+		return pvs.verify, nil
 	}
 }
 
@@ -188,20 +288,128 @@ func (pvc *PeerVerifyConfig) AppendTo(pvs PeerVerifiers) PeerVerifiers {
 	return pvs
 }
 
-// ExternalCertificate represents a certificate with its key file on the filesystem.
+// ExternalCertificate represents a certificate with its key.  Each of the certificate and key
+// can be either a file on the filesystem or inline material.  Inline material can be either PEM
+// or a base64 string containing PEM, and takes precedence over the corresponding file.
 // A server or client may have one or more associated external certificates.
+//
+// Alternatively, the certificate, key, and any intermediate certificates can be loaded
+// from a PKCS#12 bundle, including legacy RC2 and 3DES bundles.  The key may also be an
+// encrypted PKCS#8 PEM block, using either PBES2 or the legacy pbeWithSHAAnd3-KeyTripleDES-CBC
+// scheme.  In either case, Password supplies the password.
 type ExternalCertificate struct {
 	CertificateFile string
 	KeyFile         string
+
+	// CertificatePEM is the optional inline certificate, which can be a bundle.
+	CertificatePEM string
+
+	// KeyPEM is the optional inline private key.
+	KeyPEM string
+
+	// BundleFile is an optional PKCS#12 file, typically with a .p12 or .pfx extension.
+	// If set, the other certificate and key fields are ignored.
+	BundleFile string
+
+	// Password is the source of the password for the BundleFile or for an encrypted key.
+	// A BundleFile without a MAC can only be loaded without a password.
+	Password PasswordSource
+
+	// Hosts are the hostnames or wildcards, e.g. "*.example.com", that a server uses this
+	// certificate for, chosen by the server name a client sends.  If unset, the DNS names
+	// in the certificate itself are used.  See SNIConfig.
+	Hosts []string
 }
 
-// Load reads in the certificate and key files from the file system
+// Load reads in the certificate and key, either inline or from the file system
 func (ec ExternalCertificate) Load() (tls.Certificate, error) {
-	if len(ec.CertificateFile) > 0 && len(ec.KeyFile) > 0 {
-		return tls.LoadX509KeyPair(ec.CertificateFile, ec.KeyFile)
+	if len(ec.BundleFile) > 0 {
+		return ec.loadBundle()
+	}
+
+	certPEM, err := loadMaterial(ec.CertificatePEM, ec.CertificateFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	keyPEM, err := loadMaterial(ec.KeyPEM, ec.KeyFile)
+	if err == nil {
+		keyPEM, err = ec.decryptKey(keyPEM)
+	}
+
+	if err != nil {
+		return tls.Certificate{}, err
 	}
 
-	return tls.Certificate{}, ErrTLSCertificateRequired
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// loadBundle reads the PKCS#12 BundleFile.
+func (ec ExternalCertificate) loadBundle() (tls.Certificate, error) {
+	password, err := ec.Password.Load()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	data, err := os.ReadFile(ec.BundleFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return decodePKCS12(data, password)
+}
+
+// decryptKey decrypts the key if it is an encrypted PKCS#8 PEM block.  Any other
+// key is returned as is.
+func (ec ExternalCertificate) decryptKey(keyPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		return keyPEM, nil
+	}
+
+	password, err := ec.Password.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := decryptPKCS8(block.Bytes, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}), nil
+}
+
+// files returns the names of the files that Load reads.
+func (ec ExternalCertificate) files() []string {
+	var files []string
+	if len(ec.BundleFile) > 0 {
+		files = append(files, ec.BundleFile)
+	} else {
+		files = append(files,
+			materialFile(ec.CertificatePEM, ec.CertificateFile),
+			materialFile(ec.KeyPEM, ec.KeyFile),
+		)
+	}
+
+	if len(ec.Password.Value) == 0 && len(ec.Password.Env) == 0 {
+		files = append(files, ec.Password.File)
+	}
+
+	return files
+}
+
+// source describes where this certificate comes from, for error messages.
+func (ec ExternalCertificate) source() string {
+	if len(ec.BundleFile) > 0 {
+		return ec.BundleFile
+	}
+
+	return materialSource(ec.CertificatePEM, ec.CertificateFile) + ", " +
+		materialSource(ec.KeyPEM, ec.KeyFile)
 }
 
 // ExternalCertificates is a sequence of externally available certificates
@@ -219,12 +427,22 @@ func (ecs *ExternalCertificates) Append(more ...ExternalCertificate) {
 
 // AppendTo loads and appends each certificate in this slice.  Any error short
 // circuits and returns that error together with the slice with any successfully
-// loaded certificates.
+// loaded certificates.  The returned error will be an *EntryError that identifies
+// the certificate that failed.
 func (ecs ExternalCertificates) AppendTo(certs []tls.Certificate) ([]tls.Certificate, error) {
-	for _, ec := range ecs {
+	for i, ec := range ecs {
 		cert, err := ec.Load()
 		if err != nil {
-			return certs, err
+			return certs, &EntryError{
+				Index:  i,
+				Source: ec.source(),
+				Err:    err,
+			}
+		}
+
+		if cert.Leaf == nil {
+			// X509KeyPair has already parsed the leaf successfully
+			cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
 		}
 
 		certs = append(certs, cert)
@@ -233,8 +451,10 @@ func (ecs ExternalCertificates) AppendTo(certs []tls.Certificate) ([]tls.Certifi
 	return certs, nil
 }
 
-// ExternalCertPool is a sequence of file names containing PEM-encoded certificates
-// or certificate bundles to be added to an x509.CertPool
+// ExternalCertPool is a sequence of PEM-encoded certificates or certificate bundles to be added
+// to an x509.CertPool.  Each entry can be a file name, an inline PEM block, or a base64 string
+// containing either PEM or DER.  An entry that is not PEM and that does not name an existing
+// file is decoded as base64.
 type ExternalCertPool []string
 
 // Len returns the number of external files in this pool
@@ -247,22 +467,27 @@ func (ecp *ExternalCertPool) Append(more ...string) {
 	*ecp = append(*ecp, more...)
 }
 
-// AppendTo adds each PEM-encoded file from this external pool to the given
-// x509.CertPool.  The number of certs added is returned, and any error will
-// short circuit subsequent loading.
+// AppendTo adds each entry from this external pool to the given x509.CertPool.
+// The number of entries added is returned, and any error will short circuit
+// subsequent loading.  The returned error will be an *EntryError that identifies
+// the entry that failed.
 func (ecp ExternalCertPool) AppendTo(pool *x509.CertPool) (int, error) {
 	var loaded int
-	for _, ec := range ecp {
-		pemCert, err := os.ReadFile(ec)
-		if err != nil {
-			return loaded, err
+	for i, entry := range ecp {
+		data, source, err := loadPoolEntry(entry)
+		if err == nil {
+			err = appendCerts(pool, data)
 		}
 
-		if pool.AppendCertsFromPEM(pemCert) {
-			loaded++
-		} else {
-			return loaded, ErrUnableToAddClientCACertificate
+		if err != nil {
+			return loaded, &EntryError{
+				Index:  i,
+				Source: source,
+				Err:    err,
+			}
 		}
+
+		loaded++
 	}
 
 	return loaded, nil
@@ -292,16 +517,46 @@ type Config struct {
 	// NextProtos is the list of supported application protocols.  Defaults to "http/1.1" if unset.
 	NextProtos []string
 
-	// MinVersion is the minimum required TLS version.  If unset, the internal crypto/tls default is used.
-	MinVersion uint16
+	// MinVersion is the minimum required TLS version, e.g. "1.2".  If unset, TLS 1.3 is used.
+	MinVersion TLSVersion
+
+	// MaxVersion is the maximum required TLS version, e.g. "1.3".  If unset, the internal crypto/tls default is used.
+	MaxVersion TLSVersion
+
+	// CipherSuites is the optional list of cipher suite names, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	// used for TLS versions less than 1.3.  If unset, only strong AES-256-GCM suites are used.
+	// See ParseCipherSuite.
+	CipherSuites []string
 
-	// MaxVersion is the maximum required TLS version.  If unset, the internal crypto/tls default is used.
-	MaxVersion uint16
+	// CurvePreferences is the optional list of elliptic curve names, in preference order.
+	// If unset, the internal crypto/tls default is used.  See ParseCurve.
+	CurvePreferences []string
+
+	// ClientAuth is the optional client authentication policy, e.g. "verify-if-given".  If unset,
+	// the policy is "require-and-verify" when ClientCAs are configured and "none" otherwise.
+	// See ParseClientAuth.
+	ClientAuth string
 
 	// PeerVerify specifies the certificate validation done on client certificates.
 	// If supplied, this verifier strategy is merged with any extra PeerVerifiers
 	// supplied in application code.
 	PeerVerify *PeerVerifyConfig
+
+	// Reload enables the reloading of Certificates when their files change.  If set,
+	// the tls.Config uses GetCertificate and GetClientCertificate callbacks backed by
+	// a CertificateStore instead of a static list of certificates.  The store only watches
+	// the files once started, e.g. by BindCertificateStore.
+	Reload *ReloadConfig
+
+	// SelfSigned enables a generated, self-signed certificate when no Certificates are configured.
+	// The certificate is valid for ServerName and any additional SelfSigned.Hosts.  This is intended
+	// only for development.  Its fingerprint is reported with a SelfSignedNotice.  See NewWithStore.
+	SelfSigned *SelfSignedConfig
+
+	// SNI controls how a server chooses among multiple Certificates using the server name a
+	// client sends.  If unset, the first certificate is the default and a server name that
+	// matches no certificate falls back to it.
+	SNI *SNIConfig
 }
 
 // nextProtos returns the appropriate next protocols for the TLS handshake.  By default, http/1.1 is used.
@@ -316,7 +571,14 @@ func (c *Config) nextProtos() []string {
 }
 
 // enforceVersions ensures certain constraints on the TLS version are met.
-func (c *Config) enforceVersions(tc *tls.Config) {
+// Versions that are not supported by this package are rejected.
+func (c *Config) enforceVersions(tc *tls.Config) error {
+	if err := c.MinVersion.Validate(); err != nil {
+		return err
+	} else if err := c.MaxVersion.Validate(); err != nil {
+		return err
+	}
+
 	// If MinVersion was unset in configuration, explicitly establish it as 1.3.
 	// This is different from the default crypto/tls behavior, as that package
 	// defaults to 1.0 if MinVersion is unset.
@@ -330,28 +592,51 @@ func (c *Config) enforceVersions(tc *tls.Config) {
 	if tc.MaxVersion != 0 && tc.MaxVersion < tc.MinVersion {
 		tc.MaxVersion = tc.MinVersion
 	}
+
+	return nil
 }
 
 // peerVerifiers configures the application-layer peer verifier code.
-func (c *Config) peerVerifiers(tc *tls.Config, extra ...PeerVerifier) {
+// Any errors reloading CRLs are sent to onError.
+func (c *Config) peerVerifiers(tc *tls.Config, onError func(error), extra ...PeerVerifier) error {
 	var pvs PeerVerifiers
-	pvs = c.PeerVerify.AppendTo(pvs)
+	if c.PeerVerify != nil {
+		v, err := c.PeerVerify.newVerifier(onError)
+		if err != nil {
+			return withField("PeerVerify.CRLFiles", err)
+		} else if v != nil {
+			pvs = pvs.Append(v)
+		}
+	}
+
 	pvs = pvs.Append(extra...)
-	pvs.SetTo(tc)
+	if c.PeerVerify != nil && c.PeerVerify.AllCertificates && len(pvs.v) > 0 {
+		tc.VerifyPeerCertificate = pvs.VerifyAllPeerCertificates
+	} else {
+		pvs.SetTo(tc)
+	}
+
+	return nil
 }
 
 // certificates configures the TLS certificates defined in this configuration.
-func (c *Config) certificates(tc *tls.Config) error {
-	if certs, err := c.Certificates.AppendTo(nil); err != nil {
-		return err
-	} else {
-		tc.Certificates = certs
+// If reloading is configured, the returned CertificateStore backs the certificates.
+func (c *Config) certificates(tc *tls.Config, onError func(error)) (cs *CertificateStore, err error) {
+	var selfSigned bool
+	if selfSigned, err = c.selfSigned(tc, onError); err != nil {
+		return nil, err
+	}
+
+	if !selfSigned {
+		if cs, err = c.loadCertificates(tc, onError); err != nil {
+			return nil, err
+		}
 	}
 
 	if c.RootCAs.Len() > 0 {
 		rootCAs := x509.NewCertPool()
 		if count, err := c.RootCAs.AppendTo(rootCAs); err != nil {
-			return err
+			return nil, withField("RootCAs", err)
 		} else if count > 0 {
 			tc.RootCAs = rootCAs
 		}
@@ -360,16 +645,61 @@ func (c *Config) certificates(tc *tls.Config) error {
 	if c.ClientCAs.Len() > 0 {
 		clientCAs := x509.NewCertPool()
 		if count, err := c.ClientCAs.AppendTo(clientCAs); err != nil {
-			return err
+			return nil, withField("ClientCAs", err)
 		} else if count > 0 {
 			tc.ClientCAs = clientCAs
-			tc.ClientAuth = tls.RequireAndVerifyClientCert
 		}
 	}
 
-	// NOTE: This method is deprecated, but in order not to break
-	// older code we call it here, for now.
-	tc.BuildNameToCertificate() //nolint:staticcheck
+	return
+}
+
+// loadCertificates loads the configured Certificates, either statically or into a
+// CertificateStore when reloading is configured.
+func (c *Config) loadCertificates(tc *tls.Config, onError func(error)) (*CertificateStore, error) {
+	var (
+		cs           *CertificateStore
+		certificates func() []tls.Certificate
+	)
+
+	if c.Reload != nil {
+		var err error
+		if cs, err = NewCertificateStore(c.Certificates, c.Reload.Interval, onError); err != nil {
+			return nil, withField("Certificates", err)
+		}
+
+		cs.SetTo(tc)
+		certificates = cs.Certificates
+	} else if certs, err := c.Certificates.AppendTo(nil); err != nil {
+		return nil, withField("Certificates", err)
+	} else {
+		tc.Certificates = certs
+		certificates = func() []tls.Certificate { return certs }
+	}
+
+	return cs, c.sniSelector(tc, certificates)
+}
+
+// sniSelector installs the SNI-based GetCertificate strategy for servers, provided there
+// are any certificates.
+func (c *Config) sniSelector(tc *tls.Config, certificates func() []tls.Certificate) error {
+	if c.Certificates.Len() == 0 {
+		return nil
+	}
+
+	s, err := newSNISelector(c.Certificates, certificates, c.SNI)
+	if err != nil {
+		return withField("Certificates", err)
+	}
+
+	// crypto/tls bypasses GetCertificate when a client sends no server name, and uses the first
+	// static certificate instead.  So, the default certificate must come first.
+	if s.defaultIndex > 0 && len(tc.Certificates) > s.defaultIndex {
+		certs := append([]tls.Certificate{tc.Certificates[s.defaultIndex]}, tc.Certificates[:s.defaultIndex]...)
+		tc.Certificates = append(certs, tc.Certificates[s.defaultIndex+1:]...)
+	}
+
+	tc.GetCertificate = s.GetCertificate
 	return nil
 }
 
@@ -378,27 +708,51 @@ func (c *Config) certificates(tc *tls.Config) error {
 //
 // The extra PeerVerifiers, if supplied, are used to build the tls.Config.VerifyPeerCertificate
 // strategy.
+//
+// If Reload is set, the certificates are loaded once and are not watched for changes, since
+// nothing could stop the watcher.  Use NewWithStore and BindCertificateStore, or ProvideConfig,
+// to reload certificates while an application runs.
 func (c *Config) New(extra ...PeerVerifier) (*tls.Config, error) {
+	tc, _, err := c.NewWithStore(nil, extra...)
+	return tc, err
+}
+
+// NewWithStore is like New, but also returns the CertificateStore that backs the certificates
+// when Reload is set.  The returned store will be nil if Reload is not set.  The store has not
+// been started, and the caller is responsible for calling Start and Stop on it.
+//
+// The onError callback receives any error that occurs while reloading certificates or the
+// PeerVerify CRL files, as well as a *SelfSignedNotice when a self-signed certificate is used.
+// If nil, these are written to the standard logger.
+func (c *Config) NewWithStore(onError func(error), extra ...PeerVerifier) (*tls.Config, *CertificateStore, error) {
 	if c == nil {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	tc := &tls.Config{
-		MinVersion:         c.MinVersion,
-		MaxVersion:         c.MaxVersion,
+		MinVersion:         uint16(c.MinVersion),
+		MaxVersion:         uint16(c.MaxVersion),
 		NextProtos:         c.nextProtos(),
 		ServerName:         c.ServerName,
 		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec // the caller set this explicitly
+	}
 
-		// always use the strong cipher suites for tls versions < 1.3
-		CipherSuites: strongCipherSuites,
+	if err := c.enforceVersions(tc); err != nil {
+		return nil, nil, err
 	}
 
-	c.enforceVersions(tc)
-	c.peerVerifiers(tc, extra...)
-	if err := c.certificates(tc); err != nil {
-		return nil, err
+	if err := c.peerVerifiers(tc, onError, extra...); err != nil {
+		return nil, nil, err
+	}
+
+	cs, err := c.certificates(tc, onError)
+	if err == nil {
+		err = c.policy(tc)
+	}
+
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return tc, nil
+	return tc, cs, nil
 }
@@ -574,8 +574,8 @@ func testConfigBasic(t *testing.T) {
 					KeyFile:         KeyFile,
 				},
 			},
-			MinVersion:         1,
-			MaxVersion:         3,
+			MinVersion:         tls.VersionTLS12,
+			MaxVersion:         tls.VersionTLS13,
 			ServerName:         "foobar.com",
 			InsecureSkipVerify: true,
 		}
@@ -585,13 +585,13 @@ func testConfigBasic(t *testing.T) {
 	require.NoError(err)
 	require.NotNil(tc)
 
-	assert.Equal(uint16(1), tc.MinVersion)
-	assert.Equal(uint16(3), tc.MaxVersion)
+	assert.Equal(uint16(tls.VersionTLS12), tc.MinVersion)
+	assert.Equal(uint16(tls.VersionTLS13), tc.MaxVersion)
 	assert.Equal([]string{"http/1.1"}, tc.NextProtos)
 	assert.Len(tc.Certificates, 1)
 	assert.Equal("foobar.com", tc.ServerName)
 	assert.True(tc.InsecureSkipVerify)
-	assert.NotEmpty(tc.NameToCertificate) //nolint:staticcheck // verify that BuildNameToCertificate was run
+	assert.NotNil(tc.GetCertificate)
 	assert.Nil(tc.VerifyPeerCertificate)
 	assert.Equal(tls.NoClientCert, tc.ClientAuth)
 }
@@ -607,8 +607,8 @@ func testConfigCustomNextProtos(t *testing.T) {
 					KeyFile:         KeyFile,
 				},
 			},
-			MinVersion: 1,
-			MaxVersion: 3,
+			MinVersion: tls.VersionTLS12,
+			MaxVersion: tls.VersionTLS13,
 			NextProtos: []string{"http", "ftp"},
 		}
 	)
@@ -617,11 +617,11 @@ func testConfigCustomNextProtos(t *testing.T) {
 	require.NoError(err)
 	require.NotNil(tc)
 
-	assert.Equal(uint16(1), tc.MinVersion)
-	assert.Equal(uint16(3), tc.MaxVersion)
+	assert.Equal(uint16(tls.VersionTLS12), tc.MinVersion)
+	assert.Equal(uint16(tls.VersionTLS13), tc.MaxVersion)
 	assert.Equal([]string{"http", "ftp"}, tc.NextProtos)
 	assert.Len(tc.Certificates, 1)
-	assert.NotEmpty(tc.NameToCertificate) //nolint:staticcheck // verify that BuildNameToCertificate was run
+	assert.NotNil(tc.GetCertificate)
 	assert.Nil(tc.VerifyPeerCertificate)
 	assert.Equal(tls.NoClientCert, tc.ClientAuth)
 }
@@ -670,7 +670,7 @@ func testConfigVerifyPeerCertificate(t *testing.T) {
 	assert.Zero(tc.MaxVersion)
 	assert.Equal([]string{"http/1.1"}, tc.NextProtos)
 	assert.Len(tc.Certificates, 1)
-	assert.NotEmpty(tc.NameToCertificate) //nolint:staticcheck // verify that BuildNameToCertificate was run
+	assert.NotNil(tc.GetCertificate)
 	assert.Equal(tls.NoClientCert, tc.ClientAuth)
 
 	require.NotNil(tc.VerifyPeerCertificate)
@@ -694,8 +694,8 @@ func testConfigCertPools(t *testing.T) {
 			},
 			RootCAs:    ExternalCertPool{CertificateFile}, // this works as a bundle also
 			ClientCAs:  ExternalCertPool{CertificateFile}, // this works as a bundle also
-			MinVersion: 1,
-			MaxVersion: 3,
+			MinVersion: tls.VersionTLS12,
+			MaxVersion: tls.VersionTLS13,
 			NextProtos: []string{"http", "ftp"},
 		}
 	)
@@ -704,11 +704,11 @@ func testConfigCertPools(t *testing.T) {
 	require.NoError(err)
 	require.NotNil(tc)
 
-	assert.Equal(uint16(1), tc.MinVersion)
-	assert.Equal(uint16(3), tc.MaxVersion)
+	assert.Equal(uint16(tls.VersionTLS12), tc.MinVersion)
+	assert.Equal(uint16(tls.VersionTLS13), tc.MaxVersion)
 	assert.Equal([]string{"http", "ftp"}, tc.NextProtos)
 	assert.Len(tc.Certificates, 1)
-	assert.NotEmpty(tc.NameToCertificate) //nolint:staticcheck // verify that BuildNameToCertificate was run
+	assert.NotNil(tc.GetCertificate)
 	assert.Nil(tc.VerifyPeerCertificate)
 	assert.Equal(tls.RequireAndVerifyClientCert, tc.ClientAuth)
 	assert.NotNil(tc.ClientCAs)
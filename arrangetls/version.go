@@ -0,0 +1,127 @@
+package arrangetls
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// UnsupportedTLSVersionError indicates that a configured TLS version is not
+// one of the versions supported by this package.
+type UnsupportedTLSVersionError struct {
+	Version TLSVersion
+}
+
+// Error satisfies the error interface.
+func (utve *UnsupportedTLSVersionError) Error() string {
+	return "Unsupported TLS version: " + strconv.FormatUint(uint64(utve.Version), 10)
+}
+
+// TLSVersion is a TLS protocol version that can be unmarshaled from human-readable
+// text.  The underlying value is the same as the crypto/tls version constants, e.g.
+// tls.VersionTLS12, so numeric values can be used in configuration as well.
+//
+// The zero value indicates that no version was configured.
+type TLSVersion uint16
+
+// tlsVersionText holds the canonical text forms of the supported TLS versions.
+var tlsVersionText = map[TLSVersion]string{
+	tls.VersionTLS10: "1.0",
+	tls.VersionTLS11: "1.1",
+	tls.VersionTLS12: "1.2",
+	tls.VersionTLS13: "1.3",
+}
+
+// ParseTLSVersion parses the text form of a TLS version.  All of "1.2", "TLS12",
+// "TLS1.2", and "TLSv1.2" are accepted, case insensitively, as is any unsigned integer
+// such as "771" or "0x0303".  The empty string is parsed as the zero TLSVersion.
+//
+// Parsing does not check that a numeric version is supported.  Use Validate for that.
+func ParseTLSVersion(v string) (TLSVersion, error) {
+	text := strings.ToUpper(strings.TrimSpace(v))
+	if len(text) == 0 {
+		return 0, nil
+	}
+
+	text = strings.TrimPrefix(text, "TLS")
+	text = strings.TrimPrefix(text, "V")
+	switch text {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+
+	n, err := strconv.ParseUint(strings.ToLower(strings.TrimSpace(v)), 0, 16)
+	if err != nil {
+		return 0, &UnrecognizedNameError{Kind: "TLS version", Name: v}
+	}
+
+	return TLSVersion(n), nil
+}
+
+// String returns the human-readable form of this version, e.g. "1.2".  Unsupported
+// versions are returned as decimal integers, and the zero value is the empty string.
+func (v TLSVersion) String() string {
+	if text, ok := tlsVersionText[v]; ok {
+		return text
+	}
+
+	if v == 0 {
+		return ""
+	}
+
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// MarshalText returns the human-readable form of this version, as with String.
+func (v TLSVersion) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText parses text using ParseTLSVersion.
+func (v *TLSVersion) UnmarshalText(text []byte) error {
+	parsed, err := ParseTLSVersion(string(text))
+	if err == nil {
+		*v = parsed
+	}
+
+	return err
+}
+
+// UnmarshalJSON allows a TLSVersion to be either a JSON string, parsed with
+// ParseTLSVersion, or a JSON number.
+func (v *TLSVersion) UnmarshalJSON(data []byte) error {
+	var text string
+	if len(data) > 0 && data[0] != '"' {
+		var n uint16
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+
+		*v = TLSVersion(n)
+		return nil
+	} else if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+
+	return v.UnmarshalText([]byte(text))
+}
+
+// Validate checks that this version is either unset or one of the TLS versions
+// supported by this package, i.e. TLS 1.0 through TLS 1.3.
+func (v TLSVersion) Validate() error {
+	if _, ok := tlsVersionText[v]; ok || v == 0 {
+		return nil
+	}
+
+	return &UnsupportedTLSVersionError{Version: v}
+}
@@ -0,0 +1,156 @@
+package arrangetls
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected TLSVersion
+	}{
+		{"", 0},
+		{"1.0", tls.VersionTLS10},
+		{"1.1", tls.VersionTLS11},
+		{"1.2", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+		{"TLS12", tls.VersionTLS12},
+		{"tls13", tls.VersionTLS13},
+		{"TLS1.2", tls.VersionTLS12},
+		{"TLSv1.3", tls.VersionTLS13},
+		{" 1.2 ", tls.VersionTLS12},
+		{"771", tls.VersionTLS12},
+		{"0x0304", tls.VersionTLS13},
+		{"1", 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.text, func(t *testing.T) {
+			assert := assert.New(t)
+
+			v, err := ParseTLSVersion(testCase.text)
+			assert.NoError(err)
+			assert.Equal(testCase.expected, v)
+		})
+	}
+
+	for _, text := range []string{"1.4", "TLS", "SSL3", "-1", "65536"} {
+		t.Run("Invalid/"+text, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+				une    *UnrecognizedNameError
+				_, err = ParseTLSVersion(text)
+			)
+
+			assert.ErrorAs(err, &une)
+			assert.Equal(text, une.Name)
+		})
+	}
+}
+
+func TestTLSVersionString(t *testing.T) {
+	testCases := []struct {
+		v        TLSVersion
+		expected string
+	}{
+		{0, ""},
+		{tls.VersionTLS10, "1.0"},
+		{tls.VersionTLS11, "1.1"},
+		{tls.VersionTLS12, "1.2"},
+		{tls.VersionTLS13, "1.3"},
+		{1, "1"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.expected, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(testCase.expected, testCase.v.String())
+
+			text, err := testCase.v.MarshalText()
+			assert.NoError(err)
+			assert.Equal(testCase.expected, string(text))
+		})
+	}
+}
+
+func TestTLSVersionValidate(t *testing.T) {
+	assert := assert.New(t)
+	for _, v := range []TLSVersion{0, tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13} {
+		assert.NoError(v.Validate())
+	}
+
+	var utve *UnsupportedTLSVersionError
+	assert.ErrorAs(TLSVersion(tls.VersionSSL30).Validate(), &utve) //nolint:staticcheck
+	assert.Equal(TLSVersion(tls.VersionSSL30), utve.Version)       //nolint:staticcheck
+	assert.ErrorAs(TLSVersion(1).Validate(), &utve)
+}
+
+func TestTLSVersionUnmarshal(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			c       Config
+		)
+
+		require.NoError(json.Unmarshal([]byte(`{"minVersion": "1.2", "maxVersion": 772}`), &c))
+		assert.Equal(TLSVersion(tls.VersionTLS12), c.MinVersion)
+		assert.Equal(TLSVersion(tls.VersionTLS13), c.MaxVersion)
+
+		data, err := json.Marshal(c)
+		require.NoError(err)
+		assert.Contains(string(data), `"MinVersion":"1.2"`)
+		assert.Contains(string(data), `"MaxVersion":"1.3"`)
+
+		assert.Error(json.Unmarshal([]byte(`{"minVersion": "bogus"}`), &c))
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			c       Config
+		)
+
+		require.NoError(yaml.Unmarshal([]byte("minversion: TLS12\nmaxversion: 772\n"), &c))
+		assert.Equal(TLSVersion(tls.VersionTLS12), c.MinVersion)
+		assert.Equal(TLSVersion(tls.VersionTLS13), c.MaxVersion)
+
+		data, err := yaml.Marshal(c)
+		require.NoError(err)
+		assert.Contains(string(data), `minversion: "1.2"`)
+
+		assert.Error(yaml.Unmarshal([]byte("minversion: bogus\n"), &c))
+	})
+}
+
+func testConfigUnsupportedVersion(t *testing.T) {
+	testCases := []Config{
+		{MinVersion: 1},
+		{MaxVersion: 0x0305},
+	}
+
+	for _, c := range testCases {
+		c := c
+		t.Run(c.MinVersion.String()+"-"+c.MaxVersion.String(), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				utve    *UnsupportedTLSVersionError
+				tc, err = c.New()
+			)
+
+			assert.ErrorAs(err, &utve)
+			assert.Nil(tc)
+		})
+	}
+}
+
+func TestConfigVersions(t *testing.T) {
+	t.Run("Unsupported", testConfigUnsupportedVersion)
+}